@@ -0,0 +1,158 @@
+// Package admin provides an http.Handler to inspect and tune the loggers of a
+// running service.
+//
+//	http.Handle("/debug/llog", admin.NewHandler(llog.DefaultRegistry(), collector))
+//
+// GET reports the loggers as JSON, POST changes the level of a logger:
+//
+//	curl -X POST -d '{"logger": "app", "level": "debug"}' localhost:8080/debug/llog
+//
+// An empty logger name changes the level of all the loggers.
+// LevelHandler also tunes the levels of the handlers.
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/metrics"
+	"net/http"
+)
+
+// Handler struct definition
+type Handler struct {
+	registry  *llog.Registry
+	collector *metrics.Collector
+}
+
+// LoggerInfo the state of a logger.
+type LoggerInfo struct {
+	Name      string        `json:"name"`
+	Parent    string        `json:"parent,omitempty"`
+	Level     int           `json:"level"`
+	LevelName string        `json:"levelName,omitempty"`
+	Handlers  []HandlerInfo `json:"handlers"`
+}
+
+// HandlerInfo the state of a handler.
+type HandlerInfo struct {
+	Type      string `json:"type"`
+	Level     *int   `json:"level,omitempty"`
+	Bubble    *bool  `json:"bubble,omitempty"`
+	Queued    *int   `json:"queued,omitempty"`
+	Capacity  *int   `json:"capacity,omitempty"`
+	Errors    uint64 `json:"errors"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// LevelChange the body of a POST request.
+type LevelChange struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+}
+
+// NewHandler New admin handler
+// collector: reports the handler error counts, may be nil.
+func NewHandler(registry *llog.Registry, collector *metrics.Collector) *Handler {
+	return &Handler{
+		registry:  registry,
+		collector: collector,
+	}
+}
+
+// ServeHTTP Reports the loggers on GET and changes levels on POST.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		if status, err := h.changeLevel(r); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"loggers": h.Loggers()})
+}
+
+// Loggers Gets the state of the registered loggers in name order.
+func (h *Handler) Loggers() []LoggerInfo {
+	var infos []LoggerInfo
+	h.registry.Range(func(name string, l *llog.Logger) bool {
+		info := LoggerInfo{
+			Name:     name,
+			Level:    l.GetLevel(),
+			Handlers: make([]HandlerInfo, 0),
+		}
+		info.LevelName, _ = l.GetLevelName(info.Level)
+		if p := l.GetParent(); p != nil {
+			info.Parent = p.GetName()
+		}
+		for _, hd := range l.GetHandlers() {
+			info.Handlers = append(info.Handlers, h.handlerInfo(hd))
+		}
+		infos = append(infos, info)
+		return true
+	})
+	return infos
+}
+
+// handlerInfo reports what a handler exposes of its state.
+func (h *Handler) handlerInfo(hd interface{}) HandlerInfo {
+	var info HandlerInfo
+	if n, ok := hd.(interface{ GetName() string }); ok && n.GetName() != "" {
+		info.Type = n.GetName()
+	} else {
+		info.Type = typeName(hd)
+	}
+	if l, ok := hd.(interface{ GetLevel() int }); ok {
+		level := l.GetLevel()
+		info.Level = &level
+	}
+	if b, ok := hd.(interface{ GetBubble() bool }); ok {
+		bubble := b.GetBubble()
+		info.Bubble = &bubble
+	}
+	if q, ok := hd.(interface {
+		Len() int
+		Cap() int
+	}); ok {
+		queued, capacity := q.Len(), q.Cap()
+		info.Queued, info.Capacity = &queued, &capacity
+	}
+	if h.collector != nil {
+		info.Errors = h.collector.Errors(info.Type)
+		info.LastError = h.collector.LastError(info.Type)
+	}
+	return info
+}
+
+// changeLevel applies a POSTed level change.
+func (h *Handler) changeLevel(r *http.Request) (int, error) {
+	var change LevelChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		return http.StatusBadRequest, err
+	}
+	level, err := llog.ParseLevel(change.Level)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if change.Logger == "" {
+		h.registry.SetLevel(level)
+		return http.StatusOK, nil
+	}
+	l, err := h.registry.GetLogger(change.Logger)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	l.SetLevel(level)
+	return http.StatusOK, nil
+}
+
+// typeName the type of a handler without a name.
+func typeName(v interface{}) string {
+	return fmt.Sprintf("%T", v)
+}
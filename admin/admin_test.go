@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"encoding/json"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	r := llog.NewRegistry()
+	logger := llog.NewLogger("app")
+	file := handler.NewFile("/dev/null", 0664, types.WARNING, true)
+	buf := handler.NewBuffer(file, 10, types.WARNING, true)
+	defer buf.Close()
+	logger.PushHandler(buf)
+	r.AddLogger(logger, "", false)
+	h := NewHandler(r, nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"logger": "app", "level": "error"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Loggers []LoggerInfo `json:"loggers"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Loggers) != 1 || body.Loggers[0].Level != types.ERROR {
+		t.Fatalf("unexpected loggers %+v", body.Loggers)
+	}
+	hi := body.Loggers[0].Handlers[0]
+	if hi.Type != "*handler.Buffer" || hi.Capacity == nil || *hi.Capacity != 10 {
+		t.Errorf("unexpected handler %+v", hi)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"logger": "nope", "level": "error"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	r := llog.NewRegistry()
+	for _, name := range []string{"app", "db.read", "db.write"} {
+		logger := llog.NewLogger(name)
+		logger.SetLevel(types.INFO)
+		logger.PushHandler(handler.NewFile("/dev/null", 0664, types.WARNING, true))
+		r.AddLogger(logger, "", false)
+	}
+	h := NewLevelHandler(r)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"logger": "db.*", "level": "debug"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"logger": "app", "handler": 0, "level": "error"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var body struct {
+		Loggers []LoggerLevel `json:"loggers"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	want := []LoggerLevel{
+		{Logger: "app", Level: "info", Handlers: []string{"error"}},
+		{Logger: "db.read", Level: "debug", Handlers: []string{"warning"}},
+		{Logger: "db.write", Level: "debug", Handlers: []string{"warning"}},
+	}
+	if !reflect.DeepEqual(body.Loggers, want) {
+		t.Errorf("unexpected levels %+v", body.Loggers)
+	}
+
+	for _, req := range []string{`{"logger": "nope", "level": "debug"}`, `{"logger": "app", "handler": 1, "level": "debug"}`} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(req)))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", req, w.Code)
+		}
+	}
+}
+
+func TestLevelHandlerWrapped(t *testing.T) {
+	r := llog.NewRegistry()
+	logger := llog.NewProduction()
+	r.AddLogger(logger, "app", false)
+	h := NewLevelHandler(r)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"logger": "app", "handler": 0, "level": "error"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	// the level reaches the handler wrapped by the sampler
+	record := types.NewRecord()
+	record.Channel = logger.GetName()
+	record.Level = types.WARNING
+	if logger.GetHandlers()[0].IsHandling(record) {
+		t.Error("expected the warnings to be dropped")
+	}
+	record.Level = types.ERROR
+	if !logger.GetHandlers()[0].IsHandling(record) {
+		t.Error("expected the errors to be handled")
+	}
+}
@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/syyongx/llog"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// LevelHandler reports and changes the levels of the loggers of a registry
+// and of their handlers, for live tuning. Loggers are selected by name
+// patterns in the path.Match syntax, such as "db.*", empty selecting all:
+//
+//	curl localhost:8080/debug/llog/level?logger=db.*
+//	curl -X PUT -d '{"logger": "db.*", "level": "debug"}' localhost:8080/debug/llog/level
+//	curl -X PUT -d '{"logger": "app", "handler": 0, "level": "error"}' localhost:8080/debug/llog/level
+//
+// Levels take effect right away, the records being handled concurrently.
+type LevelHandler struct {
+	registry *llog.Registry
+}
+
+// LoggerLevel the levels of a logger and of its handlers by index, empty for
+// the handlers without a level.
+type LoggerLevel struct {
+	Logger   string   `json:"logger"`
+	Level    string   `json:"level"`
+	Handlers []string `json:"handlers"`
+}
+
+// LevelRequest the body of a PUT request, Handler selecting a handler by index.
+type LevelRequest struct {
+	Logger  string `json:"logger"`
+	Handler *int   `json:"handler,omitempty"`
+	Level   string `json:"level"`
+}
+
+// NewLevelHandler New level handler
+func NewLevelHandler(registry *llog.Registry) *LevelHandler {
+	return &LevelHandler{registry: registry}
+}
+
+// ServeHTTP Reports the levels on GET and changes them on PUT or POST.
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pattern := r.URL.Query().Get("logger")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req LevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if status, err := h.SetLevel(req); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		pattern = req.Logger
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	levels, err := h.Levels(pattern)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"loggers": levels})
+}
+
+// Levels Gets the levels of the loggers matching the pattern in name order.
+func (h *LevelHandler) Levels(pattern string) ([]LoggerLevel, error) {
+	loggers, err := h.match(pattern)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]LoggerLevel, 0, len(loggers))
+	for _, l := range loggers {
+		ll := LoggerLevel{
+			Logger:   l.GetName(),
+			Level:    levelName(l, l.GetLevel()),
+			Handlers: make([]string, 0),
+		}
+		for _, hd := range l.GetHandlers() {
+			name := ""
+			if g, ok := hd.(interface{ GetLevel() int }); ok {
+				name = levelName(l, g.GetLevel())
+			}
+			ll.Handlers = append(ll.Handlers, name)
+		}
+		levels = append(levels, ll)
+	}
+	return levels, nil
+}
+
+// SetLevel Applies a level change, returning the HTTP status of failures.
+func (h *LevelHandler) SetLevel(req LevelRequest) (int, error) {
+	level, err := llog.ParseLevel(req.Level)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	loggers, err := h.match(req.Logger)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if len(loggers) == 0 {
+		return http.StatusNotFound, errors.New("no logger matches " + req.Logger)
+	}
+	if req.Handler == nil {
+		for _, l := range loggers {
+			l.SetLevel(level)
+		}
+		return http.StatusOK, nil
+	}
+	// check all the handlers first, so nothing changes on failures
+	setters := make([]interface{ SetLevel(int) }, 0, len(loggers))
+	for _, l := range loggers {
+		handlers := l.GetHandlers()
+		if *req.Handler < 0 || *req.Handler >= len(handlers) {
+			return http.StatusNotFound, errors.New("logger " + l.GetName() + " has no handler " + strconv.Itoa(*req.Handler))
+		}
+		s, ok := handlers[*req.Handler].(interface{ SetLevel(int) })
+		if !ok {
+			return http.StatusBadRequest, errors.New("handler " + strconv.Itoa(*req.Handler) + " of logger " + l.GetName() + " has no level")
+		}
+		setters = append(setters, s)
+	}
+	for _, s := range setters {
+		s.SetLevel(level)
+	}
+	return http.StatusOK, nil
+}
+
+// match gets the loggers whose name matches the pattern in name order.
+func (h *LevelHandler) match(pattern string) ([]*llog.Logger, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var loggers []*llog.Logger
+	h.registry.Range(func(name string, l *llog.Logger) bool {
+		if ok, _ := path.Match(pattern, name); ok || pattern == "" {
+			loggers = append(loggers, l)
+		}
+		return true
+	})
+	return loggers, nil
+}
+
+// levelName the name of a level, its value if it has none.
+func levelName(l *llog.Logger, level int) string {
+	if name, err := l.GetLevelName(level); err == nil {
+		return name
+	}
+	return strconv.Itoa(level)
+}
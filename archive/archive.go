@@ -0,0 +1,148 @@
+// Package archive ships rotated log files to object storage such as S3.
+//
+// ToS3 returns a callback for handler.RotatingFile.OnRotate: each rotated file
+// is gzip compressed, uploaded under a key built from a template, verified
+// by its size and optionally deleted locally:
+//
+//	rf.OnRotate(archive.ToS3(uploader, archive.Options{
+//		KeyTemplate: "logs/{hostname}/{date}/{filename}",
+//		DeleteLocal: true,
+//	}))
+//
+// The S3 uploader of the AWS SDK is built with the llog_s3 build tag, see NewS3Uploader.
+package archive
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/syyongx/llog/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultKeyTemplate the default template of the object keys.
+const DefaultKeyTemplate = "{hostname}/{date}/{filename}"
+
+// Uploader Interface of the object stores receiving the archives.
+type Uploader interface {
+	// Upload Stores the body of size bytes under key.
+	Upload(key string, body io.ReadSeeker, size int64) error
+	// Size Gets the size of the object stored under key.
+	Size(key string) (int64, error)
+}
+
+// Options the settings of an archival policy.
+type Options struct {
+	// KeyTemplate the object key, with the placeholders {filename} (with ".gz"
+	// if compressed), {date} of the upload as 2006-01-02, and {hostname}.
+	// Defaults to DefaultKeyTemplate.
+	KeyTemplate string
+	// NoCompress uploads the files as they are instead of gzip compressed.
+	NoCompress bool
+	// DeleteLocal deletes the rotated file and its compressed copy once uploaded and verified.
+	DeleteLocal bool
+	// OnError receives the failures, which are also logged on the internal channel.
+	OnError func(path string, err error)
+}
+
+// ToS3 Gets a rotation callback archiving the rotated files with uploader.
+func ToS3(uploader Uploader, opts Options) func(path string) {
+	if opts.KeyTemplate == "" {
+		opts.KeyTemplate = DefaultKeyTemplate
+	}
+	return func(path string) {
+		key, err := Archive(uploader, path, opts)
+		if err != nil {
+			types.Internal(types.WARNING, "archive failed", types.RecordContext{"path": path, "error": err.Error()})
+			if opts.OnError != nil {
+				opts.OnError(path, err)
+			}
+			return
+		}
+		types.Internal(types.INFO, "archived", types.RecordContext{"path": path, "key": key})
+	}
+}
+
+// Archive Compresses, uploads and verifies a file, returning its key.
+func Archive(uploader Uploader, path string, opts Options) (string, error) {
+	upload := path
+	if !opts.NoCompress {
+		upload = path + ".gz"
+		if err := compress(path, upload); err != nil {
+			return "", err
+		}
+		defer func() {
+			if opts.DeleteLocal {
+				os.Remove(upload)
+			}
+		}()
+	}
+	f, err := os.Open(upload)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	key := Key(opts.KeyTemplate, filepath.Base(upload), time.Now())
+	if err := uploader.Upload(key, f, info.Size()); err != nil {
+		return "", err
+	}
+	size, err := uploader.Size(key)
+	if err != nil {
+		return "", err
+	}
+	if size != info.Size() {
+		return "", errors.New("archive size mismatch for " + key)
+	}
+	if opts.DeleteLocal {
+		if err := os.Remove(path); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// Key Builds an object key from the template.
+func Key(template, filename string, t time.Time) string {
+	hostname, _ := os.Hostname()
+	return strings.NewReplacer(
+		"{filename}", filename,
+		"{date}", t.Format("2006-01-02"),
+		"{hostname}", hostname,
+	).Replace(template)
+}
+
+// compress gzips src into dst.
+func compress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if _, err := io.Copy(zw, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,54 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memUploader stores the objects in memory.
+type memUploader map[string][]byte
+
+func (m memUploader) Upload(key string, body io.ReadSeeker, size int64) error {
+	data, err := ioutil.ReadAll(body)
+	m[key] = data
+	return err
+}
+
+func (m memUploader) Size(key string) (int64, error) {
+	return int64(len(m[key])), nil
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app-2020-01-01.log")
+	ioutil.WriteFile(path, []byte("rotated\n"), 0644)
+
+	store := memUploader{}
+	key, err := Archive(store, path, Options{KeyTemplate: "logs/{filename}", DeleteLocal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "logs/app-2020-01-01.log.gz" {
+		t.Errorf("unexpected key %s", key)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(store[key]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(zr)
+	if string(data) != "rotated\n" {
+		t.Errorf("unexpected archive %q", data)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("local files left: %d", len(files))
+	}
+}
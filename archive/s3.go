@@ -0,0 +1,45 @@
+//go:build llog_s3
+// +build llog_s3
+
+package archive
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io"
+)
+
+// S3Uploader uploads the archives to an S3 bucket.
+type S3Uploader struct {
+	client s3iface.S3API
+	bucket string
+}
+
+// NewS3Uploader New S3 uploader of the bucket.
+func NewS3Uploader(client s3iface.S3API, bucket string) *S3Uploader {
+	return &S3Uploader{client: client, bucket: bucket}
+}
+
+// Upload Puts the object.
+func (u *S3Uploader) Upload(key string, body io.ReadSeeker, size int64) error {
+	_, err := u.client.PutObject(&s3.PutObjectInput{
+		Bucket:        aws.String(u.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	return err
+}
+
+// Size Gets the size of the object.
+func (u *S3Uploader) Size(key string) (int64, error) {
+	out, err := u.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.Int64Value(out.ContentLength), nil
+}
@@ -0,0 +1,160 @@
+// Package audit provides tamper-evident audit logs.
+//
+// Each record handled by the audit handler gets a sequence number and a hash
+// chained from the hash of the previous record, keyed by HMAC-SHA256 if a key
+// is given. Records must be written by the JSON formatter with the default fields,
+// so that Verify can recompute the chain from the written lines. The context is
+// hashed as written by the formatter of the wrapped handler, the processors of
+// the wrapped handler must not change it:
+//
+//	file := handler.NewFile("/var/log/audit.log", 0600, types.INFO, true)
+//	file.SetFormatter(formatter.NewJSON(nil, true))
+//	logger := audit.New("audit", file, key)
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/types"
+	"hash"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Keys of the record extra holding the chain.
+const (
+	SeqKey  = "audit_seq"
+	TimeKey = "audit_time"
+	PrevKey = "audit_prev"
+	HashKey = "audit_hash"
+)
+
+// Handler chains the records it passes to the wrapped handler.
+type Handler struct {
+	handler types.IHandler
+	key     []byte
+	mu      sync.Mutex
+	seq     uint64
+	prev    string
+}
+
+// NewHandler New audit handler, a nil key uses plain SHA-256.
+func NewHandler(handler types.IHandler, key []byte) *Handler {
+	return &Handler{
+		handler: handler,
+		key:     key,
+	}
+}
+
+// New Creates an audit logger writing its chained records to handler.
+func New(name string, handler types.IHandler, key []byte) *llog.Logger {
+	l := llog.NewLogger(name)
+	l.PushHandler(NewHandler(handler, key))
+	return l
+}
+
+// Resume Continues an existing chain from its last sequence number and hash,
+// as returned by Verify.
+func (h *Handler) Resume(seq uint64, hash string) {
+	h.mu.Lock()
+	h.seq = seq
+	h.prev = hash
+	h.mu.Unlock()
+}
+
+// IsHandling Checks whether the wrapped handler handles the record.
+func (h *Handler) IsHandling(record *types.Record) bool {
+	return h.handler.IsHandling(record)
+}
+
+// Handle Chains the record and passes it to the wrapped handler. Chaining and
+// writing are serialized so that records are written in sequence order.
+func (h *Handler) Handle(record *types.Record) bool {
+	if !h.IsHandling(record) {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ts := record.Datetime.UTC().Format(time.RFC3339Nano)
+	// the chain keys are not seen by the other handlers
+	record = record.Clone()
+	defer types.ReleaseRecord(record)
+	written := h.written(record)
+	sum := Hash(h.key, h.seq, h.prev, ts, record.Channel, record.LevelName, record.Message, written.Context, written.Event)
+	record.Extra[SeqKey] = h.seq
+	record.Extra[TimeKey] = ts
+	record.Extra[PrevKey] = h.prev
+	record.Extra[HashKey] = sum
+	h.prev = sum
+	return h.handler.Handle(record)
+}
+
+// written Get the context and event of a record as written by the formatter
+// of the wrapped handler, so that Verify hashes the same bytes.
+func (h *Handler) written(record *types.Record) line {
+	var f types.Formatter = defaultFormatter
+	if fh, ok := h.handler.(interface{ GetFormatter() types.Formatter }); ok && fh.GetFormatter() != nil {
+		f = fh.GetFormatter()
+	}
+	record.Formatted.Reset()
+	defer record.Formatted.Reset()
+	var l line
+	if err := f.Format(record); err == nil && json.Unmarshal(record.Formatted.Bytes(), &l) == nil {
+		return l
+	}
+	// not written by the JSON formatter, Verify fails anyway
+	ctx, _ := json.Marshal(formatter.Normalize(record.Context))
+	return line{Context: string(ctx)}
+}
+
+// defaultFormatter the formatter of the records of the handlers without one.
+var defaultFormatter = formatter.NewJSON(nil, true)
+
+// HandleBatch Handles a set of records.
+func (h *Handler) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		h.Handle(record)
+	}
+}
+
+// Flush Flushes the wrapped handler if it buffers writes.
+func (h *Handler) Flush() error {
+	if f, ok := h.handler.(types.Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close Closes the wrapped handler.
+func (h *Handler) Close() {
+	h.handler.Close()
+}
+
+// Hash Computes the hash of a record chained to the previous hash,
+// contextJSON and eventJSON being the record context and event as written by
+// the JSON formatter. The event is only hashed if the record has one.
+func Hash(key []byte, seq uint64, prev, ts, channel, level, message, contextJSON, eventJSON string) string {
+	var m hash.Hash
+	if key != nil {
+		m = hmac.New(sha256.New, key)
+	} else {
+		m = sha256.New()
+	}
+	fields := []string{strconv.FormatUint(seq, 10), prev, ts, channel, level, message, contextJSON}
+	if eventJSON != "" {
+		fields = append(fields, eventJSON)
+	}
+	for _, s := range fields {
+		// Length prefixes keep the fields from shifting into each other.
+		m.Write([]byte(strconv.Itoa(len(s))))
+		m.Write([]byte{':'})
+		m.Write([]byte(s))
+	}
+	return hex.EncodeToString(m.Sum(nil))
+}
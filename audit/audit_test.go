@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	var out bytes.Buffer
+	key := []byte("secret")
+	logger := New("audit", handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewJSON(nil, true))), key)
+	logger.Info("user created")
+	logger.With(types.RecordContext{"user": "bob"}).Warning("user deleted")
+	logger.Info("user created")
+
+	seq, hash, err := Verify(bytes.NewReader(out.Bytes()), key)
+	if err != nil || seq != 3 || hash == "" {
+		t.Fatalf("expected a valid chain of 3 records, got %d %q %v", seq, hash, err)
+	}
+	if _, _, err := Verify(bytes.NewReader(out.Bytes()), []byte("other")); err == nil {
+		t.Error("expected a key mismatch")
+	}
+
+	tampered := strings.Replace(out.String(), "bob", "eve", 1)
+	if _, _, err := Verify(strings.NewReader(tampered), key); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected line 2 to be reported, got %v", err)
+	}
+	lines := strings.SplitAfter(out.String(), "\n")
+	removed := lines[0] + lines[2]
+	if _, _, err := Verify(strings.NewReader(removed), key); err == nil {
+		t.Error("expected a removed record to be detected")
+	}
+}
+
+func TestVerifyNormalizedContext(t *testing.T) {
+	var out bytes.Buffer
+	logger := New("audit", handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewJSON(nil, true))), nil)
+	logger.With(types.RecordContext{
+		"err":     errors.New("denied"),
+		"elapsed": 1500 * time.Millisecond,
+		"at":      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}).Warning("login failed")
+	if seq, _, err := Verify(bytes.NewReader(out.Bytes()), nil); err != nil || seq != 1 {
+		t.Fatalf("expected a valid chain of 1 record, got %d %v in %s", seq, err, out.String())
+	}
+	tampered := strings.Replace(out.String(), "denied", "granted", 1)
+	if _, _, err := Verify(strings.NewReader(tampered), nil); err == nil {
+		t.Error("expected the altered error to be detected")
+	}
+}
+
+func TestVerifyEvent(t *testing.T) {
+	var out bytes.Buffer
+	logger := New("audit", handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewJSON(nil, true))), nil)
+	logger.SetLevel(types.WARNING)
+	logger.Event(types.Event{Name: "order.deleted", Actor: "bob", Subject: "order-1"})
+	if seq, _, err := Verify(bytes.NewReader(out.Bytes()), nil); err != nil || seq != 1 {
+		t.Fatalf("expected a valid chain of 1 event, got %d %v in %s", seq, err, out.String())
+	}
+	tampered := strings.Replace(out.String(), "bob", "eve", 1)
+	if _, _, err := Verify(strings.NewReader(tampered), nil); err == nil {
+		t.Error("expected the altered event to be detected")
+	}
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// line a record written by the JSON formatter with the default fields.
+type line struct {
+	Channel   string
+	LevelName string
+	Message   string
+	Context   string
+	Extra     string
+	Event     string
+}
+
+// chain the chain fields of the record extra.
+type chain struct {
+	Seq  uint64 `json:"audit_seq"`
+	Time string `json:"audit_time"`
+	Prev string `json:"audit_prev"`
+	Hash string `json:"audit_hash"`
+}
+
+// Verify Verifies the chain of the records read from r, starting at the
+// beginning of the chain. It returns the last sequence number and hash, to
+// resume the chain, and an error naming the first line that does not match.
+func Verify(r io.Reader, key []byte) (uint64, string, error) {
+	var seq uint64
+	var prev string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var l line
+		var c chain
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return seq, prev, fmt.Errorf("line %d: %v", n, err)
+		}
+		if err := json.Unmarshal([]byte(l.Extra), &c); err != nil {
+			return seq, prev, fmt.Errorf("line %d: extra: %v", n, err)
+		}
+		if c.Seq != seq+1 {
+			return seq, prev, fmt.Errorf("line %d: expected sequence %d, got %d", n, seq+1, c.Seq)
+		}
+		if c.Prev != prev {
+			return seq, prev, fmt.Errorf("line %d: previous hash does not match", n)
+		}
+		if Hash(key, c.Seq, c.Prev, c.Time, l.Channel, l.LevelName, l.Message, l.Context, l.Event) != c.Hash {
+			return seq, prev, fmt.Errorf("line %d: hash does not match, the record was altered", n)
+		}
+		seq, prev = c.Seq, c.Hash
+	}
+	return seq, prev, scanner.Err()
+}
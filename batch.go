@@ -0,0 +1,85 @@
+package llog
+
+import (
+	"context"
+	"github.com/syyongx/llog/types"
+	"time"
+)
+
+// Entry a record to be logged by LogBatch.
+type Entry struct {
+	Level   int
+	Message string
+	Fields  types.RecordContext
+	Ctx     context.Context
+	// Time the time of the record, the current time if zero.
+	Time time.Time
+}
+
+// LogBatch Logs entries at once, building their records once and passing
+// them to the HandleBatch of each handler, for bulk imports. Records handled by
+// a handler that does not bubble are not passed on. It returns the number of
+// entries dispatched.
+func (l *Logger) LogBatch(entries []Entry) int {
+	minLevel := l.GetLevel()
+	handlers, processors, unlock := l.stack()
+	defer unlock()
+	if len(handlers) == 0 {
+		return 0
+	}
+
+	now := l.now()
+	records := make([]*types.Record, 0, len(entries))
+	defer func() {
+		for _, record := range records {
+			types.ReleaseRecord(record)
+		}
+	}()
+	for _, e := range entries {
+		levelName, err := l.GetLevelName(e.Level)
+		if err != nil || e.Level < minLevel {
+			continue
+		}
+		t := e.Time
+		if t.IsZero() {
+			t = now
+		} else if l.location != nil {
+			t = t.In(l.location)
+		}
+		record := types.GetRecord()
+		record.Level = e.Level
+		l.fill(record, e.Ctx, levelName, e.Message, e.Fields, t)
+		for _, p := range processors {
+			p(record)
+		}
+		mergeExtra(record.Context, record.Extra, l.merge, l.mergePrefix)
+		records = append(records, record)
+	}
+
+	pending := records
+	dispatched := make(map[*types.Record]bool, len(records))
+	for _, h := range handlers {
+		if len(pending) == 0 {
+			break
+		}
+		batch := make([]*types.Record, 0, len(pending))
+		rest := pending[:0:0]
+		for _, record := range pending {
+			if h.IsHandling(record) {
+				batch = append(batch, record)
+				dispatched[record] = true
+			} else {
+				rest = append(rest, record)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		h.HandleBatch(batch)
+		if b, ok := h.(interface{ GetBubble() bool }); !ok || b.GetBubble() {
+			continue
+		}
+		pending = rest
+	}
+	return len(dispatched)
+}
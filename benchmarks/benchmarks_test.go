@@ -0,0 +1,156 @@
+package benchmarks
+
+import (
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"testing"
+	"time"
+)
+
+const devNull = "/dev/null"
+
+func newLogger(h types.IHandler) *llog.Logger {
+	logger := llog.NewLogger("bench")
+	logger.PushHandler(h)
+	return logger
+}
+
+func newFile() *handler.File {
+	return handler.NewFileWith(devNull, handler.WithFormatter(formatter.NewLine("", time.RFC3339)))
+}
+
+func tenFields() types.RecordContext {
+	return types.RecordContext{
+		"int":      1,
+		"int64":    int64(2),
+		"float":    3.5,
+		"string":   "four",
+		"bool":     true,
+		"duration": time.Second,
+		"time":     time.Unix(0, 0),
+		"strings":  []string{"a", "b"},
+		"error":    "failed",
+		"user":     "bob",
+	}
+}
+
+func BenchmarkDisabledLevel(b *testing.B) {
+	logger := newLogger(newFile())
+	logger.SetLevel(types.WARNING)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("disabled")
+	}
+}
+
+func BenchmarkSimpleMessage(b *testing.B) {
+	logger := newLogger(newFile())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("simple message")
+	}
+}
+
+func BenchmarkTenFieldsLine(b *testing.B) {
+	logger := newLogger(newFile())
+	fields := tenFields()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.AddRecordFields(nil, types.INFO, "structured", fields)
+	}
+}
+
+func BenchmarkTenFieldsJSON(b *testing.B) {
+	logger := newLogger(handler.NewJSONFile(devNull, types.DEBUG))
+	fields := tenFields()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.AddRecordFields(nil, types.INFO, "structured", fields)
+	}
+}
+
+func BenchmarkTenFieldsLogfmt(b *testing.B) {
+	logger := newLogger(handler.NewFileWith(devNull, handler.WithFormatter(formatter.NewLogfmt(time.RFC3339))))
+	fields := tenFields()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.AddRecordFields(nil, types.INFO, "structured", fields)
+	}
+}
+
+func BenchmarkWithFields(b *testing.B) {
+	logger := newLogger(newFile()).With(tenFields())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("bound fields")
+	}
+}
+
+func BenchmarkConcurrentWriters(b *testing.B) {
+	logger := newLogger(newFile())
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("concurrent message")
+		}
+	})
+}
+
+func BenchmarkCoalescedWriters(b *testing.B) {
+	file := handler.NewFileWith(devNull, handler.WithFormatter(formatter.NewLine("", time.RFC3339)), handler.WithCoalescing())
+	logger := newLogger(file)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("concurrent message")
+		}
+	})
+	b.StopTimer()
+	file.Close()
+}
+
+func BenchmarkFile(b *testing.B) {
+	logger := newLogger(newFile())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("file")
+	}
+}
+
+func BenchmarkBufferedFile(b *testing.B) {
+	file := newFile()
+	if err := file.SetBufio(64*1024, handler.FlushModeLimit, 0); err != nil {
+		b.Fatal(err)
+	}
+	logger := newLogger(file)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("buffered")
+	}
+	b.StopTimer()
+	file.Close()
+}
+
+func BenchmarkAsyncFile(b *testing.B) {
+	buf := handler.NewBufferWith(newFile(), handler.WithBufferSize(1024))
+	logger := newLogger(buf)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("async")
+	}
+	b.StopTimer()
+	buf.Close()
+}
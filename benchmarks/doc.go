@@ -0,0 +1,9 @@
+// Package benchmarks holds the benchmarks of the logging hot paths.
+//
+// Results are tracked in baseline.txt, compare changes against it with benchstat:
+//
+//	go test -run NONE -bench . -benchmem -count 5 ./benchmarks > new.txt
+//	benchstat benchmarks/baseline.txt new.txt
+//
+// Refresh the baseline on the same machine when a change is expected to move it.
+package benchmarks
@@ -0,0 +1,77 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/types"
+)
+
+// Builder assembles a Logger in one expression.
+//
+//	logger := llog.NewBuilder().
+//		Channel("api").
+//		Handler(file).
+//		Processor(uid).
+//		Build()
+type Builder struct {
+	name       string
+	timezone   string
+	handlers   []types.IHandler
+	processors []types.Processor
+	mirror     int
+}
+
+// NewBuilder new builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Channel Set the channel name of the logger.
+func (b *Builder) Channel(name string) *Builder {
+	b.name = name
+	return b
+}
+
+// Handler Adds handlers, the first added handler is the first to handle records.
+func (b *Builder) Handler(handlers ...types.IHandler) *Builder {
+	b.handlers = append(b.handlers, handlers...)
+	return b
+}
+
+// FormattedHandler Sets the formatter on the handler and adds it.
+func (b *Builder) FormattedHandler(h FormattableIHandler, f types.Formatter) *Builder {
+	h.SetFormatter(f)
+	return b.Handler(h)
+}
+
+// Processor Adds processors, the first added processor runs first.
+func (b *Builder) Processor(processors ...types.Processor) *Builder {
+	b.processors = append(b.processors, processors...)
+	return b
+}
+
+// Timezone Set the timezone of the logger.
+func (b *Builder) Timezone(tz string) *Builder {
+	b.timezone = tz
+	return b
+}
+
+// MirrorStderr Writes the records at or above level to stderr as well, see Logger.MirrorStderr.
+func (b *Builder) MirrorStderr(level int) *Builder {
+	b.mirror = level
+	return b
+}
+
+// Build Builds the logger.
+func (b *Builder) Build() *Logger {
+	l := NewLogger(b.name)
+	l.SetHandlers(b.handlers)
+	l.SetProcessors(b.processors)
+	l.SetTimezone(b.timezone)
+	l.MirrorStderr(b.mirror)
+	return l
+}
+
+// FormattableIHandler a handler whose formatter can be set.
+type FormattableIHandler interface {
+	types.IHandler
+	SetFormatter(formatter types.Formatter)
+}
@@ -0,0 +1,42 @@
+// Command llog-audit verifies the hash chain of audit logs.
+//
+//	llog-audit [-key-file path] audit.log
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/syyongx/llog/audit"
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	keyFile := flag.String("key-file", "", "file holding the HMAC key")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: llog-audit [-key-file path] file")
+		os.Exit(2)
+	}
+	var key []byte
+	if *keyFile != "" {
+		k, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		key = k
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer f.Close()
+	seq, hash, err := audit.Verify(f, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d records verified, last hash %s\n", flag.Arg(0), seq, hash)
+}
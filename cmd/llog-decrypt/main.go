@@ -0,0 +1,41 @@
+// Command llog-decrypt decrypts log files encrypted by the crypt package to stdout.
+//
+//	llog-decrypt -key-env LLOG_KEY app.log
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/syyongx/llog/crypt"
+	"io"
+	"os"
+)
+
+func main() {
+	keyEnv := flag.String("key-env", "LLOG_KEY", "environment variable holding the key in hex or base64")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: llog-decrypt [-key-env name] file")
+		os.Exit(2)
+	}
+	key, err := crypt.KeyFromEnv(*keyEnv)()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer f.Close()
+	r, err := crypt.NewReader(f, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if _, err := io.Copy(os.Stdout, r); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,186 @@
+// Package config builds loggers, handlers, formatters and processors from a
+// JSON or YAML document, so the log setup can change without recompilation.
+//
+//	{
+//		"loggers": [{
+//			"name": "app",
+//			"processors": ["uid"],
+//			"handlers": [{
+//				"type": "rotating_file",
+//				"level": "warning",
+//				"formatter": {"type": "json", "options": {"append_newline": true}},
+//				"options": {"path": "/var/log/app.log", "max_files": 7}
+//			}]
+//		}]
+//	}
+//
+// YAML documents are decoded by a registered decoder, e.g.
+//
+//	config.RegisterDecoder(".yaml", yaml.Unmarshal)
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/processor"
+	"github.com/syyongx/llog/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Config struct definition
+type Config struct {
+	Loggers []*LoggerConfig `json:"loggers" yaml:"loggers"`
+}
+
+// LoggerConfig struct definition
+type LoggerConfig struct {
+	Name       string           `json:"name" yaml:"name"`
+	Timezone   string           `json:"timezone" yaml:"timezone"`
+	Processors []string         `json:"processors" yaml:"processors"`
+	Handlers   []*HandlerConfig `json:"handlers" yaml:"handlers"`
+	// Glob patterns of the field keys emitted by all the handlers, see processor.Fields.
+	FieldsAllow []string `json:"fields_allow" yaml:"fields_allow"`
+	FieldsDeny  []string `json:"fields_deny" yaml:"fields_deny"`
+}
+
+// HandlerConfig struct definition
+// Handler is the wrapped handler of decorators such as "buffer".
+type HandlerConfig struct {
+	Type      string           `json:"type" yaml:"type"`
+	Level     string           `json:"level" yaml:"level"`
+	Bubble    *bool            `json:"bubble" yaml:"bubble"`
+	Formatter *FormatterConfig `json:"formatter" yaml:"formatter"`
+	Handler   *HandlerConfig   `json:"handler" yaml:"handler"`
+	Options   Options          `json:"options" yaml:"options"`
+}
+
+// FormatterConfig struct definition
+type FormatterConfig struct {
+	Type    string  `json:"type" yaml:"type"`
+	Options Options `json:"options" yaml:"options"`
+}
+
+// Decoder decodes a document into v.
+type Decoder func(data []byte, v interface{}) error
+
+var (
+	decoderMu sync.RWMutex
+	decoders  = map[string]Decoder{
+		".json": json.Unmarshal,
+	}
+)
+
+// RegisterDecoder Registers the decoder of files with the given extension.
+func RegisterDecoder(ext string, decoder Decoder) {
+	decoderMu.Lock()
+	decoders[strings.ToLower(ext)] = decoder
+	decoderMu.Unlock()
+}
+
+// Parse Parses a document with the given decoder.
+func Parse(data []byte, decoder Decoder) (*Config, error) {
+	c := new(Config)
+	if err := decoder(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseJSON Parses a JSON document.
+func ParseJSON(data []byte) (*Config, error) {
+	return Parse(data, json.Unmarshal)
+}
+
+// ParseFile Parses a file, the decoder is chosen by the file extension.
+func ParseFile(path string) (*Config, error) {
+	decoderMu.RLock()
+	decoder, ok := decoders[strings.ToLower(filepath.Ext(path))]
+	decoderMu.RUnlock()
+	if !ok {
+		return nil, errors.New("no decoder registered for " + path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, decoder)
+}
+
+// Build Builds the configured loggers into a new registry.
+func (c *Config) Build() (*llog.Registry, error) {
+	r := llog.NewRegistry()
+	if err := c.Apply(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Apply Builds the configured loggers and applies them to the registry.
+// Loggers already in the registry keep their identity, their handler and
+// processor stacks are swapped and the old handlers are closed.
+// Nothing is applied if any logger fails to build.
+func (c *Config) Apply(r *llog.Registry) error {
+	built := make([]*llog.Logger, 0, len(c.Loggers))
+	for _, lc := range c.Loggers {
+		logger, err := lc.Build()
+		if err != nil {
+			for _, l := range built {
+				closeHandlers(l.GetHandlers())
+			}
+			return err
+		}
+		built = append(built, logger)
+	}
+	for _, logger := range built {
+		live, err := r.GetLogger(logger.GetName())
+		if err != nil {
+			if err := r.AddLogger(logger, "", false); err != nil {
+				closeHandlers(logger.GetHandlers())
+				return err
+			}
+			continue
+		}
+		live.SetProcessors(logger.GetProcessor())
+		live.SetLocation(logger.GetLocation())
+		closeHandlers(live.SwapHandlers(logger.GetHandlers()))
+	}
+	return nil
+}
+
+// close all the handlers.
+func closeHandlers(handlers []types.IHandler) {
+	for _, h := range handlers {
+		h.Close()
+	}
+}
+
+// Build Builds the logger.
+func (lc *LoggerConfig) Build() (*llog.Logger, error) {
+	b := llog.NewBuilder().Channel(lc.Name).Timezone(lc.Timezone)
+	for _, name := range lc.Processors {
+		p, err := BuildProcessor(name)
+		if err != nil {
+			return nil, err
+		}
+		b.Processor(p)
+	}
+	if len(lc.FieldsAllow) > 0 || len(lc.FieldsDeny) > 0 {
+		b.Processor(processor.Fields(lc.FieldsAllow, lc.FieldsDeny))
+	}
+	for _, hc := range lc.Handlers {
+		h, err := BuildHandler(hc)
+		if err != nil {
+			return nil, err
+		}
+		b.Handler(h)
+	}
+	l := b.Build()
+	if err := l.SetTimezone(lc.Timezone); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
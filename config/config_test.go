@@ -0,0 +1,177 @@
+package config
+
+import (
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	data := []byte(`{
+		"loggers": [{
+			"name": "app",
+			"processors": ["uid"],
+			"handlers": [{
+				"type": "buffer",
+				"level": "warning",
+				"options": {"buffer_size": 10},
+				"handler": {
+					"type": "file",
+					"formatter": {"type": "json"},
+					"options": {"path": "/dev/null", "perm": "0664"}
+				}
+			}]
+		}]
+	}`)
+	c, err := ParseJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, err := r.GetLogger("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := logger.GetHandlers()
+	if len(hs) != 1 {
+		t.Fatalf("expected 1 handler, got %d", len(hs))
+	}
+	buf, ok := hs[0].(*handler.Buffer)
+	if !ok {
+		t.Fatalf("expected buffer handler, got %T", hs[0])
+	}
+	if buf.GetLevel() != 300 {
+		t.Errorf("expected level 300, got %d", buf.GetLevel())
+	}
+	logger.Warning("xxx")
+	buf.Close()
+}
+
+func TestUnknownType(t *testing.T) {
+	_, err := BuildHandler(&HandlerConfig{Type: "nope"})
+	if err == nil {
+		t.Error("expected error for unknown handler type")
+	}
+}
+
+func TestPreallocFileEncryption(t *testing.T) {
+	_, err := BuildHandler(&HandlerConfig{Type: "prealloc_file", Options: Options{"path": "/dev/null", "encryption_key_env": "LLOG_KEY"}})
+	if err == nil {
+		t.Error("expected an error for an encrypted prealloc_file")
+	}
+}
+
+func TestApply(t *testing.T) {
+	c, err := ParseJSON([]byte(`{"loggers": [{"name": "app", "handlers": [{"type": "file", "options": {"path": "/dev/null"}}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, _ := r.GetLogger("app")
+	old := live.GetHandlers()[0]
+
+	c.Loggers[0].Handlers[0].Level = "error"
+	if err := c.Apply(r); err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := r.GetLogger("app")
+	if logger != live {
+		t.Error("expected the live logger to be kept")
+	}
+	h := logger.GetHandlers()[0].(*handler.File)
+	if h == old || h.GetLevel() != 400 {
+		t.Errorf("expected a new handler with level 400, got level %d", h.GetLevel())
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "llog.json")
+	write := func(level string, mod time.Time) {
+		data := `{"loggers": [{"name": "app", "handlers": [{"type": "file", "level": "` + level + `", "options": {"path": "/dev/null"}}]}]}`
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	level := func(r *llog.Registry) int {
+		l, err := r.GetLogger("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l.GetHandlers()[0].(*handler.File).GetLevel()
+	}
+	waitLevel := func(r *llog.Registry, want int) {
+		for deadline := time.Now().Add(2 * time.Second); level(r) != want; {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected level %d, got %d", want, level(r))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	now := time.Now()
+	write("info", now.Add(-time.Hour))
+	r := llog.NewRegistry()
+	w := NewWatcher(path, r, 10*time.Millisecond)
+	errs := make(chan error, 1)
+	w.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	live, _ := r.GetLogger("app")
+	if level(r) != types.INFO {
+		t.Fatalf("expected level %d, got %d", types.INFO, level(r))
+	}
+
+	// a modified file is reloaded, keeping the live logger
+	write("error", now)
+	waitLevel(r, types.ERROR)
+	if l, _ := r.GetLogger("app"); l != live {
+		t.Error("expected the live logger to be kept")
+	}
+
+	// an invalid file is reported and the previous config stays active
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, now.Add(time.Hour), now.Add(time.Hour))
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the reload error to be reported")
+	}
+	if level(r) != types.ERROR {
+		t.Errorf("expected the previous level, got %d", level(r))
+	}
+	// and not reported again until modified
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Errorf("expected the invalid file to be reported once, got %v", err)
+	default:
+	}
+	write("warning", now.Add(2*time.Hour))
+	waitLevel(r, types.WARNING)
+}
@@ -0,0 +1,526 @@
+package config
+
+import (
+	"errors"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/crypt"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/processor"
+	"github.com/syyongx/llog/types"
+	"os"
+	"sync"
+	"time"
+)
+
+// HandlerFactory Creates a handler of a type.
+// opts holds the level, bubble and formatter settings of the handler config.
+type HandlerFactory func(c *HandlerConfig, opts []handler.Option) (types.IHandler, error)
+
+// FormatterFactory Creates a formatter of a type.
+type FormatterFactory func(c *FormatterConfig) (types.Formatter, error)
+
+var (
+	factoryMu          sync.RWMutex
+	handlerFactories   = make(map[string]HandlerFactory)
+	formatterFactories = make(map[string]FormatterFactory)
+	processors         = make(map[string]types.Processor)
+)
+
+func init() {
+	RegisterHandler("file", newFile)
+	RegisterHandler("json_file", newJSONFile)
+	RegisterHandler("rotating_file", newRotatingFile)
+	RegisterHandler("prealloc_file", newPreallocFile)
+	RegisterHandler("buffer", newBuffer)
+	RegisterHandler("sampler", newSampler)
+	RegisterHandler("spool", newSpool)
+	RegisterHandler("breaker", newBreaker)
+	RegisterHandler("timeout", newTimeout)
+	RegisterHandler("net", newNet)
+	RegisterHandler("mail", newMail)
+	RegisterHandler("stdout", newStdout)
+	RegisterHandler("stderr", newStderr)
+	RegisterHandler("console", newConsole)
+
+	RegisterFormatter("line", newLine)
+	RegisterFormatter("json", newJSON)
+	RegisterFormatter("logfmt", newLogfmt)
+
+	RegisterProcessor("uid", processor.UID)
+	RegisterProcessor("process_id", processor.ProcessID)
+	RegisterProcessor("memory_usage", processor.MemoryUsage)
+	RegisterProcessor("caller", processor.Caller)
+}
+
+// RegisterHandler Registers the factory of a handler type, replacing any existing one.
+func RegisterHandler(typ string, factory HandlerFactory) {
+	factoryMu.Lock()
+	handlerFactories[typ] = factory
+	factoryMu.Unlock()
+}
+
+// RegisterFormatter Registers the factory of a formatter type, replacing any existing one.
+func RegisterFormatter(typ string, factory FormatterFactory) {
+	factoryMu.Lock()
+	formatterFactories[typ] = factory
+	factoryMu.Unlock()
+}
+
+// RegisterProcessor Registers a processor by name, replacing any existing one.
+func RegisterProcessor(name string, p types.Processor) {
+	factoryMu.Lock()
+	processors[name] = p
+	factoryMu.Unlock()
+}
+
+// BuildHandler Builds a handler from its config.
+func BuildHandler(c *HandlerConfig) (types.IHandler, error) {
+	if c == nil {
+		return nil, errors.New("handler config is missing")
+	}
+	factoryMu.RLock()
+	factory, ok := handlerFactories[c.Type]
+	factoryMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown handler type " + c.Type)
+	}
+
+	var opts []handler.Option
+	if c.Level != "" {
+		level, err := llog.ParseLevel(c.Level)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, handler.WithLevel(level))
+	}
+	if c.Bubble != nil {
+		opts = append(opts, handler.WithBubble(*c.Bubble))
+	}
+	if channels := c.Options.Strings("channels"); len(channels) > 0 {
+		opts = append(opts, handler.WithChannels(channels...))
+	}
+	if c.Formatter != nil {
+		f, err := BuildFormatter(c.Formatter)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, handler.WithFormatter(f))
+	}
+	h, err := factory(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	allow, deny := c.Options.Strings("fields_allow"), c.Options.Strings("fields_deny")
+	if len(allow) > 0 || len(deny) > 0 {
+		p, ok := h.(interface{ PushProcessor(types.Processor) })
+		if !ok {
+			return nil, errors.New("handler type " + c.Type + " does not support field lists")
+		}
+		p.PushProcessor(processor.Fields(allow, deny))
+	}
+	return h, nil
+}
+
+// BuildFormatter Builds a formatter from its config.
+func BuildFormatter(c *FormatterConfig) (types.Formatter, error) {
+	factoryMu.RLock()
+	factory, ok := formatterFactories[c.Type]
+	factoryMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown formatter type " + c.Type)
+	}
+	return factory(c)
+}
+
+// BuildProcessor Gets a registered processor by name.
+func BuildProcessor(name string) (types.Processor, error) {
+	factoryMu.RLock()
+	p, ok := processors[name]
+	factoryMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown processor " + name)
+	}
+	return p, nil
+}
+
+// tlsOptions appends the TLS option if any tls_ setting is set.
+func tlsOptions(c *HandlerConfig, opts []handler.Option) ([]handler.Option, error) {
+	t := &handler.TLSConfig{
+		CAFile:             c.Options.String("tls_ca", ""),
+		CertFile:           c.Options.String("tls_cert", ""),
+		KeyFile:            c.Options.String("tls_key", ""),
+		ServerName:         c.Options.String("tls_server_name", ""),
+		InsecureSkipVerify: c.Options.Bool("tls_insecure_skip_verify", false),
+	}
+	version := c.Options.String("tls_min_version", "")
+	if !c.Options.Bool("tls", false) && *t == (handler.TLSConfig{}) && version == "" {
+		return opts, nil
+	}
+	if version != "" {
+		v, err := handler.ParseTLSVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		t.MinVersion = v
+	}
+	config, err := t.Build()
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, handler.WithTLS(config)), nil
+}
+
+// dialerOptions appends the dialer option of the proxy setting.
+func dialerOptions(c *HandlerConfig, opts []handler.Option) ([]handler.Option, error) {
+	proxy := c.Options.String("proxy", "")
+	if proxy == "" {
+		return opts, nil
+	}
+	dialer, err := handler.NewProxyDialer(proxy, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, handler.WithDialer(dialer)), nil
+}
+
+// retryOptions appends the retry policy option if retry_max_attempts is set.
+func retryOptions(c *HandlerConfig, opts []handler.Option) []handler.Option {
+	attempts := c.Options.Int("retry_max_attempts", 0)
+	if attempts <= 0 {
+		return opts
+	}
+	return append(opts, handler.WithRetry(handler.Retry{
+		MaxAttempts: attempts,
+		Base:        time.Duration(c.Options.Int("retry_base_ms", 100)) * time.Millisecond,
+		Max:         time.Duration(c.Options.Int("retry_max_ms", 30000)) * time.Millisecond,
+		Jitter:      float64(c.Options.Int("retry_jitter_percent", 20)) / 100,
+	}))
+}
+
+// fileOptions appends the file permission, encryption and flush options.
+func fileOptions(c *HandlerConfig, opts []handler.Option) []handler.Option {
+	if perm := c.Options.Int("perm", 0); perm > 0 {
+		opts = append(opts, handler.WithPerm(os.FileMode(perm)))
+	}
+	if env := c.Options.String("encryption_key_env", ""); env != "" {
+		opts = append(opts, handler.WithWrapper(crypt.Wrapper(crypt.KeyFromEnv(env))))
+	}
+	if c.Options.Bool("coalesce", false) {
+		opts = append(opts, handler.WithCoalescing())
+	}
+	if ms := c.Options.Int("flush_interval_ms", 0); ms > 0 {
+		opts = append(opts, handler.WithFlushInterval(time.Duration(ms)*time.Millisecond),
+			handler.WithBufferSize(c.Options.Int("bufio_size", 0)))
+	}
+	return opts
+}
+
+func newFile(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	path := c.Options.String("path", "")
+	if path == "" {
+		return nil, errors.New("file handler requires a path")
+	}
+	return handler.NewFileWith(path, fileOptions(c, opts)...), nil
+}
+
+func newJSONFile(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	opts = append([]handler.Option{handler.WithFormatter(formatter.NewJSON(nil, true))}, opts...)
+	return newFile(c, opts)
+}
+
+func newRotatingFile(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	path := c.Options.String("path", "")
+	if path == "" {
+		return nil, errors.New("rotating_file handler requires a path")
+	}
+	rf := handler.NewRotatingFileWith(path, c.Options.Int("max_files", 0), fileOptions(c, opts)...)
+	if format := c.Options.String("filename_format", ""); format != "" {
+		dateFormat := c.Options.String("date_format", handler.FilePerDay)
+		if err := rf.SetFilenameFormat(format, dateFormat); err != nil {
+			return nil, err
+		}
+	}
+	if tz := c.Options.String("timezone", ""); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+		rf.SetLocation(loc)
+	}
+	for name, value := range c.Options.StringMap("filename_tokens") {
+		if err := rf.SetFilenameToken(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if c.Options.Bool("checksum", false) {
+		rf.SetChecksum(c.Options.String("manifest", ""))
+	}
+	return rf, nil
+}
+
+func newPreallocFile(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	path := c.Options.String("path", "")
+	if path == "" {
+		return nil, errors.New("prealloc_file handler requires a path")
+	}
+	// the staged block is rewritten in place, which an encrypted stream can't do
+	if c.Options.String("encryption_key_env", "") != "" {
+		return nil, errors.New("prealloc_file handler does not support encryption_key_env")
+	}
+	opts = append(opts, handler.WithBufferSize(c.Options.Int("chunk_size", 0)))
+	return handler.NewPreallocFileWith(path, int64(c.Options.Int("prealloc_size", 0)), fileOptions(c, opts)...), nil
+}
+
+func newBuffer(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	h, err := BuildHandler(c.Handler)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, handler.WithBufferSize(c.Options.Int("buffer_size", 0)))
+	if ms := c.Options.Int("flush_interval_ms", 0); ms > 0 {
+		opts = append(opts, handler.WithFlushInterval(time.Duration(ms)*time.Millisecond))
+	}
+	opts = append(opts, handler.WithMaxAge(time.Duration(c.Options.Int("max_age_ms", 0))*time.Millisecond))
+	opts = append(opts, handler.WithBatching(handler.Batching{
+		MaxRecords: c.Options.Int("batch_max_records", 0),
+		MaxBytes:   c.Options.Int("batch_max_bytes", 0),
+		MaxLinger:  time.Duration(c.Options.Int("batch_linger_ms", 0)) * time.Millisecond,
+	}))
+	if c.Options.Bool("adaptive_sampling", false) {
+		keep := types.WARNING
+		if name := c.Options.String("sampling_keep_level", ""); name != "" {
+			if keep, err = llog.ParseLevel(name); err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, handler.WithAdaptiveSampling(handler.Adaptive{
+			HighWater:  float64(c.Options.Int("sampling_high_water_percent", 80)) / 100,
+			MaxLatency: time.Duration(c.Options.Int("sampling_max_latency_ms", 0)) * time.Millisecond,
+			Keep:       keep,
+			Rate:       c.Options.Int("sampling_rate", 10),
+			Interval:   time.Duration(c.Options.Int("sampling_interval_ms", 1000)) * time.Millisecond,
+		}))
+	}
+	var spill types.IHandler
+	policy := handler.OverflowBlock
+	switch overflow := c.Options.String("overflow", "block"); overflow {
+	case "block":
+	case "drop_oldest":
+		policy = handler.OverflowDropOldest
+	case "drop_newest":
+		policy = handler.OverflowDropNewest
+	case "spill":
+		path := c.Options.String("spill_path", "")
+		if path == "" {
+			return nil, errors.New("buffer spill requires a spill_path")
+		}
+		policy = handler.OverflowSpill
+		spill = handler.NewFileWith(path, fileOptions(c, nil)...)
+	default:
+		return nil, errors.New("unknown overflow policy " + overflow)
+	}
+	opts = append(opts, handler.WithOverflow(policy, spill))
+	return handler.NewBufferWith(h, opts...), nil
+}
+
+func newSampler(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	h, err := BuildHandler(c.Handler)
+	if err != nil {
+		return nil, err
+	}
+	tick := time.Duration(c.Options.Int("tick_ms", 1000)) * time.Millisecond
+	return handler.NewSampler(h, tick, c.Options.Int("first", 100), c.Options.Int("thereafter", 100), opts...), nil
+}
+
+func newSpool(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	h, err := BuildHandler(c.Handler)
+	if err != nil {
+		return nil, err
+	}
+	sender, ok := h.(handler.Sender)
+	if !ok {
+		return nil, errors.New("spool handler requires a sending handler such as net")
+	}
+	dir := c.Options.String("dir", "")
+	if dir == "" {
+		return nil, errors.New("spool handler requires a dir")
+	}
+	retry := time.Duration(c.Options.Int("retry_ms", 1000)) * time.Millisecond
+	opts = append(opts, handler.WithBufferSize(c.Options.Int("segment_size", 0)))
+	opts = retryOptions(c, opts)
+	opts = append(opts, handler.WithMaxAge(time.Duration(c.Options.Int("max_age_ms", 0))*time.Millisecond))
+	spool, err := handler.NewSpool(sender, dir, retry, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if path := c.Options.String("dead_letter", ""); path != "" {
+		spool.SetDeadLetter(c.Options.Int("max_retries", 3), path)
+	}
+	return spool, nil
+}
+
+func newBreaker(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	h, err := BuildHandler(c.Handler)
+	if err != nil {
+		return nil, err
+	}
+	cooldown := time.Duration(c.Options.Int("cooldown_ms", 30000)) * time.Millisecond
+	return handler.NewBreaker(h, c.Options.Int("threshold", 5), cooldown, nil, opts...), nil
+}
+
+func newTimeout(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	h, err := BuildHandler(c.Handler)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(c.Options.Int("timeout_ms", 1000)) * time.Millisecond
+	return handler.NewTimeout(h, timeout, nil, opts...), nil
+}
+
+func newNet(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	opts = append(opts,
+		handler.WithBufferSize(c.Options.Int("buffer_size", 0)),
+		handler.WithPersistent(c.Options.Bool("persistent", false)),
+		handler.WithKeepAlive(time.Duration(c.Options.Int("keepalive_ms", 0))*time.Millisecond),
+		handler.WithIdleTimeout(time.Duration(c.Options.Int("idle_timeout_ms", 0))*time.Millisecond),
+	)
+	opts = retryOptions(c, opts)
+	if ms := c.Options.Int("write_budget_ms", 0); ms > 0 {
+		var fallback types.IHandler
+		if c.Handler != nil {
+			h, err := BuildHandler(c.Handler)
+			if err != nil {
+				return nil, err
+			}
+			fallback = h
+		}
+		opts = append(opts, handler.WithWriteBudget(time.Duration(ms)*time.Millisecond, fallback))
+	}
+	if addresses := c.Options.Strings("addresses"); len(addresses) > 0 {
+		selection := handler.SelectFailover
+		switch name := c.Options.String("selection", "failover"); name {
+		case "failover":
+		case "round_robin":
+			selection = handler.SelectRoundRobin
+		default:
+			return nil, errors.New("unknown selection " + name)
+		}
+		opts = append(opts, handler.WithEndpoints(selection, addresses...))
+	}
+	opts, err := tlsOptions(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts, err = dialerOptions(c, opts); err != nil {
+		return nil, err
+	}
+	return handler.NewNetWith(c.Options.String("network", "tcp"), c.Options.String("address", ""), opts...), nil
+}
+
+func newMail(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	opts = retryOptions(c, opts)
+	opts, err := tlsOptions(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts, err = dialerOptions(c, opts); err != nil {
+		return nil, err
+	}
+	return handler.NewMailWith(
+		c.Options.String("address", ""),
+		c.Options.String("username", ""),
+		c.Options.String("password", ""),
+		c.Options.String("from", ""),
+		c.Options.String("subject", ""),
+		c.Options.Strings("to"),
+		opts...,
+	), nil
+}
+
+func newStdout(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	return handler.NewStreamWith(os.Stdout, opts...), nil
+}
+
+func newStderr(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	return handler.NewStreamWith(os.Stderr, opts...), nil
+}
+
+func newConsole(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	h := handler.NewConsoleWith(opts...)
+	if name := c.Options.String("stderr_level", ""); name != "" {
+		level, err := llog.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		h.SetStderrLevel(level)
+	}
+	return h, nil
+}
+
+// normalizerOptions applies the date_format, numeric_units, sort_keys, escaping, limits and timezone options shared by the formatters.
+func normalizerOptions(c *FormatterConfig, n interface {
+	SetNumericUnits(bool)
+	SetSortKeys(bool)
+	SetEscapeHTML(bool)
+	SetEscapeLineTerminators(bool)
+	SetEscapeNonASCII(bool)
+	SetLimits(formatter.Limits)
+	SetDateFormat(string)
+	SetLocation(*time.Location)
+}) error {
+	n.SetNumericUnits(c.Options.Bool("numeric_units", false))
+	n.SetSortKeys(c.Options.Bool("sort_keys", false))
+	n.SetEscapeHTML(c.Options.Bool("escape_html", true))
+	n.SetEscapeLineTerminators(c.Options.Bool("escape_line_terminators", true))
+	n.SetEscapeNonASCII(c.Options.Bool("escape_non_ascii", false))
+	n.SetLimits(formatter.Limits{
+		MaxDepth:    c.Options.Int("max_depth", 0),
+		MaxElements: c.Options.Int("max_elements", 0),
+		MaxBytes:    c.Options.Int("max_bytes", 0),
+	})
+	n.SetDateFormat(c.Options.String("date_format", ""))
+	if tz := c.Options.String("timezone", ""); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return err
+		}
+		n.SetLocation(loc)
+	}
+	return nil
+}
+
+func newLine(c *FormatterConfig) (types.Formatter, error) {
+	f := formatter.NewLine(c.Options.String("format", ""), c.Options.String("date_format", ""))
+	if err := normalizerOptions(c, f); err != nil {
+		return nil, err
+	}
+	switch m := c.Options.String("multiline", "raw"); m {
+	case "raw":
+	case "escape":
+		f.SetMultiline(formatter.MultilineEscape)
+	case "indent":
+		f.SetMultiline(formatter.MultilineIndent)
+	case "json":
+		f.SetMultiline(formatter.MultilineJSON)
+	default:
+		return nil, errors.New("unknown multiline mode " + m)
+	}
+	return f, nil
+}
+
+func newJSON(c *FormatterConfig) (types.Formatter, error) {
+	f := formatter.NewJSON(c.Options.Strings("fields"), c.Options.Bool("append_newline", true))
+	if err := normalizerOptions(c, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func newLogfmt(c *FormatterConfig) (types.Formatter, error) {
+	f := formatter.NewLogfmt(c.Options.String("date_format", ""))
+	if err := normalizerOptions(c, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
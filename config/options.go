@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Options the type specific settings of a handler or formatter.
+type Options map[string]interface{}
+
+// String Get a string option.
+func (o Options) String(key, def string) string {
+	v, ok := o[key]
+	if !ok {
+		return def
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Int Get an int option, numbers encoded as strings are accepted.
+func (o Options) Int(key string, def int) int {
+	switch v := o[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		// base 0 accepts octal file permissions such as "0644"
+		if i, err := strconv.ParseInt(v, 0, 64); err == nil {
+			return int(i)
+		}
+	}
+	return def
+}
+
+// Bool Get a bool option.
+func (o Options) Bool(key string, def bool) bool {
+	switch v := o[key].(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// Strings Get a string list option.
+func (o Options) Strings(key string) []string {
+	switch v := o[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	case string:
+		return []string{v}
+	}
+	return nil
+}
+
+// StringMap Get a string map option.
+func (o Options) StringMap(key string) map[string]string {
+	switch v := o[key].(type) {
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		m := make(map[string]string, len(v))
+		for k, item := range v {
+			m[k] = fmt.Sprint(item)
+		}
+		return m
+	}
+	return nil
+}
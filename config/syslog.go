@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package config
+
+import (
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"log/syslog"
+)
+
+func init() {
+	RegisterHandler("syslog", newSyslog)
+}
+
+func newSyslog(c *HandlerConfig, opts []handler.Option) (types.IHandler, error) {
+	priority := syslog.Priority(c.Options.Int("priority", int(syslog.LOG_INFO|syslog.LOG_USER)))
+	return handler.NewSyslogDial(c.Options.String("address", ""), priority, c.Options.String("tag", ""), opts...)
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"github.com/syyongx/llog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads a config file into a registry when the file changes or
+// the process receives SIGHUP. Live loggers keep their identity, only their
+// handler and processor stacks are swapped.
+type Watcher struct {
+	path     string
+	registry *llog.Registry
+	interval time.Duration
+	modTime  time.Time
+	mu       sync.Mutex
+	signals  chan os.Signal
+	done     chan struct{}
+
+	// OnError is called with the errors of background reloads, the
+	// previous configuration stays active.
+	OnError func(err error)
+}
+
+// NewWatcher New watcher
+// interval: how often the file modification time is checked, 0 only reloads on SIGHUP.
+func NewWatcher(path string, registry *llog.Registry, interval time.Duration) *Watcher {
+	return &Watcher{
+		path:     path,
+		registry: registry,
+		interval: interval,
+	}
+}
+
+// Start Loads the config file and starts watching it.
+func (w *Watcher) Start() error {
+	if err := w.Reload(); err != nil {
+		return err
+	}
+	w.signals = make(chan os.Signal, 1)
+	w.done = make(chan struct{})
+	signal.Notify(w.signals, syscall.SIGHUP)
+	go w.watch(w.signals, w.done)
+	return nil
+}
+
+// Stop watching.
+func (w *Watcher) Stop() {
+	if w.done == nil {
+		return
+	}
+	signal.Stop(w.signals)
+	close(w.done)
+	w.done = nil
+}
+
+// Reload Reads the config file and applies it to the registry.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stat, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	// an invalid file is not retried until modified again
+	w.modTime = stat.ModTime()
+	c, err := ParseFile(w.path)
+	if err != nil {
+		return err
+	}
+	return c.Apply(w.registry)
+}
+
+// watch for changes until done is closed.
+func (w *Watcher) watch(signals <-chan os.Signal, done <-chan struct{}) {
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-signals:
+			w.reload()
+		case <-tick:
+			if w.changed() {
+				w.reload()
+			}
+		}
+	}
+}
+
+// changed Checks whether the file was modified since the last reload.
+func (w *Watcher) changed() bool {
+	stat, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !stat.ModTime().Equal(w.modTime)
+}
+
+// reload in the background.
+func (w *Watcher) reload() {
+	if err := w.Reload(); err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
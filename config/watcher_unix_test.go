@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatcherSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "llog.json")
+	mod := time.Now().Add(-time.Hour)
+	write := func(level string) {
+		data := `{"loggers": [{"name": "app", "handlers": [{"type": "file", "level": "` + level + `", "options": {"path": "/dev/null"}}]}]}`
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	level := func(r *llog.Registry) int {
+		l, err := r.GetLogger("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l.GetHandlers()[0].(*handler.File).GetLevel()
+	}
+
+	write("info")
+	r := llog.NewRegistry()
+	w := NewWatcher(path, r, 0)
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// SIGHUP reloads the file even if unchanged
+	write("warning")
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	for deadline := time.Now().Add(2 * time.Second); level(r) != types.WARNING; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected level %d, got %d", types.WARNING, level(r))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
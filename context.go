@@ -0,0 +1,22 @@
+package llog
+
+import (
+	"context"
+)
+
+type loggerKey struct{}
+
+// NewContext Returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext Gets the logger carried by ctx, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return Default()
+}
@@ -0,0 +1,59 @@
+package llog
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	crashMu   sync.RWMutex
+	crashRing *handler.Ring
+	crashDir  string
+)
+
+// SetCrashDump Writes a crash file to dir on the panics recovered by
+// RecoverAndLog, RecoverLogAndRepanic and Go, holding the recent records kept
+// by ring followed by the panic and its stack. The ring is typically pushed
+// on the loggers of the program. A nil ring disables the crash files.
+func SetCrashDump(ring *handler.Ring, dir string) {
+	crashMu.Lock()
+	crashRing = ring
+	crashDir = dir
+	crashMu.Unlock()
+}
+
+// WriteCrashDump Writes a crash file of the panic p and its stack, returning
+// its path, such as "dir/crash-20200101T120000.000000000.log".
+// Nothing is written if SetCrashDump was not called.
+func WriteCrashDump(p interface{}, stack []byte) (string, error) {
+	crashMu.RLock()
+	ring, dir := crashRing, crashDir
+	crashMu.RUnlock()
+	if ring == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	f := ring.GetFormatter()
+	for _, record := range ring.Snapshot() {
+		record.Formatted.Reset()
+		if err := f.Format(record); err == nil {
+			buf.Write(record.Formatted.Bytes())
+		}
+		types.ReleaseRecord(record)
+	}
+	fmt.Fprintf(&buf, "\npanic: %v\n\n%s", p, stack)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "crash-"+time.Now().UTC().Format("20060102T150405.000000000")+".log")
+	return path, ioutil.WriteFile(path, buf.Bytes(), 0600)
+}
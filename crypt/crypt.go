@@ -0,0 +1,137 @@
+// Package crypt encrypts log files at rest with AES-GCM.
+//
+// Each write is sealed in its own frame: its length, a random nonce and the
+// sealed bytes. Frames are self-contained, so files can be appended to across
+// restarts and read back frame by frame:
+//
+//	file := handler.NewFileWith(path, handler.WithWrapper(crypt.Wrapper(crypt.KeyFromEnv("LLOG_KEY"))))
+//	r := crypt.NewReader(f, key)
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// maxFrameSize the largest frame read, guarding against corrupt lengths.
+const maxFrameSize = 64 << 20
+
+// KeyFunc Gets the AES key, 16, 24 or 32 bytes, such as from a KMS.
+type KeyFunc func() ([]byte, error)
+
+// KeyFromEnv Gets the key from the environment variable, encoded in hex or base64.
+func KeyFromEnv(name string) KeyFunc {
+	return func() ([]byte, error) {
+		value := os.Getenv(name)
+		if value == "" {
+			return nil, errors.New("encryption key " + name + " is not set")
+		}
+		if key, err := hex.DecodeString(value); err == nil {
+			return key, nil
+		}
+		return base64.StdEncoding.DecodeString(value)
+	}
+}
+
+// Writer Encrypts each write in a frame.
+type Writer struct {
+	w    io.Writer
+	aead cipher.AEAD
+}
+
+// NewWriter New encrypting writer.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead}, nil
+}
+
+// Wrapper Gets a wrapper encrypting the file writers of handlers, see handler.WithWrapper.
+// The key is got each time a file is opened.
+func Wrapper(key KeyFunc) func(io.Writer) (io.Writer, error) {
+	return func(w io.Writer) (io.Writer, error) {
+		k, err := key()
+		if err != nil {
+			return nil, err
+		}
+		return NewWriter(w, k)
+	}
+}
+
+// Write Writes p sealed in a frame, at once.
+func (w *Writer) Write(p []byte) (int, error) {
+	nonceSize := w.aead.NonceSize()
+	frame := make([]byte, 4+nonceSize, 4+nonceSize+len(p)+w.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, frame[4:]); err != nil {
+		return 0, err
+	}
+	frame = w.aead.Seal(frame, frame[4:], p, nil)
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	if _, err := w.w.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Reader Decrypts the frames written by Writer.
+type Reader struct {
+	r    io.Reader
+	aead cipher.AEAD
+	buf  []byte
+}
+
+// NewReader New decrypting reader.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, aead: aead}, nil
+}
+
+// Read Reads the decrypted bytes, failing on tampered or truncated frames.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		var size [4]byte
+		if _, err := io.ReadFull(r.r, size[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return 0, errors.New("truncated encrypted frame")
+			}
+			return 0, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n < uint32(r.aead.NonceSize()) || n > maxFrameSize {
+			return 0, errors.New("invalid encrypted frame")
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r.r, frame); err != nil {
+			return 0, errors.New("truncated encrypted frame")
+		}
+		nonce, sealed := frame[:r.aead.NonceSize()], frame[r.aead.NonceSize():]
+		plain, err := r.aead.Open(sealed[:0], nonce, sealed, nil)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = plain
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,53 @@
+package crypt
+
+import (
+	"bytes"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-crypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("LLOG_TEST_KEY", "000102030405060708090a0b0c0d0e0f")
+	defer os.Unsetenv("LLOG_TEST_KEY")
+
+	path := filepath.Join(dir, "app.log")
+	for _, message := range []string{"first", "second"} {
+		file := handler.NewFileWith(path,
+			handler.WithFormatter(formatter.NewLine("%Message%\n", "")),
+			handler.WithWrapper(Wrapper(KeyFromEnv("LLOG_TEST_KEY"))))
+		logger := llog.NewLogger("app")
+		logger.PushHandler(file)
+		logger.Info(message)
+		logger.Close()
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if bytes.Contains(data, []byte("first")) {
+		t.Fatal("file is not encrypted")
+	}
+	key, _ := KeyFromEnv("LLOG_TEST_KEY")()
+	r, err := NewReader(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadAll(r)
+	if err != nil || string(plain) != "first\nsecond\n" {
+		t.Errorf("unexpected plain text %q: %v", plain, err)
+	}
+
+	data[len(data)-1] ^= 1
+	r, _ = NewReader(bytes.NewReader(data), key)
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Error("expected an authentication error")
+	}
+}
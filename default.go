@@ -0,0 +1,111 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger *Logger
+
+	defaultRegistry = NewRegistry()
+)
+
+// Default Gets the global default logger.
+// Unless replaced by SetDefault it is created by FromEnv on first use,
+// falling back to info level text records on stderr if the environment is invalid.
+func Default() *Logger {
+	defaultMu.RLock()
+	l := defaultLogger
+	defaultMu.RUnlock()
+	if l != nil {
+		return l
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultLogger == nil {
+		l, err := FromEnv()
+		if err != nil {
+			l = NewLogger(filepath.Base(os.Args[0]))
+			l.PushHandler(handler.NewStream(os.Stderr, types.INFO, true))
+		}
+		defaultLogger = l
+	}
+	return defaultLogger
+}
+
+// SetDefault Replaces the global default logger.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defaultLogger = l
+	defaultMu.Unlock()
+}
+
+// Log Logs with an arbitrary level to the default logger.
+func Log(level int, message string) {
+	Default().Log(level, message)
+}
+
+// Debug Logs detailed debug information to the default logger.
+func Debug(message interface{}) {
+	Default().Debug(message)
+}
+
+// Info Logs interesting events to the default logger.
+func Info(message interface{}) {
+	Default().Info(message)
+}
+
+// Notice Logs normal but significant events to the default logger.
+func Notice(message interface{}) {
+	Default().Notice(message)
+}
+
+// Warning Logs exceptional occurrences that are not errors to the default logger.
+func Warning(message interface{}) {
+	Default().Warning(message)
+}
+
+// Error Logs runtime errors to the default logger.
+func Error(message interface{}) {
+	Default().Error(message)
+}
+
+// Critical Logs critical conditions to the default logger.
+func Critical(message interface{}) {
+	Default().Critical(message)
+}
+
+// Alert Logs at the ALERT level to the default logger.
+func Alert(message interface{}) {
+	Default().Alert(message)
+}
+
+// Emergency Logs that the system is unusable to the default logger.
+func Emergency(message interface{}) {
+	Default().Emergency(message)
+}
+
+// WithError Creates a child of the default logger adding err to every record.
+func WithError(err error) *Logger {
+	return Default().WithError(err)
+}
+
+// DefaultRegistry Gets the global registry used by GetLogger.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// GetLogger Gets a logger from the global registry by a dot separated name,
+// falling back to the nearest registered ancestor and then to the default logger.
+func GetLogger(name string) *Logger {
+	if l, err := defaultRegistry.Lookup(name); err == nil {
+		return l
+	}
+	return Default().Child(name)
+}
@@ -0,0 +1,61 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/types"
+	"os"
+	"os/signal"
+	"runtime"
+)
+
+// DumpOnSignal Logs a dump of all the goroutines and the runtime stats to l
+// at NOTICE on each of the signals, SIGQUIT and SIGUSR2 by default where
+// available, to diagnose hung processes. Catching SIGQUIT replaces the
+// default crash of the program. stop ends the listening.
+func DumpOnSignal(l *Logger, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = dumpSignals
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case sig := <-c:
+				LogGoroutines(l, "goroutine dump on "+sig.String())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// LogGoroutines Logs a dump of all the goroutines and the runtime stats to l at NOTICE.
+func LogGoroutines(l *Logger, message string) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	l.AddRecordFields(nil, types.NOTICE, message, types.RecordContext{
+		"goroutines": runtime.NumGoroutine(),
+		"heap_alloc": types.Size(mem.HeapAlloc),
+		"heap_sys":   types.Size(mem.HeapSys),
+		"num_gc":     mem.NumGC,
+		"go_version": runtime.Version(),
+		"stack":      string(allStacks()),
+	})
+}
+
+// allStacks the stacks of all the goroutines.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package llog
+
+import (
+	"os"
+)
+
+// no dump signals by default, they must be given.
+var dumpSignals []os.Signal
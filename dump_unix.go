@@ -0,0 +1,11 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package llog
+
+import (
+	"os"
+	"syscall"
+)
+
+var dumpSignals = []os.Signal{syscall.SIGQUIT, syscall.SIGUSR2}
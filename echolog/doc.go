@@ -0,0 +1,12 @@
+// Package echolog provides an Echo middleware logging requests through llog.
+//
+// It is built with the llog_echo tag, as it requires the github.com/labstack/echo/v4 module:
+//
+//	go build -tags llog_echo
+//
+//	e := echo.New()
+//	echolog.Use(e, logger)
+//	e.Use(echolog.Middleware(logger))
+//
+// Handlers get the request-scoped logger by llog.FromContext(c.Request().Context()).
+package echolog
@@ -0,0 +1,76 @@
+//go:build llog_echo
+// +build llog_echo
+
+package echolog
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/httplog"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"time"
+)
+
+// Use Redirects the logger of e to llog, honoring the level of logger. The
+// lines of Echo are logged at their level, INFO for those written by Print.
+func Use(e *echo.Echo, logger *llog.Logger) {
+	e.Logger.SetOutput(writer{logger})
+	e.Logger.SetHeader("${level} ${short_file}:${line}")
+	switch level := logger.GetLevel(); {
+	case level >= types.ERROR:
+		e.Logger.SetLevel(log.ERROR)
+	case level >= types.WARNING:
+		e.Logger.SetLevel(log.WARN)
+	case level >= types.INFO:
+		e.Logger.SetLevel(log.INFO)
+	default:
+		e.Logger.SetLevel(log.DEBUG)
+	}
+}
+
+// Middleware Logs finished requests at INFO, WARNING for 4xx and ERROR for 5xx
+// status codes, it replaces middleware.Logger.
+func Middleware(logger *llog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			scoped := logger.With(types.RecordContext{
+				"method":    req.Method,
+				"path":      req.URL.Path,
+				"client_ip": c.RealIP(),
+			})
+			ctx := llog.NewContext(req.Context(), scoped)
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response so its status is logged.
+				c.Error(err)
+			}
+
+			res := c.Response()
+			status := res.Status
+			if err != nil && !res.Committed {
+				// The error handler didn't write the response, log the status of the error.
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			fields := types.RecordContext{
+				"status":      status,
+				"route":       c.Path(),
+				"bytes":       res.Size,
+				"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				fields["error"] = err.Error()
+			}
+			scoped.AddRecordFields(ctx, httplog.StatusLevel(status), "request finished", fields)
+			return nil
+		}
+	}
+}
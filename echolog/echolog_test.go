@@ -0,0 +1,79 @@
+//go:build llog_echo
+// +build llog_echo
+
+package echolog
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/llogtest"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	h := llogtest.NewHandler()
+	logger := llog.NewLogger("echo")
+	logger.PushHandler(h)
+	logger.SetLevel(types.WARNING)
+	e := echo.New()
+	Use(e, logger)
+
+	e.Logger.Info("hidden")
+	e.Logger.Warn("slow")
+	e.Logger.Error("boom")
+	llogtest.AssertNotLogged(t, h, types.INFO, "hidden")
+	llogtest.AssertLogged(t, h, types.WARNING, "slow")
+	llogtest.AssertLogged(t, h, types.ERROR, "boom")
+}
+
+func TestMiddleware(t *testing.T) {
+	h := llogtest.NewHandler()
+	logger := llog.NewLogger("echo")
+	logger.PushHandler(h)
+	e := echo.New()
+	e.Use(Middleware(logger))
+	e.GET("/ok", func(c echo.Context) error {
+		if llog.FromContext(c.Request().Context()).GetFields()["path"] != "/ok" {
+			t.Error("expected the request-scoped logger in the context")
+		}
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such item")
+	})
+	e.GET("/boom", func(c echo.Context) error {
+		return errors.New("boom")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		level  int
+	}{
+		{"/ok", http.StatusOK, types.INFO},
+		{"/missing", http.StatusNotFound, types.WARNING},
+		{"/boom", http.StatusInternalServerError, types.ERROR},
+	}
+	for _, tt := range tests {
+		h.Reset()
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.status, w.Code)
+		}
+		entries := h.Entries()
+		if len(entries) != 1 {
+			t.Fatalf("%s: expected 1 record, got %d", tt.path, len(entries))
+		}
+		if entries[0].Level != tt.level || entries[0].Context["status"] != tt.status || entries[0].Context["route"] != tt.path {
+			t.Errorf("%s: unexpected record %+v", tt.path, entries[0])
+		}
+		if tt.status != http.StatusOK && entries[0].Context["error"] == nil {
+			t.Errorf("%s: expected the error in the record", tt.path)
+		}
+	}
+}
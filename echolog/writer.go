@@ -0,0 +1,40 @@
+package echolog
+
+import (
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/types"
+	"strings"
+)
+
+// echoLevels the levels of the lines written by the Echo logger, "-" being
+// the level of the lines written by Print.
+var echoLevels = map[string]int{
+	"-":     types.INFO,
+	"DEBUG": types.DEBUG,
+	"INFO":  types.INFO,
+	"WARN":  types.WARNING,
+	"ERROR": types.ERROR,
+	"PANIC": types.CRITICAL,
+	"FATAL": types.ALERT,
+}
+
+// writer logs the lines written by the Echo logger at their level.
+type writer struct {
+	logger *llog.Logger
+}
+
+// Write Logs each line of p, stripped of its level.
+func (w writer) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\r\n"), "\n") {
+		level := types.INFO
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			if l, ok := echoLevels[line[:i]]; ok {
+				level, line = l, line[i+1:]
+			}
+		}
+		if line != "" {
+			w.logger.AddRecord(level, line)
+		}
+	}
+	return len(p), nil
+}
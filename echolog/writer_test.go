@@ -0,0 +1,39 @@
+package echolog
+
+import (
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/llogtest"
+	"github.com/syyongx/llog/types"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	h := llogtest.NewHandler()
+	logger := llog.NewLogger("echo")
+	logger.PushHandler(h)
+	w := writer{logger}
+
+	w.Write([]byte("ERROR echo.go:12 boom\nWARN echo.go:13 slow\n"))
+	w.Write([]byte("DEBUG router.go:5 route added\n"))
+	w.Write([]byte("- main.go:20 printed\n"))
+	w.Write([]byte("no header\n"))
+	tests := []struct {
+		level   int
+		message string
+	}{
+		{types.ERROR, "echo.go:12 boom"},
+		{types.WARNING, "echo.go:13 slow"},
+		{types.DEBUG, "router.go:5 route added"},
+		{types.INFO, "main.go:20 printed"},
+		{types.INFO, "no header"},
+	}
+	entries := h.Entries()
+	if len(entries) != len(tests) {
+		t.Fatalf("expected %d records, got %d", len(tests), len(entries))
+	}
+	for i, tt := range tests {
+		if entries[i].Level != tt.level || entries[i].Message != tt.message {
+			t.Errorf("expected %d %q, got %d %q", tt.level, tt.message, entries[i].Level, entries[i].Message)
+		}
+	}
+}
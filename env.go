@@ -0,0 +1,61 @@
+package llog
+
+import (
+	"errors"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// environment variables read by FromEnv
+const (
+	EnvLevel  = "LLOG_LEVEL"
+	EnvFormat = "LLOG_FORMAT"
+	EnvOutput = "LLOG_OUTPUT"
+)
+
+// FromEnv Creates a logger named after the program, configured by the environment:
+//
+//	LLOG_LEVEL   minimum level name, defaults to "info"
+//	LLOG_FORMAT  json, text or logfmt, defaults to "text"
+//	LLOG_OUTPUT  stdout, stderr or a file path, defaults to "stderr"
+func FromEnv() (*Logger, error) {
+	level := types.INFO
+	if v := os.Getenv(EnvLevel); v != "" {
+		l, err := ParseLevel(v)
+		if err != nil {
+			return nil, errors.New("invalid " + EnvLevel + ": " + v)
+		}
+		level = l
+	}
+
+	var f types.Formatter
+	switch v := strings.ToLower(os.Getenv(EnvFormat)); v {
+	case "", "text":
+		f = formatter.NewLine(formatter.DefaultFormat, "")
+	case "json":
+		f = formatter.NewJSON(nil, true)
+	case "logfmt":
+		f = formatter.NewLogfmt("")
+	default:
+		return nil, errors.New("invalid " + EnvFormat + ": " + v)
+	}
+
+	opts := []handler.Option{handler.WithLevel(level), handler.WithFormatter(f)}
+	var h types.IHandler
+	switch v := os.Getenv(EnvOutput); v {
+	case "", "stderr":
+		h = handler.NewStreamWith(os.Stderr, opts...)
+	case "stdout":
+		h = handler.NewStreamWith(os.Stdout, opts...)
+	default:
+		h = handler.NewFileWith(v, opts...)
+	}
+
+	logger := NewLogger(filepath.Base(os.Args[0]))
+	logger.PushHandler(h)
+	return logger, nil
+}
@@ -0,0 +1,59 @@
+package formatter
+
+import (
+	"bytes"
+	"github.com/syyongx/llog/types"
+)
+
+// DefaultContentType the media type of the formatters not telling theirs.
+const DefaultContentType = "text/plain; charset=utf-8"
+
+// BulkAction the action line written before each record by FramingBulk.
+var BulkAction = []byte(`{"index":{}}`)
+
+// ContentType Gets the media type of the batches of a formatter.
+func ContentType(f types.Formatter) string {
+	if ct, ok := f.(types.ContentTyper); ok {
+		return ct.ContentType()
+	}
+	return DefaultContentType
+}
+
+// FramingOf Gets the framing of the batches of a formatter, lines by default.
+func FramingOf(f types.Formatter) types.Framing {
+	if fr, ok := f.(types.Framer); ok {
+		return fr.Framing()
+	}
+	return types.FramingLines
+}
+
+// Frame Joins records formatted by f into a batch as framed by f, so batch
+// sinks can send the body with the content type whatever the formatter.
+func Frame(f types.Formatter, records []*types.Record) (body []byte, contentType string) {
+	framing := FramingOf(f)
+	var buf bytes.Buffer
+	if framing == types.FramingArray {
+		buf.WriteByte('[')
+	}
+	for i, record := range records {
+		b := bytes.TrimRight(record.Formatted.Bytes(), "\r\n")
+		switch framing {
+		case types.FramingArray:
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(b)
+		case types.FramingBulk:
+			buf.Write(BulkAction)
+			buf.WriteByte('\n')
+			fallthrough
+		default:
+			buf.Write(b)
+			buf.WriteByte('\n')
+		}
+	}
+	if framing == types.FramingArray {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), ContentType(f)
+}
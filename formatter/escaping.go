@@ -0,0 +1,77 @@
+package formatter
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SetEscapeHTML Whether <, > and & are escaped in the JSON output so it can be
+// embedded in HTML, as by json.Encoder.SetEscapeHTML. Defaults to true.
+func (n *Normalizer) SetEscapeHTML(escape bool) {
+	n.noEscapeHTML = !escape
+}
+
+// SetEscapeLineTerminators Whether the U+2028 and U+2029 line terminators are
+// escaped in the JSON output, as JavaScript before ES2019 doesn't allow them
+// in strings. Defaults to true.
+func (n *Normalizer) SetEscapeLineTerminators(escape bool) {
+	n.rawLineTerminators = !escape
+}
+
+// SetEscapeNonASCII Whether the non-ASCII characters are escaped as \uXXXX in
+// the JSON output, for sinks that only accept ASCII. Defaults to false.
+func (n *Normalizer) SetEscapeNonASCII(escape bool) {
+	n.escapeNonASCII = escape
+}
+
+// escape applies the escaping options to JSON encoded with the default ones,
+// returning b unchanged if they are the default.
+func (n *Normalizer) escape(b []byte) []byte {
+	if !n.rawLineTerminators && !n.escapeNonASCII {
+		return b
+	}
+	var out bytes.Buffer
+	out.Grow(len(b))
+	for i := 0; i < len(b); {
+		c := b[i]
+		if c == '\\' && i+1 < len(b) {
+			if n.rawLineTerminators && i+6 <= len(b) && b[i+1] == 'u' &&
+				(string(b[i+2:i+6]) == "2028" || string(b[i+2:i+6]) == "2029") {
+				r, _ := strconv.ParseUint(string(b[i+2:i+6]), 16, 32)
+				out.WriteRune(rune(r))
+				i += 6
+				continue
+			}
+			// keep escape sequences whole, so an escaped backslash isn't taken for one
+			out.Write(b[i : i+2])
+			i += 2
+			continue
+		}
+		if c < utf8.RuneSelf || !n.escapeNonASCII {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(b[i:])
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			writeRuneEscape(&out, r1)
+			writeRuneEscape(&out, r2)
+		} else {
+			writeRuneEscape(&out, r)
+		}
+		i += size
+	}
+	return out.Bytes()
+}
+
+// writeRuneEscape writes r as a \uXXXX escape.
+func writeRuneEscape(buf *bytes.Buffer, r rune) {
+	const hex = "0123456789abcdef"
+	buf.WriteString(`\u`)
+	buf.WriteByte(hex[r>>12&0xf])
+	buf.WriteByte(hex[r>>8&0xf])
+	buf.WriteByte(hex[r>>4&0xf])
+	buf.WriteByte(hex[r&0xf])
+}
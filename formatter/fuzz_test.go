@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+package formatter
+
+import (
+	"encoding/json"
+	"github.com/syyongx/llog/types"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fuzzRecord builds a record of adversarial message and context values,
+// including a cyclic map.
+func fuzzRecord(message, key, value string, f float64) *types.Record {
+	record := types.NewRecord()
+	record.Level = types.INFO
+	record.LevelName = "info"
+	record.Channel = "fuzz"
+	record.Datetime = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	record.Message = message
+	cyclic := map[string]interface{}{key: value}
+	cyclic["self"] = cyclic
+	record.Context = types.RecordContext{
+		key:      value,
+		"float":  f,
+		"list":   []interface{}{value, f, math.Inf(-1)},
+		"cyclic": cyclic,
+		"chan":   make(chan int),
+	}
+	record.Extra = types.RecordExtra{"nan": math.NaN()}
+	return record
+}
+
+func FuzzFormatters(f *testing.F) {
+	f.Add("hello", "k", "v", 1.5)
+	f.Add("\xff\xfe invalid", "\x00", "line\nbreak", math.NaN())
+	f.Add(strings.Repeat("x", 1<<16), "=", "\"quoted\"", math.Inf(1))
+	f.Add("<script>", "a b", "\x1b[31m", -0.0)
+	f.Fuzz(func(t *testing.T, message, key, value string, num float64) {
+		j := NewJSON(nil, false)
+		record := fuzzRecord(message, key, value, num)
+		if err := j.Format(record); err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]string
+		if err := json.Unmarshal(record.Formatted.Bytes(), &out); err != nil {
+			t.Fatalf("invalid JSON %q: %v", record.Formatted.String(), err)
+		}
+		for _, field := range []string{"Context", "Extra"} {
+			if !json.Valid([]byte(out[field])) {
+				t.Fatalf("invalid JSON %s %q", field, out[field])
+			}
+		}
+
+		l := NewLogfmt("")
+		record = fuzzRecord(message, key, value, num)
+		if err := l.Format(record); err != nil {
+			t.Fatal(err)
+		}
+		if line := record.Formatted.String(); strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+			t.Fatalf("logfmt record spans several lines %q", line)
+		}
+
+		record = fuzzRecord(message, key, value, num)
+		if err := NewLine("", "").Format(record); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -2,9 +2,11 @@ package formatter
 
 import (
 	"github.com/syyongx/llog/types"
+	"strconv"
 )
 
-// DefaultFields for a log record
+// DefaultFields for a log record.
+// "UnixNano" and "Seq" can be added to totally order records.
 var DefaultFields = []string{
 	"Datetime",
 	"Channel",
@@ -20,6 +22,7 @@ type JSON struct {
 
 	fileds        []string
 	appendNewline bool
+	framing       types.Framing
 }
 
 // NewJSON appendNewline: Is append new line.
@@ -39,28 +42,58 @@ func (j *JSON) IsAppendNewLine() bool {
 	return j.appendNewline
 }
 
+// SetFraming Set how records are framed into batches, defaults to NDJSON lines.
+func (j *JSON) SetFraming(framing types.Framing) {
+	j.framing = framing
+}
+
+// Framing Get how records are framed into batches.
+func (j *JSON) Framing() types.Framing {
+	return j.framing
+}
+
+// ContentType Get the media type of the batches.
+func (j *JSON) ContentType() string {
+	if j.framing == types.FramingArray {
+		return "application/json"
+	}
+	return "application/x-ndjson"
+}
+
 // Format a record
+// The event of the records logged by Logger.Event is written under "Event",
+// apart from the context.
 func (j *JSON) Format(record *types.Record) error {
-	output := make(map[string]string, len(j.fileds))
+	event, ctx := splitEvent(record)
+	output := make(map[string]string, len(j.fileds)+1)
 	for _, field := range j.fileds {
 		switch field {
 		case "Datetime":
 			output[field] = j.normalizeTime(record.Datetime)
+		case "UnixNano":
+			output[field] = strconv.FormatInt(record.Datetime.UnixNano(), 10)
+		case "Seq":
+			output[field] = strconv.FormatUint(record.Seq, 10)
 		case "Channel":
 			output[field] = record.Channel
 		case "LevelName":
 			output[field] = record.LevelName
 		case "Message":
 			output[field] = record.Message
+		case "Template":
+			output[field] = record.Template
 		case "Context":
-			output[field] = j.normalizeContext(record.Context)
+			output[field] = j.normalizeContext(ctx)
 		case "Extra":
 			output[field] = j.normalizeExtra(record.Extra)
 		default:
 			output[field] = "unknow"
 		}
 	}
-	record.Formatted.Write(j.JSON(output))
+	if event != nil {
+		output["Event"] = string(j.JSON(j.normalizeEvent(event)))
+	}
+	j.writeJSON(record.Formatted, output)
 	if j.appendNewline {
 		record.Formatted.WriteRune('\n')
 	}
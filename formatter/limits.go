@@ -0,0 +1,129 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// TruncatedMarker marks the values cut by the Limits: it ends the cut strings
+// and slices, replaces the values nested too deep, and is the key of the
+// number of entries dropped from a map.
+const TruncatedMarker = "[truncated]"
+
+// Limits bounds the context and extra fields written by the formatters, so one
+// gigantic value can't produce a multi-megabyte record. Zero values are unlimited.
+type Limits struct {
+	// MaxDepth the levels of nested maps, slices and structs kept in a field.
+	MaxDepth int
+	// MaxElements the elements kept in each map or slice.
+	MaxElements int
+	// MaxBytes the bytes kept in each string, and in the JSON of each field.
+	MaxBytes int
+}
+
+// SetLimits Set the bounds of the context and extra fields.
+// Structs and typed maps and slices are converted to generic ones through
+// their JSON to be bounded.
+func (n *Normalizer) SetLimits(limits Limits) {
+	n.limits = limits
+}
+
+// Limits Get the bounds of the context and extra fields.
+func (n *Normalizer) Limits() Limits {
+	return n.limits
+}
+
+// truncate cuts s to MaxBytes on a rune boundary, reporting whether it was cut.
+func (n *Normalizer) truncate(s string) (string, bool) {
+	max := n.limits.MaxBytes
+	if max <= 0 || len(s) <= max {
+		return s, false
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + TruncatedMarker, true
+}
+
+// truncateJSON cuts a field whose JSON is over MaxBytes into a string of its cut JSON.
+func (n *Normalizer) truncateJSON(v interface{}) (interface{}, bool) {
+	if n.limits.MaxBytes <= 0 {
+		return v, false
+	}
+	if _, ok := v.(string); ok {
+		return v, false
+	}
+	b, err := json.Marshal(v)
+	if err != nil || len(b) <= n.limits.MaxBytes {
+		return v, false
+	}
+	return n.truncate(string(b))
+}
+
+// tooDeep Whether a container at depth is over MaxDepth.
+func (n *Normalizer) tooDeep(depth int) bool {
+	return n.limits.MaxDepth > 0 && depth >= n.limits.MaxDepth
+}
+
+// capMap copies the first MaxElements entries of m by key, with the number of
+// dropped entries under TruncatedMarker, nil if m is within the limit.
+func (n *Normalizer) capMap(m map[string]interface{}) map[string]interface{} {
+	max := n.limits.MaxElements
+	if max <= 0 || len(m) <= max {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(map[string]interface{}, max+1)
+	for _, k := range keys[:max] {
+		out[k] = m[k]
+	}
+	out[TruncatedMarker] = len(m) - max
+	return out
+}
+
+// capSlice copies the first MaxElements elements of s followed by
+// TruncatedMarker, nil if s is within the limit.
+func (n *Normalizer) capSlice(s []interface{}) []interface{} {
+	max := n.limits.MaxElements
+	if max <= 0 || len(s) <= max {
+		return nil
+	}
+	out := make([]interface{}, max, max+1)
+	copy(out, s)
+	return append(out, TruncatedMarker)
+}
+
+// generic converts the structs, typed maps, slices and arrays into generic
+// maps and slices through their JSON, so they can be bounded.
+func (n *Normalizer) generic(v interface{}) (interface{}, bool) {
+	if n.limits == (Limits{}) {
+		return v, false
+	}
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return v, false
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v, false
+	}
+	var out interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&out); err != nil {
+		return v, false
+	}
+	return out, true
+}
@@ -1,13 +1,18 @@
 package formatter
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/syyongx/llog/types"
 	"strconv"
 	"strings"
 )
 
-// DefaultFormat for a record
+// DefaultFormat for a record.
+// %UnixNano% and %Seq% are replaced by the nanosecond timestamp and sequence number,
+// %Template% by the format of the records logged by the printf-style methods,
+// %Event% by the event of the records logged by Logger.Event as JSON. Without
+// %Event%, the event is written in the context under types.EventKey.
 var DefaultFormat = "[%Datetime%] %Channel%.%LevelName%: %Message% %Context% %Extra%\n"
 
 // Line struct definition
@@ -16,7 +21,61 @@ var DefaultFormat = "[%Datetime%] %Channel%.%LevelName%: %Message% %Context% %Ex
 type Line struct {
 	Normalizer
 
-	format string
+	format    string
+	segments  []lineSegment
+	multiline Multiline
+	colors    bool
+	event     bool // whether the format has %Event%
+}
+
+// Multiline how multi-line messages, such as stack traces, are written.
+type Multiline uint8
+
+// available Multiline values
+const (
+	// MultilineRaw writes the lines as they are.
+	MultilineRaw Multiline = iota
+	// MultilineEscape escapes the line breaks to \n, keeping one record per line.
+	MultilineEscape
+	// MultilineIndent indents the continuation lines with a tab, so tailing
+	// tools can fold them into the record.
+	MultilineIndent
+	// MultilineJSON writes the message as a JSON string.
+	MultilineJSON
+)
+
+// placeholders of the line format
+const (
+	tokenLiteral = iota
+	tokenDatetime
+	tokenUnixNano
+	tokenSeq
+	tokenChannel
+	tokenLevelName
+	tokenMessage
+	tokenTemplate
+	tokenContext
+	tokenExtra
+	tokenEvent
+)
+
+var lineTokens = map[string]int{
+	"%Datetime%":  tokenDatetime,
+	"%UnixNano%":  tokenUnixNano,
+	"%Seq%":       tokenSeq,
+	"%Channel%":   tokenChannel,
+	"%LevelName%": tokenLevelName,
+	"%Message%":   tokenMessage,
+	"%Template%":  tokenTemplate,
+	"%Context%":   tokenContext,
+	"%Extra%":     tokenExtra,
+	"%Event%":     tokenEvent,
+}
+
+// lineSegment a literal or a placeholder of the line format.
+type lineSegment struct {
+	token   int
+	literal string
 }
 
 // NewLine new line
@@ -25,25 +84,138 @@ func NewLine(format, dateFormat string) *Line {
 		format = DefaultFormat
 	}
 	l := &Line{
-		format: format,
+		format:   format,
+		segments: parseLine(format),
+	}
+	for _, seg := range l.segments {
+		l.event = l.event || seg.token == tokenEvent
 	}
 	l.SetDateFormat(dateFormat)
 	return l
 }
 
+// SetMultiline Set how multi-line messages are written, defaults to MultilineRaw.
+func (l *Line) SetMultiline(multiline Multiline) {
+	l.multiline = multiline
+}
+
+// SetColors Whether level names are colored with ANSI escape codes, for terminals.
+func (l *Line) SetColors(colors bool) {
+	l.colors = colors
+}
+
+// levelColor the ANSI color code of a level.
+func levelColor(level int) string {
+	switch {
+	case level >= types.CRITICAL:
+		return "\x1b[35m"
+	case level >= types.ERROR:
+		return "\x1b[31m"
+	case level >= types.WARNING:
+		return "\x1b[33m"
+	case level >= types.NOTICE:
+		return "\x1b[36m"
+	case level >= types.INFO:
+		return "\x1b[34m"
+	}
+	return "\x1b[90m"
+}
+
+// writeMessage writes the message according to the multiline setting.
+func (l *Line) writeMessage(buf *bytes.Buffer, message string) {
+	switch l.multiline {
+	case MultilineJSON:
+		l.writeJSON(buf, message)
+		return
+	case MultilineEscape, MultilineIndent:
+		if strings.ContainsAny(message, "\r\n") {
+			if l.multiline == MultilineEscape {
+				message = escapeReplacer.Replace(message)
+			} else {
+				message = indentReplacer.Replace(strings.TrimRight(message, "\r\n"))
+			}
+		}
+	}
+	buf.WriteString(message)
+}
+
+var (
+	escapeReplacer = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n")
+	indentReplacer = strings.NewReplacer("\r\n", "\n\t", "\n", "\n\t")
+)
+
+// parseLine splits the format into literals and placeholders once,
+// so records are written straight into their buffer.
+func parseLine(format string) []lineSegment {
+	var segments []lineSegment
+	literal := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		end := strings.IndexByte(format[i+1:], '%')
+		if end < 0 {
+			break
+		}
+		token, ok := lineTokens[format[i:i+end+2]]
+		if !ok {
+			continue
+		}
+		if literal < i {
+			segments = append(segments, lineSegment{token: tokenLiteral, literal: format[literal:i]})
+		}
+		segments = append(segments, lineSegment{token: token})
+		i += end + 1
+		literal = i + 1
+	}
+	if literal < len(format) {
+		segments = append(segments, lineSegment{token: tokenLiteral, literal: format[literal:]})
+	}
+	return segments
+}
+
 // Format a log record
 func (l *Line) Format(record *types.Record) error {
-	oldnew := []string{
-		"%Datetime%", l.normalizeTime(record.Datetime),
-		"%Channel%", record.Channel,
-		"%LevelName%", record.LevelName,
-		"%Message%", record.Message,
-		"%Context%", l.normalizeContext(record.Context),
-		"%Extra%", l.normalizeExtra(record.Extra),
+	buf := record.Formatted
+	event, ctx := splitEvent(record)
+	if event != nil && !l.event {
+		ctx[types.EventKey] = l.normalizeEvent(event)
+	}
+	for _, seg := range l.segments {
+		switch seg.token {
+		case tokenLiteral:
+			buf.WriteString(seg.literal)
+		case tokenDatetime:
+			buf.WriteString(l.normalizeTime(record.Datetime))
+		case tokenUnixNano:
+			buf.WriteString(strconv.FormatInt(record.Datetime.UnixNano(), 10))
+		case tokenSeq:
+			buf.WriteString(strconv.FormatUint(record.Seq, 10))
+		case tokenChannel:
+			buf.WriteString(record.Channel)
+		case tokenLevelName:
+			if l.colors {
+				buf.WriteString(levelColor(record.Level))
+				buf.WriteString(record.LevelName)
+				buf.WriteString("\x1b[0m")
+			} else {
+				buf.WriteString(record.LevelName)
+			}
+		case tokenMessage:
+			l.writeMessage(buf, record.Message)
+		case tokenTemplate:
+			buf.WriteString(record.Template)
+		case tokenContext:
+			l.writeContext(buf, ctx)
+		case tokenExtra:
+			l.writeExtra(buf, record.Extra)
+		case tokenEvent:
+			if event != nil {
+				l.writeJSON(buf, l.normalizeEvent(event))
+			}
+		}
 	}
-	output := strings.NewReplacer(oldnew...).Replace(l.format)
-	_, err := record.Formatted.WriteString(output)
-	return err
+	return nil
 }
 
 // FormatBatch Batch format records.
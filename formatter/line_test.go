@@ -0,0 +1,31 @@
+package formatter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	lit := func(s string) lineSegment { return lineSegment{token: tokenLiteral, literal: s} }
+	tests := []struct {
+		format string
+		want   []lineSegment
+	}{
+		{"", nil},
+		{"%Message%", []lineSegment{{token: tokenMessage}}},
+		{"%Channel%%Message%", []lineSegment{{token: tokenChannel}, {token: tokenMessage}}},
+		{"[%Channel%] %Message%\n", []lineSegment{lit("["), {token: tokenChannel}, lit("] "), {token: tokenMessage}, lit("\n")}},
+		{"%Message% trailing text", []lineSegment{{token: tokenMessage}, lit(" trailing text")}},
+		{"%Unknown% %Message%", []lineSegment{lit("%Unknown% "), {token: tokenMessage}}},
+		{"%Unknown%Message%", []lineSegment{lit("%Unknown"), {token: tokenMessage}}},
+		{"100% %Message%", []lineSegment{lit("100% "), {token: tokenMessage}}},
+		{"%Message%%", []lineSegment{{token: tokenMessage}, lit("%")}},
+		{"%Message", []lineSegment{lit("%Message")}},
+		{"%%", []lineSegment{lit("%%")}},
+	}
+	for _, tt := range tests {
+		if got := parseLine(tt.format); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.format, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/syyongx/llog/types"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Logfmt struct definition
+// Formats records as logfmt key=value pairs, one record per line:
+//
+//	time=2006-01-02T15:04:05Z07:00 level=warning channel=app msg="disk almost full" free=1024
+//
+// Events are written as event, actor and subject pairs followed by the payload.
+type Logfmt struct {
+	Normalizer
+}
+
+// NewLogfmt new logfmt formatter
+func NewLogfmt(dateFormat string) *Logfmt {
+	l := &Logfmt{}
+	l.SetDateFormat(dateFormat)
+	return l
+}
+
+// Format a log record
+func (l *Logfmt) Format(record *types.Record) error {
+	buf := record.Formatted
+	buf.WriteString("time=")
+	buf.WriteString(l.quote(l.normalizeTime(record.Datetime)))
+	l.writePair(buf, "level", record.LevelName)
+	l.writePair(buf, "channel", record.Channel)
+	l.writePair(buf, "msg", record.Message)
+	event, ctx := splitEvent(record)
+	if event != nil {
+		l.writeEvent(buf, event)
+	}
+	l.writeMap(buf, ctx)
+	l.writeMap(buf, record.Extra)
+	_, err := buf.WriteString("\n")
+	return err
+}
+
+// FormatBatch Batch format records.
+func (l *Logfmt) FormatBatch(records []*types.Record) error {
+	for _, record := range records {
+		err := l.Format(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEvent writes the name, actor and subject of an event, then its payload.
+func (l *Logfmt) writeEvent(buf *bytes.Buffer, e *types.Event) {
+	l.writePair(buf, "event", e.Name)
+	if e.Actor != "" {
+		l.writePair(buf, "actor", e.Actor)
+	}
+	if e.Subject != "" {
+		l.writePair(buf, "subject", e.Subject)
+	}
+	l.writeMap(buf, e.Payload)
+}
+
+// writeMap writes the pairs of a map, sorted by key if SortKeys is set.
+func (l *Logfmt) writeMap(buf *bytes.Buffer, m map[string]interface{}) {
+	m = l.normalizeMap(m)
+	if !l.sortKeys {
+		for k, v := range m {
+			l.writePair(buf, k, l.value(v))
+		}
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		l.writePair(buf, k, l.value(m[k]))
+	}
+}
+
+// writePair writes a space separated key=value pair.
+func (l *Logfmt) writePair(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(" ")
+	buf.WriteString(strings.Map(keyRune, key))
+	buf.WriteString("=")
+	buf.WriteString(l.quote(value))
+}
+
+// keyRune replaces the runes keys can't hold as they are not quoted.
+func keyRune(r rune) rune {
+	if r == ' ' || r == '=' || r == '"' || r == utf8.RuneError || unicode.IsControl(r) {
+		return '_'
+	}
+	return r
+}
+
+// quote values that are empty, invalid UTF-8 or contain spaces, quotes or control characters.
+func (l *Logfmt) quote(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t\r\n") || !utf8.ValidString(value) ||
+		strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// value stringifies a context or extra value.
+func (l *Logfmt) value(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float64:
+		return l.normalizeFloat(val)
+	case time.Duration:
+		return val.String()
+	case json.Marshaler:
+		return string(l.JSON(v))
+	case error:
+		return val.Error()
+	}
+	return string(l.JSON(v))
+}
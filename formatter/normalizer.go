@@ -1,16 +1,33 @@
 package formatter
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
+	"fmt"
 	"github.com/syyongx/llog/types"
 	"math"
 	"strconv"
 	"time"
 )
 
+// RFC3339Micro the RFC 3339 layout with microseconds.
+const RFC3339Micro = "2006-01-02T15:04:05.000000Z07:00"
+
+// DefaultDateFormat the layout of the formatters without a date format of their own.
+var DefaultDateFormat = time.RFC3339Nano
+
 // Normalizer Normalizes incoming records to remove objects/resources so it's easier to dump to various targets
 type Normalizer struct {
-	dateFormat string
+	dateFormat   string
+	numericUnits bool
+	location     *time.Location
+	limits       Limits
+	sortKeys     bool
+
+	noEscapeHTML       bool
+	rawLineTerminators bool
+	escapeNonASCII     bool
 }
 
 // NewNormalizer New normalizer
@@ -20,47 +37,283 @@ func NewNormalizer(dateFormat string) *Normalizer {
 	}
 }
 
-// SetDateFormat Set dateFormat
+// SetDateFormat Set dateFormat, empty uses DefaultDateFormat.
 func (n *Normalizer) SetDateFormat(dateFormat string) {
 	n.dateFormat = dateFormat
 }
 
+// SetLocation Set the location timestamps are rendered in, overriding the
+// location of the records. Nil keeps the record's.
+func (n *Normalizer) SetLocation(loc *time.Location) {
+	n.location = loc
+}
+
+// SetNumericUnits Whether durations and sizes are rendered with their numeric
+// values besides the human-readable ones, under key_ms and key_bytes.
+func (n *Normalizer) SetNumericUnits(numericUnits bool) {
+	n.numericUnits = numericUnits
+}
+
+// SetSortKeys Whether the keys of the context and extra are written sorted,
+// making the output byte-stable for golden files and diffs. The unsorted
+// default skips the sorting. The JSON encoding always sorts them.
+func (n *Normalizer) SetSortKeys(sortKeys bool) {
+	n.sortKeys = sortKeys
+}
+
+// normalizeMap renders the values of m with their log representation,
+// and the durations and sizes, into a copy if any. The time.Duration values
+// keep their encoding, in nanoseconds, unless the numeric units are set.
+func (n *Normalizer) normalizeMap(m map[string]interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	for k, v := range m {
+		var changed bool
+		var text string
+		var key string
+		var num interface{}
+		switch val := v.(type) {
+		case time.Duration:
+			if !n.numericUnits {
+				continue
+			}
+			text, key, num = val.String(), k+"_ms", types.Duration(val).Milliseconds()
+		case types.Duration:
+			text, key, num = val.String(), k+"_ms", val.Milliseconds()
+		case types.Size:
+			text, key, num = val.String(), k+"_bytes", int64(val)
+		default:
+			var truncated bool
+			v, changed = n.normalizeValue(v, 0)
+			if v, truncated = n.truncateJSON(v); !changed && !truncated {
+				continue
+			}
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(m)+1)
+			for k2, v2 := range m {
+				out[k2] = v2
+			}
+		}
+		if key == "" {
+			out[k] = v
+			continue
+		}
+		out[k] = text
+		if n.numericUnits {
+			out[key] = num
+		}
+	}
+	if out == nil {
+		return m
+	}
+	return out
+}
+
+// maxDepth bounds the nesting of the normalized values, the deeper values
+// are cut as encoding/json would not end on a cyclic map.
+const maxDepth = 32
+
+// normalizeValue renders v with its log representation, the registered one
+// or its LogValue, walking the generic maps and slices, and reports whether
+// it changed. Times are formatted, and errors, text marshalers and stringers
+// rendered as strings, unless they marshal to JSON themselves. Durations keep
+// their encoding, in nanoseconds.
+func (n *Normalizer) normalizeValue(v interface{}, depth int) (interface{}, bool) {
+	if v == nil {
+		return v, false
+	}
+	if depth >= maxDepth {
+		return TruncatedMarker, true
+	}
+	// the common types skip the registry and the reflection of encoding/json
+	switch val := v.(type) {
+	case string:
+		return n.truncate(val)
+	case float64:
+		// JSON has no NaN and infinities
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return n.normalizeFloat(val), true
+		}
+		return v, false
+	case float32:
+		if f := float64(val); math.IsNaN(f) || math.IsInf(f, 0) {
+			return n.normalizeFloat(f), true
+		}
+		return v, false
+	case bool, int, int64, uint64, json.Number, json.RawMessage, *types.Error, time.Duration:
+		return v, false
+	case time.Time:
+		return n.normalizeTime(val), true
+	}
+	if fn := serializerOf(v); fn != nil {
+		out, _ := n.normalizeValue(fn(v), depth+1)
+		return out, true
+	}
+	switch val := v.(type) {
+	case types.LogValuer:
+		out, _ := n.normalizeValue(val.LogValue(), depth+1)
+		return out, true
+	case json.Marshaler:
+		return v, false
+	case error:
+		return val.Error(), true
+	case encoding.TextMarshaler:
+		text, err := val.MarshalText()
+		if err != nil {
+			return err.Error(), true
+		}
+		return string(text), true
+	case fmt.Stringer:
+		return val.String(), true
+	case map[string]interface{}:
+		return n.normalizeNested(val, depth)
+	case types.RecordContext:
+		return n.normalizeNested(val, depth)
+	case []interface{}:
+		if n.tooDeep(depth) {
+			return TruncatedMarker, true
+		}
+		out := n.capSlice(val)
+		if out != nil {
+			val = out[:len(out)-1]
+		}
+		for i, e := range val {
+			e, changed := n.normalizeValue(e, depth+1)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = append([]interface{}(nil), val...)
+			}
+			out[i] = e
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	}
+	if out, ok := n.generic(v); ok {
+		out, _ = n.normalizeValue(out, depth)
+		return out, true
+	}
+	return v, false
+}
+
+// normalizeNested renders the values of a nested map, into a copy if any.
+func (n *Normalizer) normalizeNested(m map[string]interface{}, depth int) (interface{}, bool) {
+	if n.tooDeep(depth) {
+		return TruncatedMarker, true
+	}
+	out := n.capMap(m)
+	if out != nil {
+		m = out
+	}
+	for k, v := range m {
+		if k == TruncatedMarker && out != nil {
+			continue
+		}
+		v, changed := n.normalizeValue(v, depth+1)
+		if !changed {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(m))
+			for k2, v2 := range m {
+				out[k2] = v2
+			}
+		}
+		out[k] = v
+	}
+	if out == nil {
+		return m, false
+	}
+	return out, true
+}
+
 // DateFormat Get dateFormat
 func (n *Normalizer) DateFormat() string {
 	return n.dateFormat
 }
 
-// Normalize extra of record
-func (n *Normalizer) normalizeExtra(extra types.RecordExtra) string {
-	if len(extra) > 1000 {
-		i := len(extra) - 1000
-		for k := range extra {
+// maxItems the number of context or extra items kept by the normalization.
+const maxItems = 1000
+
+// limit drops the items of m over maxItems.
+func limit(m map[string]interface{}) {
+	if len(m) > maxItems {
+		i := len(m) - maxItems
+		for k := range m {
 			if i--; i < 0 {
 				break
 			}
-			delete(extra, k)
+			delete(m, k)
 		}
 	}
+}
+
+// splitEvent Gets the event of a record and its context without it.
+func splitEvent(record *types.Record) (*types.Event, types.RecordContext) {
+	e := types.EventOf(record)
+	if e == nil {
+		return nil, record.Context
+	}
+	ctx := make(types.RecordContext, len(record.Context)-1)
+	for k, v := range record.Context {
+		if k != types.EventKey {
+			ctx[k] = v
+		}
+	}
+	return e, ctx
+}
+
+// normalizeEvent renders an event with its normalized payload.
+func (n *Normalizer) normalizeEvent(e *types.Event) map[string]interface{} {
+	m := map[string]interface{}{"name": e.Name}
+	if e.Actor != "" {
+		m["actor"] = e.Actor
+	}
+	if e.Subject != "" {
+		m["subject"] = e.Subject
+	}
+	if len(e.Payload) > 0 {
+		m["payload"] = n.normalizeMap(e.Payload)
+	}
+	return m
+}
+
+// Normalize extra of record
+func (n *Normalizer) normalizeExtra(extra types.RecordExtra) string {
+	limit(extra)
 	// fmt.Sprintf("Over 1000 items (%d total), aborting normalization", len(data.(types.RecordExtra)));
-	return string(n.JSON(extra))
+	return string(n.JSON(n.normalizeMap(extra)))
 }
 
 // Normalize context of record
 func (n *Normalizer) normalizeContext(ctx types.RecordContext) string {
-	if len(ctx) > 1000 {
-		i := len(ctx) - 1000
-		for k := range ctx {
-			if i--; i < 0 {
-				break
-			}
-			delete(ctx, k)
-		}
-	}
-	return string(n.JSON(ctx))
+	limit(ctx)
+	return string(n.JSON(n.normalizeMap(ctx)))
+}
+
+// writeExtra writes the normalized extra of a record to buf.
+func (n *Normalizer) writeExtra(buf *bytes.Buffer, extra types.RecordExtra) {
+	limit(extra)
+	n.writeJSON(buf, n.normalizeMap(extra))
+}
+
+// writeContext writes the normalized context of a record to buf.
+func (n *Normalizer) writeContext(buf *bytes.Buffer, ctx types.RecordContext) {
+	limit(ctx)
+	n.writeJSON(buf, n.normalizeMap(ctx))
 }
 
 // Normalize float
 func (n *Normalizer) normalizeTime(t time.Time) string {
+	if n.location != nil {
+		t = t.In(n.location)
+	}
+	if n.dateFormat == "" {
+		return t.Format(DefaultDateFormat)
+	}
 	return t.Format(n.dateFormat)
 }
 
@@ -81,11 +334,42 @@ func (n *Normalizer) normalizeFloat(f float64) string {
 	return strconv.FormatFloat(f, 'f', 3, 64)
 }
 
+// writeJSON writes the JSON representation of a value to buf without allocating it apart.
+func (n *Normalizer) writeJSON(buf *bytes.Buffer, data interface{}) {
+	start := buf.Len()
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(!n.noEscapeHTML)
+	if err := enc.Encode(data); err != nil {
+		buf.Truncate(start)
+		buf.Write(errorJSON(err))
+		return
+	}
+	// drop the newline written by Encode
+	buf.Truncate(buf.Len() - 1)
+	if n.rawLineTerminators || n.escapeNonASCII {
+		v := n.escape(buf.Bytes()[start:])
+		buf.Truncate(start)
+		buf.Write(v)
+	}
+}
+
 // JSON Return the JSON representation of a value
 func (n *Normalizer) JSON(data interface{}) []byte {
+	if n.noEscapeHTML {
+		var buf bytes.Buffer
+		n.writeJSON(&buf, data)
+		return buf.Bytes()
+	}
 	v, err := json.Marshal(data)
 	if err != nil {
-		return []byte(err.Error())
+		return errorJSON(err)
 	}
+	return n.escape(v)
+}
+
+// errorJSON the JSON string of the message of an encoding error, so the
+// output stays valid JSON.
+func errorJSON(err error) []byte {
+	v, _ := json.Marshal(err.Error())
 	return v
 }
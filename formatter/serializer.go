@@ -0,0 +1,77 @@
+package formatter
+
+import (
+	"github.com/syyongx/llog/types"
+	"reflect"
+	"sync"
+)
+
+// Serializer converts a value into its log representation, such as a map
+// of the few fields worth logging.
+type Serializer func(v interface{}) interface{}
+
+var (
+	serializerMu sync.RWMutex
+	serializers  = map[reflect.Type]Serializer{}
+)
+
+// RegisterType Registers the log representation of the values of the type of
+// example, used by the formatters instead of the value itself, e.g.
+//
+//	formatter.RegisterType(User{}, func(v interface{}) interface{} {
+//		u := v.(User)
+//		return map[string]interface{}{"id": u.ID, "name": u.Name}
+//	})
+//
+// Non nil pointers to the type are dereferenced and serialized as well.
+// A nil serializer unregisters the type.
+func RegisterType(example interface{}, fn Serializer) {
+	t := reflect.TypeOf(example)
+	serializerMu.Lock()
+	if fn == nil {
+		delete(serializers, t)
+	} else {
+		serializers[t] = fn
+	}
+	serializerMu.Unlock()
+}
+
+// serializerOf gets the serializer of the type of v, wrapped to dereference
+// pointers to a registered type.
+func serializerOf(v interface{}) Serializer {
+	serializerMu.RLock()
+	defer serializerMu.RUnlock()
+	if len(serializers) == 0 {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	if fn, ok := serializers[t]; ok {
+		return fn
+	}
+	if t.Kind() != reflect.Ptr {
+		return nil
+	}
+	fn, ok := serializers[t.Elem()]
+	if !ok || reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	return func(v interface{}) interface{} {
+		return fn(reflect.ValueOf(v).Elem().Interface())
+	}
+}
+
+// defaultNormalizer renders the values for Normalize.
+var defaultNormalizer = NewNormalizer("")
+
+func init() {
+	types.SetNormalizer(Normalize)
+}
+
+// Normalize Get the log representation of v as rendered by the formatters, for
+// the encoders not going through one: the registered serializers and LogValue
+// are applied, also to the values of the maps and slices, and times, errors
+// and stringers rendered as strings.
+func Normalize(v interface{}) interface{} {
+	out, _ := defaultNormalizer.normalizeValue(v, 0)
+	return out
+}
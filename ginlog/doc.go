@@ -0,0 +1,12 @@
+// Package ginlog provides a Gin middleware logging requests through llog.
+//
+// It is built with the llog_gin tag, as it requires the github.com/gin-gonic/gin module:
+//
+//	go build -tags llog_gin
+//
+//	r := gin.New()
+//	ginlog.Use(logger)
+//	r.Use(ginlog.Middleware(logger))
+//
+// Handlers get the request-scoped logger by llog.FromContext(c.Request.Context()).
+package ginlog
@@ -0,0 +1,48 @@
+//go:build llog_gin
+// +build llog_gin
+
+package ginlog
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/httplog"
+	"github.com/syyongx/llog/types"
+	"time"
+)
+
+// Use Replaces the default writers of Gin, its debug output is logged at DEBUG
+// and its errors at ERROR.
+func Use(logger *llog.Logger) {
+	gin.DefaultWriter = llog.NewWriter(logger, types.DEBUG)
+	gin.DefaultErrorWriter = llog.NewWriter(logger, types.ERROR)
+}
+
+// Middleware Logs finished requests at INFO, WARNING for 4xx and ERROR for 5xx
+// status codes, it replaces gin.Logger.
+func Middleware(logger *llog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		scoped := logger.With(types.RecordContext{
+			"method":    c.Request.Method,
+			"path":      c.Request.URL.Path,
+			"client_ip": c.ClientIP(),
+		})
+		ctx := llog.NewContext(c.Request.Context(), scoped)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		fields := types.RecordContext{
+			"status":      status,
+			"route":       c.FullPath(),
+			"bytes":       c.Writer.Size(),
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.ByType(gin.ErrorTypePrivate).String()
+		}
+		scoped.AddRecordFields(ctx, httplog.StatusLevel(status), "request finished", fields)
+	}
+}
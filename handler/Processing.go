@@ -1,6 +1,9 @@
 package handler
 
-import "github.com/syyongx/llog/types"
+import (
+	"github.com/syyongx/llog/types"
+	"time"
+)
 
 // Processing struct definition
 type Processing struct {
@@ -8,29 +11,77 @@ type Processing struct {
 	Processable
 	Formattable
 
-	Writer func(*types.Record)
+	// Writer writes a formatted record, the error is reported in the result.
+	Writer func(*types.Record) error
+	// BatchWriter writes formatted records at once, Writer is used per record if nil.
+	BatchWriter func([]*types.Record) error
 }
 
 // Handle a record.
 func (p *Processing) Handle(record *types.Record) bool {
+	return p.HandleResult(record).Action == types.Stop
+}
+
+// HandleResult Handles a record, reporting format errors.
+func (p *Processing) HandleResult(record *types.Record) types.Result {
 	if !p.IsHandling(record) {
-		return false
+		return types.Result{Action: types.Continue}
 	}
 	if p.processors != nil {
+		record = record.Clone()
+		defer types.ReleaseRecord(record)
 		p.ProcessRecord(record)
 	}
+	if types.Metrics() != nil {
+		defer p.reportLatency(time.Now())
+	}
+	// The record may have been formatted by a previous handler.
+	record.Formatted.Reset()
 	err := p.GetFormatter().Format(record)
 	if err != nil {
-		return false
+		p.reportError(err)
+		return types.Result{Action: types.Continue, Err: err}
+	}
+	if err := p.Writer(record); err != nil {
+		return types.Result{Action: types.Continue, Err: err}
 	}
-	p.Writer(record)
+	p.count(record.Formatted.Len())
 
-	return false == p.GetBubble()
+	return p.result()
 }
 
-// HandleBatch Handles a set of records.
+// HandleBatch Handles a set of records, formatting them all before writing
+// them at once through BatchWriter if set.
 func (p *Processing) HandleBatch(records []*types.Record) {
+	if p.BatchWriter == nil {
+		for _, record := range records {
+			p.Handle(record)
+		}
+		return
+	}
+	if types.Metrics() != nil {
+		defer p.reportLatency(time.Now())
+	}
+	batch := make([]*types.Record, 0, len(records))
 	for _, record := range records {
-		p.Handle(record)
+		if !p.IsHandling(record) {
+			continue
+		}
+		if p.processors != nil {
+			record = record.Clone()
+			defer types.ReleaseRecord(record)
+			p.ProcessRecord(record)
+		}
+		record.Formatted.Reset()
+		if err := p.GetFormatter().Format(record); err != nil {
+			p.reportError(err)
+			continue
+		}
+		batch = append(batch, record)
+	}
+	if len(batch) > 0 && p.BatchWriter(batch) == nil {
+		for _, record := range batch {
+			p.count(record.Formatted.Len())
+		}
 	}
 }
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Adaptive the adaptive sampling of a Buffer: while its queue or the latency
+// of its handler is over the thresholds, the pressure is raised a step every
+// Interval, each step sampling one more level starting from DEBUG, until the
+// levels below Keep are all sampled. Once healthy again, under half the
+// thresholds, the pressure is lowered a step every Interval. The events
+// logged by Logger.Event are never sampled.
+type Adaptive struct {
+	// HighWater the fill ratio of the queue, from 0 to 1, over which the
+	// handler is unhealthy. 0 ignores the queue.
+	HighWater float64
+	// MaxLatency the average time the handler takes per record over which it
+	// is unhealthy. 0 ignores the latency.
+	MaxLatency time.Duration
+	// Keep the lowest level never sampled, defaults to WARNING.
+	Keep int
+	// Rate keeps one in Rate of the sampled records, 1 or less drops them all.
+	Rate int
+	// Interval the minimal time between two pressure changes.
+	Interval time.Duration
+}
+
+// WithAdaptiveSampling Samples the low level records of a Buffer while its
+// queue fills up or its handler slows down, see Adaptive.
+func WithAdaptiveSampling(adaptive Adaptive) Option {
+	return func(o *Options) {
+		o.Adaptive = &adaptive
+	}
+}
+
+// pressureLevels the levels sampled by each pressure step.
+var pressureLevels = []int{types.DEBUG, types.INFO, types.NOTICE, types.WARNING, types.ERROR, types.CRITICAL, types.ALERT}
+
+// adaptive the state of the adaptive sampling.
+type adaptive struct {
+	Adaptive
+
+	levels   []int // the levels below Keep
+	pressure int32
+	latency  int64 // moving average, in nanoseconds
+	sampled  uint64
+	counter  uint64
+
+	mu      sync.Mutex
+	changed time.Time
+}
+
+func newAdaptive(a Adaptive) *adaptive {
+	if a.Keep == 0 {
+		a.Keep = types.WARNING
+	}
+	s := &adaptive{Adaptive: a}
+	for _, level := range pressureLevels {
+		if level < a.Keep {
+			s.levels = append(s.levels, level)
+		}
+	}
+	return s
+}
+
+// keep Checks whether a record passes the sampling, counting it if not.
+func (a *adaptive) keep(record *types.Record) bool {
+	p := atomic.LoadInt32(&a.pressure)
+	if p == 0 || record.Level >= a.Keep || record.Level > a.levels[p-1] || types.EventOf(record) != nil {
+		return true
+	}
+	if a.Rate > 1 && atomic.AddUint64(&a.counter, 1)%uint64(a.Rate) == 0 {
+		return true
+	}
+	atomic.AddUint64(&a.sampled, 1)
+	return false
+}
+
+// observe Adds the time the handler took for a record to the average latency.
+func (a *adaptive) observe(d time.Duration) {
+	if a.MaxLatency <= 0 {
+		return
+	}
+	avg := atomic.LoadInt64(&a.latency)
+	atomic.StoreInt64(&a.latency, avg+(int64(d)-avg)/8)
+}
+
+// adapt Raises or lowers the pressure by the fill ratio of the queue and the latency.
+func (a *adaptive) adapt(fill float64, now time.Time, name string) {
+	latency := time.Duration(atomic.LoadInt64(&a.latency))
+	high := (a.HighWater > 0 && fill >= a.HighWater) || (a.MaxLatency > 0 && latency > a.MaxLatency)
+	low := fill <= a.HighWater/2 && latency <= a.MaxLatency/2
+	p := atomic.LoadInt32(&a.pressure)
+	if !(high && int(p) < len(a.levels)) && !(low && p > 0) {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.changed.IsZero() && now.Sub(a.changed) < a.Interval {
+		return
+	}
+	p = atomic.LoadInt32(&a.pressure)
+	switch {
+	case high && int(p) < len(a.levels):
+		p++
+	case low && p > 0:
+		p--
+	default:
+		return
+	}
+	atomic.StoreInt32(&a.pressure, p)
+	a.changed = now
+	types.Internal(types.WARNING, "sampling pressure changed", types.RecordContext{
+		"handler": name, "pressure": int(p), "fill": fill, "latency": latency.String(),
+	})
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"github.com/syyongx/llog/types"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AlertRule Fires an alert when Threshold records matching the rule are
+// handled within Window, such as 5 errors of the "payments" channel in a minute.
+type AlertRule struct {
+	Name string
+	// MinLevel the minimum level of the matching records.
+	MinLevel int
+	// Channel pattern in the path.Match syntax, empty matches all channels.
+	Channel string
+	// Match further selects the records if not nil.
+	Match     func(record *types.Record) bool
+	Threshold int
+	Window    time.Duration
+	// Cooldown the minimum time between two alerts of the rule, defaults to Window.
+	Cooldown time.Duration
+}
+
+// Alert A fired alert rule.
+type Alert struct {
+	Rule string
+	// The number of matching records within the window, the threshold of the rule.
+	Count int
+	// The times of the first and last of these records.
+	First time.Time
+	Last  time.Time
+	// The last matching record, valid during the callback only.
+	Record *types.Record
+}
+
+// Alerts handler evaluates alert rules against the records, calling the
+// callback and passing an alert record to the alert handler, such as a mail
+// or webhook handler, when a rule fires. It gives lightweight in-process
+// alerting besides the regular handlers, records bubble by default.
+type Alerts struct {
+	Handler
+
+	callback func(Alert)
+	target   types.IHandler
+
+	mu    sync.Mutex
+	rules []*alertRule
+}
+
+type alertRule struct {
+	AlertRule
+	// times the ring of the times of the last Threshold matching records
+	times []time.Time
+	next  int
+	fired time.Time
+}
+
+// NewAlerts New alerting handler
+// callback: Called with each fired alert, may be nil
+// target: The handler of the alert records, nil if none
+func NewAlerts(callback func(Alert), target types.IHandler, opts ...Option) *Alerts {
+	o := newOptions(opts)
+	a := &Alerts{
+		callback: callback,
+		target:   target,
+	}
+	o.apply(&a.Handler, a)
+	return a
+}
+
+// AddRule Adds an alert rule.
+func (a *Alerts) AddRule(rule AlertRule) error {
+	if rule.Name == "" {
+		return errors.New("alert rule name is missing")
+	}
+	if rule.Threshold < 1 || rule.Window <= 0 {
+		return errors.New("alert rule " + rule.Name + " requires a threshold and a window")
+	}
+	if _, err := path.Match(rule.Channel, ""); err != nil {
+		return err
+	}
+	if rule.Cooldown <= 0 {
+		rule.Cooldown = rule.Window
+	}
+	a.mu.Lock()
+	a.rules = append(a.rules, &alertRule{AlertRule: rule, times: make([]time.Time, rule.Threshold)})
+	a.mu.Unlock()
+	return nil
+}
+
+// Handle Evaluates the rules against a record.
+func (a *Alerts) Handle(record *types.Record) bool {
+	if !a.IsHandling(record) {
+		return false
+	}
+	now := a.GetClock().Now()
+	var fired []Alert
+	a.mu.Lock()
+	for _, r := range a.rules {
+		if alert, ok := r.observe(record, now); ok {
+			fired = append(fired, alert)
+		}
+	}
+	a.mu.Unlock()
+	a.count(0)
+
+	for _, alert := range fired {
+		a.fire(alert)
+	}
+	return false == a.GetBubble()
+}
+
+// HandleBatch Handles a set of records.
+func (a *Alerts) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		a.Handle(record)
+	}
+}
+
+// Close the alert handler.
+func (a *Alerts) Close() {
+	if a.target != nil {
+		a.target.Close()
+	}
+}
+
+// observe a record, reporting whether the rule fires. The lock is held.
+func (r *alertRule) observe(record *types.Record, now time.Time) (Alert, bool) {
+	if record.Level < r.MinLevel {
+		return Alert{}, false
+	}
+	if r.Channel != "" {
+		if ok, _ := path.Match(r.Channel, record.Channel); !ok {
+			return Alert{}, false
+		}
+	}
+	if r.Match != nil && !r.Match(record) {
+		return Alert{}, false
+	}
+	r.times[r.next] = now
+	r.next = (r.next + 1) % len(r.times)
+	// the oldest of the last Threshold records is next in the ring
+	first := r.times[r.next]
+	if first.IsZero() || !first.After(now.Add(-r.Window)) || !r.fired.IsZero() && now.Sub(r.fired) < r.Cooldown {
+		return Alert{}, false
+	}
+	r.fired = now
+	return Alert{
+		Rule:   r.Name,
+		Count:  r.Threshold,
+		First:  first,
+		Last:   now,
+		Record: record,
+	}, true
+}
+
+// fire calls the callback and passes the alert record to the alert handler.
+func (a *Alerts) fire(alert Alert) {
+	if a.callback != nil {
+		a.callback(alert)
+	}
+	if a.target == nil {
+		return
+	}
+	c := alert.Record.Clone()
+	defer types.ReleaseRecord(c)
+	c.Message = "alert " + alert.Rule + ": " + strconv.Itoa(alert.Count) + " records since " +
+		alert.First.Format(time.RFC3339) + ", last: " + alert.Record.Message
+	if c.Context == nil {
+		c.Context = make(types.RecordContext, 2)
+	}
+	c.Context["alert"] = alert.Rule
+	c.Context["alert_count"] = alert.Count
+	if a.target.IsHandling(c) {
+		a.target.Handle(c)
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"time"
+)
+
+// Batching the batch settings shared by the batching handlers. A batch is
+// sent once it holds MaxRecords records or MaxBytes bytes, or once its first
+// record waited MaxLinger. Zero values are unlimited, a MaxRecords of 1 or
+// less disables the batching.
+type Batching struct {
+	MaxRecords int
+	// MaxBytes counts the message bytes of the records, as handlers may
+	// format the batched records later.
+	MaxBytes  int
+	MaxLinger time.Duration
+}
+
+// Enabled Whether records are batched.
+func (b Batching) Enabled() bool {
+	return b.MaxRecords > 1 || b.MaxRecords == 0 && (b.MaxBytes > 0 || b.MaxLinger > 0)
+}
+
+// Full Whether a batch of n records of size message bytes is to be sent.
+func (b Batching) Full(n, size int) bool {
+	return b.MaxRecords > 0 && n >= b.MaxRecords || b.MaxBytes > 0 && size >= b.MaxBytes
+}
+
+// WithBatching Set the batch settings of batching handlers, such as Buffer.
+func WithBatching(batching Batching) Option {
+	return func(o *Options) {
+		o.Batching = batching
+	}
+}
+
+// batch the records of a batching handler waiting to be sent.
+type batch struct {
+	Batching
+	records []*types.Record
+	size    int
+	first   time.Time
+}
+
+// add a record, reporting whether the batch is full.
+func (b *batch) add(record *types.Record, now time.Time) bool {
+	if len(b.records) == 0 {
+		b.first = now
+	}
+	b.records = append(b.records, record)
+	b.size += len(record.Message)
+	return b.Full(len(b.records), b.size)
+}
+
+// expired Whether the first record waited MaxLinger.
+func (b *batch) expired(now time.Time) bool {
+	return len(b.records) > 0 && b.MaxLinger > 0 && now.Sub(b.first) >= b.MaxLinger
+}
+
+// take the records, emptying the batch.
+func (b *batch) take() []*types.Record {
+	records := b.records
+	b.records = nil
+	b.size = 0
+	return records
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"sync"
+	"time"
+)
+
+// Circuit states of a Breaker.
+const (
+	// BreakerClosed passes the records to the handler.
+	BreakerClosed = iota
+	// BreakerOpen routes the records to the fallback, or drops them.
+	BreakerOpen
+	// BreakerHalfOpen passes one probe record to the handler.
+	BreakerHalfOpen
+)
+
+// BreakerStats Counters of the records an open Breaker diverted.
+type BreakerStats struct {
+	Fallback uint64
+	Dropped  uint64
+	Opened   uint64
+}
+
+// Breaker Stops passing records to a handler after threshold consecutive
+// failures, so a dead sink does not stall the logging. While open the records
+// go to the fallback handler or are dropped, after cooldown one record probes
+// the handler, closing the circuit on success.
+// Failures are the errors reported by handlers implementing types.ResultHandler.
+type Breaker struct {
+	Handler
+
+	handler   types.IHandler
+	fallback  types.IHandler
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	stats    BreakerStats
+}
+
+// NewBreaker New circuit breaker handler
+// threshold: The number of consecutive failures opening the circuit
+// cooldown: The time the circuit stays open before probing the handler
+// fallback: The handler of the records while open, nil drops them
+func NewBreaker(handler types.IHandler, threshold int, cooldown time.Duration, fallback types.IHandler, opts ...Option) *Breaker {
+	o := newOptions(opts)
+	if threshold < 1 {
+		threshold = 1
+	}
+	b := &Breaker{
+		handler:   handler,
+		fallback:  fallback,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+	o.apply(&b.Handler, b)
+	return b
+}
+
+// IsHandling Checks whether the wrapped handler handles the record.
+func (b *Breaker) IsHandling(record *types.Record) bool {
+	return b.MatchChannel(record.Channel) && b.handler.IsHandling(record)
+}
+
+// SetLevel Set the level of the breaker and of the wrapped handler.
+func (b *Breaker) SetLevel(level int) {
+	b.Handler.SetLevel(level)
+	forwardLevel(b.handler, level)
+}
+
+// Handle Passes the record to the handler, or to the fallback while open.
+func (b *Breaker) Handle(record *types.Record) bool {
+	return b.HandleResult(record).Action == types.Stop
+}
+
+// HandleResult Passes the record to the handler, or to the fallback while open.
+func (b *Breaker) HandleResult(record *types.Record) types.Result {
+	if !b.IsHandling(record) {
+		return types.Result{Action: types.Continue}
+	}
+	if !b.allow() {
+		b.divert(record)
+		return b.result()
+	}
+	res := types.HandleResult(b.handler, record)
+	b.count(0)
+	b.done(res.Err)
+	if res.Err != nil {
+		return res
+	}
+	res.Action = b.result().Action
+	return res
+}
+
+// HandleBatch Handles a set of records.
+func (b *Breaker) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		b.Handle(record)
+	}
+}
+
+// State Get the circuit state, such as BreakerOpen.
+func (b *Breaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Stats Get the counters of the diverted records.
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Close Closes the handler and the fallback.
+func (b *Breaker) Close() {
+	b.handler.Close()
+	if b.fallback != nil {
+		b.fallback.Close()
+	}
+}
+
+// allow reports whether a record may go to the handler, turning an open
+// circuit half-open once cooled down.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if b.GetClock().Now().Sub(b.openedAt) >= b.cooldown {
+			b.state = BreakerHalfOpen
+			return true
+		}
+	}
+	// a probe is in flight
+	return false
+}
+
+// done records the outcome of a record passed to the handler.
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state == BreakerClosed {
+			b.stats.Opened++
+			types.Internal(types.WARNING, "circuit opened", types.RecordContext{"handler": b.name, "error": err.Error()})
+		}
+		b.state = BreakerOpen
+		b.openedAt = b.GetClock().Now()
+	}
+}
+
+// divert passes a record to the fallback, or drops it.
+func (b *Breaker) divert(record *types.Record) {
+	b.mu.Lock()
+	if b.fallback != nil {
+		b.stats.Fallback++
+	} else {
+		b.stats.Dropped++
+	}
+	b.mu.Unlock()
+	if b.fallback != nil {
+		b.fallback.Handle(record)
+	} else if m := types.Metrics(); m != nil {
+		m.RecordDropped(b.name)
+	}
+}
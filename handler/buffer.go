@@ -1,42 +1,180 @@
 package handler
 
 import (
+	"errors"
 	"github.com/syyongx/llog/types"
+	"sync/atomic"
+	"time"
 )
 
+// Overflow policies of a full buffer.
+const (
+	// Block the logging goroutine until the buffer has room.
+	OverflowBlock = iota
+	// Drop the oldest queued record to make room.
+	OverflowDropOldest
+	// Drop the record being logged.
+	OverflowDropNewest
+	// Hand the record being logged to the spill handler, such as a file.
+	OverflowSpill
+)
+
+// ErrBufferFull Reported for the records dropped by a full buffer.
+var ErrBufferFull = errors.New("buffer is full")
+
+// BufferStats Counters of the records a full buffer blocked on, dropped or
+// spilled, of the records dropped for their age, and of the records dropped
+// by the adaptive sampling.
+type BufferStats struct {
+	Blocked       uint64
+	DroppedOldest uint64
+	DroppedNewest uint64
+	Spilled       uint64
+	DroppedStale  uint64
+	Sampled       uint64
+}
+
 // Buffer struct definition
 type Buffer struct {
 	Handler
 
-	handler types.IHandler
-	records chan *types.Record
-	close   chan bool
+	handler  types.IHandler
+	records  chan *types.Record
+	close    chan bool
+	overflow int
+	spill    types.IHandler
+	maxAge   time.Duration
+	adaptive *adaptive
+	stats    BufferStats
 }
 
 // NewBuffer New async handler
 // bufSize: channel buffer size.
 func NewBuffer(handler types.IHandler, bufSize, level int, bubble bool) *Buffer {
+	return NewBufferWith(handler, WithBufferSize(bufSize), WithLevel(level), WithBubble(bubble))
+}
+
+// NewBufferWith New async handler configured by options.
+// The channel buffer size is set by WithBufferSize.
+func NewBufferWith(handler types.IHandler, opts ...Option) *Buffer {
+	o := newOptions(opts)
 	buf := &Buffer{
-		handler: handler,
-		records: make(chan *types.Record, bufSize),
-		close:   make(chan bool, 0),
+		handler:  handler,
+		records:  make(chan *types.Record, o.BufferSize),
+		close:    make(chan bool, 0),
+		overflow: o.Overflow,
+		spill:    o.Spill,
+		maxAge:   o.MaxAge,
+	}
+	if o.Adaptive != nil {
+		buf.adaptive = newAdaptive(*o.Adaptive)
 	}
-	buf.SetLevel(level)
-	buf.SetBubble(bubble)
+	o.apply(&buf.Handler, buf)
 
-	go func() {
-		for {
-			record := <-buf.records
+	go buf.run(o.Flush, o.Batching)
+
+	return buf
+}
+
+// run handles the queued records until closed, flushing the handler every
+// interval if not zero and the handler implements types.Flusher.
+// The records are passed in batches if batching is enabled.
+func (b *Buffer) run(interval time.Duration, batching Batching) {
+	var tick, linger <-chan time.Time
+	flusher, ok := b.handler.(types.Flusher)
+	if ok && interval > 0 {
+		ticker := b.GetClock().NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C()
+	}
+	pending := &batch{Batching: batching}
+	if batching.Enabled() && batching.MaxLinger > 0 {
+		// check the linger of the batch several times per period
+		ticker := b.GetClock().NewTicker(batching.MaxLinger / 4)
+		defer ticker.Stop()
+		linger = ticker.C()
+	}
+	for {
+		select {
+		case record := <-b.records:
 			if record == nil {
-				buf.handler.Close()
-				buf.close <- true
-				break
+				b.send(pending)
+				b.handler.Close()
+				b.close <- true
+				return
+			}
+			if b.stale(record) {
+				types.ReleaseRecord(record)
+			} else if !batching.Enabled() {
+				start := b.GetClock().Now()
+				b.handler.Handle(record)
+				types.ReleaseRecord(record)
+				b.observe(start, 1)
+			} else if pending.add(record, b.GetClock().Now()) {
+				b.send(pending)
+			}
+		case <-linger:
+			if pending.expired(b.GetClock().Now()) {
+				b.send(pending)
+			}
+		case <-tick:
+			b.send(pending)
+			if err := flusher.Flush(); err != nil {
+				b.reportError(err)
 			}
-			buf.handler.Handle(record)
 		}
-	}()
+	}
+}
 
-	return buf
+// stale checks whether a dequeued record is older than the max age, counting it as dropped.
+func (b *Buffer) stale(record *types.Record) bool {
+	if b.maxAge <= 0 || b.GetClock().Now().Sub(record.Datetime) <= b.maxAge {
+		return false
+	}
+	atomic.AddUint64(&b.stats.DroppedStale, 1)
+	b.reportError(ErrStale)
+	return true
+}
+
+// send passes the pending records to the handler at once.
+func (b *Buffer) send(pending *batch) {
+	records := pending.take()
+	if len(records) == 0 {
+		return
+	}
+	start := b.GetClock().Now()
+	b.handler.HandleBatch(records)
+	for _, record := range records {
+		types.ReleaseRecord(record)
+	}
+	b.observe(start, len(records))
+}
+
+// observe feeds the adaptive sampling with the time the handler took for n
+// records since start.
+func (b *Buffer) observe(start time.Time, n int) {
+	if b.adaptive == nil {
+		return
+	}
+	now := b.GetClock().Now()
+	b.adaptive.observe(now.Sub(start) / time.Duration(n))
+	b.adaptive.adapt(b.fill(), now, b.name)
+}
+
+// fill Get the fill ratio of the queue.
+func (b *Buffer) fill() float64 {
+	if cap(b.records) == 0 {
+		return 0
+	}
+	return float64(len(b.records)) / float64(cap(b.records))
+}
+
+// Pressure Get the pressure step of the adaptive sampling, 0 when healthy.
+func (b *Buffer) Pressure() int {
+	if b.adaptive == nil {
+		return 0
+	}
+	return int(atomic.LoadInt32(&b.adaptive.pressure))
 }
 
 // Handle handles a record.
@@ -44,12 +182,85 @@ func (b *Buffer) Handle(record *types.Record) bool {
 	if !b.IsHandling(record) {
 		return false
 	}
+	if b.adaptive != nil {
+		b.adaptive.adapt(b.fill(), b.GetClock().Now(), b.name)
+		if !b.adaptive.keep(record) {
+			return false
+		}
+	}
 
-	b.records <- record
+	// The logger releases the record once dispatched, a copy is queued.
+	b.enqueue(record.Clone())
+	b.count(0)
 
 	return false == b.GetBubble()
 }
 
+// enqueue queues a record, applying the overflow policy if the buffer is full.
+func (b *Buffer) enqueue(record *types.Record) {
+	select {
+	case b.records <- record:
+		return
+	default:
+	}
+
+	switch b.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case b.records <- record:
+				return
+			case old := <-b.records:
+				if old == nil {
+					// closing, keep the close signal queued
+					b.records <- old
+					types.ReleaseRecord(record)
+					return
+				}
+				types.ReleaseRecord(old)
+				atomic.AddUint64(&b.stats.DroppedOldest, 1)
+				b.reportError(ErrBufferFull)
+			}
+		}
+	case OverflowDropNewest:
+		types.ReleaseRecord(record)
+		atomic.AddUint64(&b.stats.DroppedNewest, 1)
+		b.reportError(ErrBufferFull)
+	case OverflowSpill:
+		if b.spill != nil {
+			b.spill.Handle(record)
+			types.ReleaseRecord(record)
+			atomic.AddUint64(&b.stats.Spilled, 1)
+			return
+		}
+		atomic.AddUint64(&b.stats.Blocked, 1)
+		b.records <- record
+	default:
+		atomic.AddUint64(&b.stats.Blocked, 1)
+		b.records <- record
+	}
+}
+
+// Stats Get the counters of the overflow policy.
+func (b *Buffer) Stats() BufferStats {
+	return BufferStats{
+		Blocked:       atomic.LoadUint64(&b.stats.Blocked),
+		DroppedOldest: atomic.LoadUint64(&b.stats.DroppedOldest),
+		DroppedNewest: atomic.LoadUint64(&b.stats.DroppedNewest),
+		Spilled:       atomic.LoadUint64(&b.stats.Spilled),
+		DroppedStale:  atomic.LoadUint64(&b.stats.DroppedStale),
+		Sampled:       b.sampled(),
+	}
+}
+
+// sampled Get the number of records dropped by the adaptive sampling.
+func (b *Buffer) sampled() uint64 {
+	if b.adaptive == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&b.adaptive.sampled)
+}
+
 // HandleBatch Handles a set of records.
 func (b *Buffer) HandleBatch(records []*types.Record) {
 	for _, record := range records {
@@ -57,8 +268,39 @@ func (b *Buffer) HandleBatch(records []*types.Record) {
 	}
 }
 
+// Len Get the number of records waiting in the buffer.
+func (b *Buffer) Len() int {
+	return len(b.records)
+}
+
+// HandlerStats Gets the counters of the handler, with the number of queued records.
+func (b *Buffer) HandlerStats() types.HandlerStats {
+	stats := b.Handler.HandlerStats()
+	stats.QueueDepth = b.Len()
+	return stats
+}
+
+// Health Get the number of queued records, and the connectivity of the
+// wrapped handler if it reports its health.
+func (b *Buffer) Health() types.Health {
+	health := types.Health{Connected: true}
+	if hc, ok := b.handler.(types.HealthChecker); ok {
+		health = hc.Health()
+	}
+	health.Backlog += b.Len()
+	return health
+}
+
+// Cap Get the buffer size.
+func (b *Buffer) Cap() int {
+	return cap(b.records)
+}
+
 // Close close
 func (b *Buffer) Close() {
 	b.records <- nil
 	<-b.close
+	if b.spill != nil {
+		b.spill.Close()
+	}
 }
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// coalescer stages the records written by concurrent goroutines in a lock-free
+// stack. The goroutine finding no write in progress becomes the writer: it
+// takes all the staged records and writes them at once, until none is left.
+// The others return as soon as their record is staged.
+type coalescer struct {
+	head    unsafe.Pointer // *staged, the most recent first
+	writing int32
+}
+
+// staged a record waiting for the writer.
+type staged struct {
+	b    []byte
+	next *staged
+}
+
+// write stages b, copied as records are reused, and writes the staged records
+// by flush unless another goroutine is writing them.
+func (c *coalescer) write(b []byte, flush func([]byte) error) error {
+	s := &staged{b: append([]byte(nil), b...)}
+	for {
+		head := atomic.LoadPointer(&c.head)
+		s.next = (*staged)(head)
+		if atomic.CompareAndSwapPointer(&c.head, head, unsafe.Pointer(s)) {
+			break
+		}
+	}
+	return c.drain(flush)
+}
+
+// drain writes the staged records unless another goroutine is writing them.
+// The writer checks the stack again once done, as records staged while it
+// released the writing flag would be left behind otherwise.
+func (c *coalescer) drain(flush func([]byte) error) error {
+	var err error
+	for atomic.LoadPointer(&c.head) != nil && atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+		if e := c.flush(flush); e != nil {
+			err = e
+		}
+		atomic.StoreInt32(&c.writing, 0)
+	}
+	return err
+}
+
+// wait writes the staged records, waiting for the write in progress if any.
+func (c *coalescer) wait(flush func([]byte) error) error {
+	for !atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+		runtime.Gosched()
+	}
+	defer atomic.StoreInt32(&c.writing, 0)
+	return c.flush(flush)
+}
+
+// flush writes the staged records until none is left, being the writer.
+func (c *coalescer) flush(flush func([]byte) error) error {
+	var err error
+	for {
+		head := (*staged)(atomic.SwapPointer(&c.head, nil))
+		if head == nil {
+			return err
+		}
+		if e := flush(c.join(head)); e != nil {
+			err = e
+		}
+	}
+}
+
+// join concatenates the records of a stack in the order they were staged.
+func (c *coalescer) join(head *staged) []byte {
+	size := 0
+	var prev *staged
+	for s := head; s != nil; {
+		size += len(s.b)
+		next := s.next
+		s.next = prev
+		prev, s = s, next
+	}
+	b := make([]byte, 0, size)
+	for s := prev; s != nil; s = s.next {
+		b = append(b, s.b...)
+	}
+	return b
+}
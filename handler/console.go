@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"io"
+	"os"
+	"sync"
+)
+
+// Console handler writes the records of WARNING and above to stderr and the
+// others to stdout, so container platforms tell the streams apart.
+// The writer of each level can be changed before the handler is used.
+type Console struct {
+	Processing
+	sync.Mutex
+
+	Stdout io.Writer
+	Stderr io.Writer
+
+	stderrLevel int
+	writers     map[int]io.Writer
+}
+
+// NewConsole New console handler
+func NewConsole(level int, bubble bool) *Console {
+	return NewConsoleWith(WithLevel(level), WithBubble(bubble))
+}
+
+// NewConsoleWith New console handler configured by options.
+func NewConsoleWith(opts ...Option) *Console {
+	o := newOptions(opts)
+	c := &Console{
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		stderrLevel: types.WARNING,
+		writers:     make(map[int]io.Writer),
+	}
+	o.apply(&c.Handler, c)
+	c.SetFormatter(o.formatter(c))
+	c.Writer = c.Write
+	return c
+}
+
+// SetStderrLevel Set the minimum level of the records written to stderr, defaults to WARNING.
+func (c *Console) SetStderrLevel(level int) *Console {
+	c.stderrLevel = level
+	return c
+}
+
+// SetWriter Writes the records of exactly the given level to w, whatever the stderr level.
+func (c *Console) SetWriter(level int, w io.Writer) *Console {
+	c.writers[level] = w
+	return c
+}
+
+// writer gets the writer of a level.
+func (c *Console) writer(level int) io.Writer {
+	if w, ok := c.writers[level]; ok {
+		return w
+	}
+	if level >= c.stderrLevel {
+		return c.Stderr
+	}
+	return c.Stdout
+}
+
+// Write to the console.
+func (c *Console) Write(record *types.Record) error {
+	c.Lock()
+	_, err := c.writer(record.Level).Write(record.Formatted.Bytes())
+	c.Unlock()
+	if err != nil {
+		c.reportError(err)
+	}
+	return err
+}
+
+// Close nothing to close, the standard streams stay open.
+func (c *Console) Close() {}
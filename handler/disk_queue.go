@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSegmentSize the default size of the segment files of a DiskQueue.
+const DefaultSegmentSize = 16 << 20
+
+// headerSize the size of an entry header: the payload length, the CRC-32 of
+// the rest of the entry and the entry time.
+const headerSize = 16
+
+// ErrCorruptSegment Reported when an entry fails its checksum, the rest of its segment is skipped.
+var ErrCorruptSegment = errors.New("corrupt queue segment")
+
+// ErrEntryTooLarge Returned by DiskQueue.Push for an entry larger than a segment.
+var ErrEntryTooLarge = errors.New("queue entry larger than a segment")
+
+// DiskQueue A persistent FIFO queue of byte entries stored in segment files,
+// so queued records survive restarts without growing the memory.
+// Each entry is stored as its length, CRC-32 and time followed by the payload.
+// The read position is kept in a cursor file, consumed segments are removed.
+type DiskQueue struct {
+	dir         string
+	segmentSize int64
+
+	mu     sync.Mutex
+	w      *os.File
+	wSeg   int
+	wOff   int64
+	r      *os.File
+	rSeg   int
+	rOff   int64
+	next   int64
+	time   time.Time // the time of the entry returned by the last Peek
+	length int
+}
+
+// NewDiskQueue Opens or creates the queue stored in dir.
+// segmentSize: The size at which a new segment file is started (0 means DefaultSegmentSize)
+func NewDiskQueue(dir string, segmentSize int64) (*DiskQueue, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{dir: dir, segmentSize: segmentSize}
+	segs, err := q.segments()
+	if err != nil {
+		return nil, err
+	}
+	q.rSeg, q.rOff = q.readCursor()
+	if len(segs) == 0 {
+		segs = []int{1}
+	}
+	if q.rSeg < segs[0] || q.rSeg > segs[len(segs)-1] {
+		q.rSeg, q.rOff = segs[0], 0
+	}
+	// count the queued entries, cutting a torn write of the last segment
+	for _, seg := range segs {
+		if seg < q.rSeg {
+			os.Remove(q.segmentPath(seg))
+			continue
+		}
+		off := int64(0)
+		if seg == q.rSeg {
+			off = q.rOff
+		}
+		n, end, err := q.scan(seg, off)
+		if err != nil {
+			return nil, err
+		}
+		q.length += n
+		if seg == segs[len(segs)-1] {
+			if err := os.Truncate(q.segmentPath(seg), end); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	q.wSeg = segs[len(segs)-1]
+	if err := q.openWriter(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Push Appends an entry to the queue, dated now.
+func (q *DiskQueue) Push(p []byte) error {
+	return q.PushTime(p, time.Now())
+}
+
+// PushTime Appends an entry dated t to the queue, ErrEntryTooLarge if it is larger than a segment.
+func (q *DiskQueue) PushTime(p []byte, t time.Time) error {
+	if int64(len(p)) > q.segmentSize {
+		return ErrEntryTooLarge
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.w == nil {
+		return os.ErrClosed
+	}
+	if q.wOff > 0 && q.wOff+headerSize+int64(len(p)) > q.segmentSize {
+		q.w.Close()
+		q.wSeg++
+		if err := q.openWriter(); err != nil {
+			return err
+		}
+	}
+	entry := make([]byte, headerSize+len(p))
+	binary.BigEndian.PutUint32(entry, uint32(len(p)))
+	binary.BigEndian.PutUint64(entry[8:], uint64(t.UnixNano()))
+	copy(entry[headerSize:], p)
+	binary.BigEndian.PutUint32(entry[4:], crc32.ChecksumIEEE(entry[8:]))
+	n, err := q.w.Write(entry)
+	q.wOff += int64(n)
+	if err != nil {
+		return err
+	}
+	q.length++
+	return nil
+}
+
+// Peek Gets the oldest entry without removing it, io.EOF if the queue is empty.
+func (q *DiskQueue) Peek() ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.r == nil {
+			r, err := os.Open(q.segmentPath(q.rSeg))
+			if err != nil {
+				return nil, err
+			}
+			q.r = r
+		}
+		p, t, err := q.read(q.r, q.rOff)
+		if err == nil {
+			q.next = q.rOff + headerSize + int64(len(p))
+			q.time = t
+			return p, nil
+		}
+		if err != io.EOF && err != io.ErrUnexpectedEOF && err != ErrCorruptSegment {
+			return nil, err
+		}
+		if q.rSeg >= q.wSeg {
+			return nil, io.EOF
+		}
+		if err == ErrCorruptSegment {
+			return nil, q.skipSegment(err)
+		}
+		q.nextSegment()
+	}
+}
+
+// Pop Removes the entry returned by the last Peek.
+func (q *DiskQueue) Pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.next <= q.rOff {
+		return nil
+	}
+	q.rOff = q.next
+	q.length--
+	return q.writeCursor()
+}
+
+// PeekTime Gets the time of the entry returned by the last Peek, io.EOF if
+// it was popped.
+func (q *DiskQueue) PeekTime() (time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.next <= q.rOff {
+		return time.Time{}, io.EOF
+	}
+	return q.time, nil
+}
+
+// Len Get the number of queued entries.
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length
+}
+
+// Close Syncs and closes the segment files.
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.r != nil {
+		q.r.Close()
+		q.r = nil
+	}
+	if q.w == nil {
+		return nil
+	}
+	err := q.w.Sync()
+	if cerr := q.w.Close(); err == nil {
+		err = cerr
+	}
+	q.w = nil
+	return err
+}
+
+// skipSegment drops the rest of a corrupt segment.
+func (q *DiskQueue) skipSegment(err error) error {
+	n, _, _ := q.scan(q.rSeg, q.rOff)
+	q.length -= n
+	q.nextSegment()
+	return err
+}
+
+// nextSegment removes the consumed read segment and moves to the next one.
+func (q *DiskQueue) nextSegment() {
+	q.r.Close()
+	q.r = nil
+	os.Remove(q.segmentPath(q.rSeg))
+	q.rSeg++
+	q.rOff = 0
+	q.next = 0
+	q.writeCursor()
+}
+
+// read reads the entry at off and its time.
+func (q *DiskQueue) read(f *os.File, off int64) ([]byte, time.Time, error) {
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, time.Time{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if int64(size) > q.segmentSize {
+		return nil, time.Time{}, ErrCorruptSegment
+	}
+	p := make([]byte, size)
+	if _, err := f.ReadAt(p, off+headerSize); err != nil {
+		return nil, time.Time{}, err
+	}
+	crc := crc32.Update(crc32.ChecksumIEEE(header[8:]), crc32.IEEETable, p)
+	if crc != binary.BigEndian.Uint32(header[4:]) {
+		return nil, time.Time{}, ErrCorruptSegment
+	}
+	return p, time.Unix(0, int64(binary.BigEndian.Uint64(header[8:]))), nil
+}
+
+// scan counts the valid entries of a segment from off, returning the end of the last one.
+func (q *DiskQueue) scan(seg int, off int64) (int, int64, error) {
+	f, err := os.Open(q.segmentPath(seg))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	n := 0
+	for {
+		p, _, err := q.read(f, off)
+		if err != nil {
+			return n, off, nil
+		}
+		n++
+		off += headerSize + int64(len(p))
+	}
+}
+
+// openWriter opens the write segment for appending.
+func (q *DiskQueue) openWriter() error {
+	w, err := os.OpenFile(q.segmentPath(q.wSeg), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := w.Stat()
+	if err != nil {
+		w.Close()
+		return err
+	}
+	q.w = w
+	q.wOff = info.Size()
+	return nil
+}
+
+// segments lists the segment numbers in order.
+func (q *DiskQueue) segments() ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(q.dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	segs := make([]int, 0, len(names))
+	for _, name := range names {
+		seg, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(name), ".seg"))
+		if err == nil {
+			segs = append(segs, seg)
+		}
+	}
+	sort.Ints(segs)
+	return segs, nil
+}
+
+func (q *DiskQueue) segmentPath(seg int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%08d.seg", seg))
+}
+
+// readCursor reads the persisted read position.
+func (q *DiskQueue) readCursor() (int, int64) {
+	data, err := ioutil.ReadFile(filepath.Join(q.dir, "cursor"))
+	if err != nil {
+		return 0, 0
+	}
+	var seg int
+	var off int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seg, &off); err != nil {
+		return 0, 0
+	}
+	return seg, off
+}
+
+// writeCursor persists the read position.
+func (q *DiskQueue) writeCursor() error {
+	path := filepath.Join(q.dir, "cursor")
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", q.rSeg, q.rOff)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
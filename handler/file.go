@@ -3,7 +3,9 @@ package handler
 import (
 	"bufio"
 	"errors"
+	"github.com/syyongx/llog/formatter"
 	"github.com/syyongx/llog/types"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -24,10 +26,19 @@ type File struct {
 
 	Path     string
 	FilePerm os.FileMode
-	Fd       *os.File
+	Fd       *os.File // nil unless the file system is OSFS
 	Bufio
+
+	fs        FS
+	fh        FSFile
+	wrapper   func(io.Writer) (io.Writer, error)
+	w         io.Writer
+	coalescer *coalescer
 }
 
+// DefaultBufioSize the bufio buffer size of the files flushed by WithFlushInterval.
+const DefaultBufioSize = 4096
+
 // Bufio struct definition
 type Bufio struct {
 	sync.Mutex
@@ -37,99 +48,268 @@ type Bufio struct {
 	flushMode     FlushMode
 	flushInterval time.Duration
 	ioWriter      *bufio.Writer
+	flushStop     chan struct{}
 }
 
-// NewFile New file handler
+// NewFile New file handler, its formatter must be set by SetFormatter.
 func NewFile(path string, filePerm os.FileMode, level int, bubble bool) *File {
+	return NewFileWith(path, WithPerm(filePerm), WithLevel(level), WithBubble(bubble), withoutFormatter())
+}
+
+// NewFileWith New file handler configured by options.
+func NewFileWith(path string, opts ...Option) *File {
+	o := newOptions(opts)
 	file := &File{
 		Path:     path,
-		FilePerm: filePerm,
+		FilePerm: o.FilePerm,
+		fs:       o.FS,
+		wrapper:  o.Wrapper,
+	}
+	if file.fs == nil {
+		file.fs = OSFS
 	}
-	file.SetLevel(level)
-	file.SetBubble(bubble)
+	if o.Coalesce {
+		file.coalescer = &coalescer{}
+	}
+	o.apply(&file.Handler, file)
+	file.SetFormatter(o.formatter(file))
 	file.Writer = file.Write
+	file.BatchWriter = file.WriteBatch
+	if o.Flush > 0 {
+		size := o.BufferSize
+		if size <= 0 {
+			size = DefaultBufioSize
+		}
+		file.SetBufio(size, FlushModeTicker, o.Flush)
+	}
 
 	return file
 }
 
-// SetBufio Set flush config.
+// NewJSONFile New file handler writing one JSON document per line (NDJSON).
+// The file is created with 0644 permissions and records bubble.
+func NewJSONFile(path string, level int) *File {
+	return NewFileWith(path, WithLevel(level), WithFormatter(formatter.NewJSON(nil, true)))
+}
+
+// SetBufio Set flush config. In FlushModeTicker the buffer is flushed every
+// interval while the file is open, until Close.
 func (f *File) SetBufio(size int, mode FlushMode, interval time.Duration) error {
 	if size < 0 {
 		return errors.New("size invalid")
 	}
+	f.Lock()
+	defer f.Unlock()
 	f.useBufio = true
 	f.bufioSize = size
 	f.flushMode = mode
 	if mode == FlushModeTicker {
-		if interval < time.Second {
+		if interval <= 0 {
 			interval = time.Second
 		}
 		f.flushInterval = interval
-		// async auto flush bufio
-		go f.tickerFlush()
+	}
+	f.stopFlush()
+	if f.w != nil {
+		f.startFlush()
 	}
 
 	return nil
 }
 
 // Write to file.
-func (f *File) Write(record *types.Record) {
+func (f *File) Write(record *types.Record) error {
+	if f.coalescer != nil {
+		return f.coalescer.write(record.Formatted.Bytes(), f.write)
+	}
+	return f.write(record.Formatted.Bytes())
+}
+
+// write formatted records to the file.
+func (f *File) write(b []byte) error {
 	f.Lock()
 	defer f.Unlock()
 
-	if f.Fd == nil {
-		fd, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, f.FilePerm)
-		if err != nil {
-			// ...
-		}
-		f.Fd = fd
-		// use bufio
-		if f.useBufio {
-			if f.ioWriter == nil {
-				f.ioWriter = bufio.NewWriterSize(f.Fd, f.bufioSize)
-			} else {
-				f.ioWriter.Reset(f.Fd)
-			}
+	if f.fh == nil {
+		if err := f.open(); err != nil {
+			return err
 		}
 	}
 	// write
 	var err error
-	b := record.Formatted.Bytes()
 	if f.useBufio {
 		_, err = f.ioWriter.Write(b)
 	} else {
-		_, err = f.Fd.Write(b)
+		_, err = f.w.Write(b)
+	}
+	if err != nil {
+		f.reportError(err)
+	}
+	return err
+}
+
+// WriteBatch Writes records to the file holding the lock once.
+func (f *File) WriteBatch(records []*types.Record) error {
+	if f.useBufio && f.coalescer == nil {
+		f.Lock()
+		defer f.Unlock()
+		if f.fh == nil {
+			if err := f.open(); err != nil {
+				return err
+			}
+		}
+		for _, record := range records {
+			if _, err := f.ioWriter.Write(record.Formatted.Bytes()); err != nil {
+				f.reportError(err)
+				return err
+			}
+		}
+		return nil
+	}
+	buf := joinRecords(records)
+	defer types.PutBuffer(buf)
+	b := buf.Bytes()
+	if f.coalescer != nil {
+		return f.coalescer.write(b, f.write)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	if f.fh == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
 	}
+	_, err := f.w.Write(b)
 	if err != nil {
-		//...
+		f.reportError(err)
 	}
+	return err
 }
 
 // Flush flush
 func (f *File) Flush() (err error) {
+	err = f.drain()
 	if !f.useBufio {
 		return
 	}
 
 	f.Lock()
-	err = f.ioWriter.Flush()
+	if f.ioWriter != nil {
+		if e := f.ioWriter.Flush(); e != nil {
+			err = e
+		}
+	}
 	f.Unlock()
 	return
 }
 
+// drain writes the records staged by the coalescing.
+func (f *File) drain() error {
+	if f.coalescer == nil {
+		return nil
+	}
+	return f.coalescer.wait(f.write)
+}
+
 // Close writer
 func (f *File) Close() {
+	f.CloseErr()
+}
+
+// CloseErr Closes the file, reporting flush and close failures.
+func (f *File) CloseErr() error {
+	err := f.drain()
+	f.Lock()
+	defer f.Unlock()
+	if e := f.close(); e != nil {
+		err = e
+	}
+	return err
+}
+
+// close the file, the lock being held.
+func (f *File) close() error {
+	var err error
 	if f.useBufio && f.ioWriter != nil {
-		f.ioWriter.Flush()
+		err = f.ioWriter.Flush()
+	}
+	if f.fh != nil {
+		if e := f.fh.Close(); e != nil && err == nil {
+			err = e
+		}
 	}
-	f.Fd.Close()
 	f.Fd = nil
+	f.fh = nil
+	f.w = nil
+	f.stopFlush()
+	return err
+}
+
+// open the file, the lock being held.
+func (f *File) open() error {
+	var fh FSFile
+	err := retrySharing(func() (err error) {
+		fh, err = f.fs.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, f.FilePerm)
+		return err
+	})
+	if err != nil {
+		f.reportError(err)
+		return err
+	}
+	f.Fd, _ = fh.(*os.File)
+	f.fh = fh
+	f.w = fh
+	if f.wrapper != nil {
+		w, err := f.wrapper(fh)
+		if err != nil {
+			fh.Close()
+			f.Fd = nil
+			f.fh = nil
+			f.reportError(err)
+			return err
+		}
+		f.w = w
+	}
+	// use bufio
+	if f.useBufio {
+		if f.ioWriter == nil {
+			f.ioWriter = bufio.NewWriterSize(f.w, f.bufioSize)
+		} else {
+			f.ioWriter.Reset(f.w)
+		}
+		f.startFlush()
+	}
+	return nil
 }
 
-// Auto flush
-func (f *File) tickerFlush() {
-	ticker := time.NewTicker(f.flushInterval)
-	for range ticker.C {
-		f.Flush()
+// startFlush starts flushing the bufio buffer every flush interval in
+// FlushModeTicker while the file is open, the lock being held.
+func (f *File) startFlush() {
+	if f.flushMode != FlushModeTicker || f.flushStop != nil {
+		return
+	}
+	f.flushStop = make(chan struct{})
+	go f.tickerFlush(f.GetClock().NewTicker(f.flushInterval), f.flushStop)
+}
+
+// stopFlush stops flushing the bufio buffer, the lock being held.
+func (f *File) stopFlush() {
+	if f.flushStop != nil {
+		close(f.flushStop)
+		f.flushStop = nil
+	}
+}
+
+// Auto flush until stopped.
+func (f *File) tickerFlush(ticker types.Ticker, stop chan struct{}) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			f.Flush()
+		case <-stop:
+			return
+		}
 	}
 }
@@ -25,7 +25,7 @@ func NewFilter(handler types.IHandler, minLevels, maxLevels []int, bubble bool)
 // IsHandling Is Handling
 func (f *Filter) IsHandling(record *types.Record) bool {
 	_, ok := f.acceptedLevels[record.Level]
-	return ok
+	return ok && f.MatchChannel(record.Channel)
 }
 
 // Handle log record
@@ -34,9 +34,12 @@ func (f *Filter) Handle(record *types.Record) bool {
 		return false
 	}
 	if f.processors != nil {
+		record = record.Clone()
+		defer types.ReleaseRecord(record)
 		f.ProcessRecord(record)
 	}
 	f.h.Handle(record)
+	f.count(0)
 
 	return false == f.GetBubble()
 }
@@ -47,6 +50,7 @@ func (f *Filter) HandleBatch(records []*types.Record) {
 	for _, record := range records {
 		if f.IsHandling(record) {
 			filtered = append(filtered, record)
+			f.count(0)
 		}
 	}
 	f.h.HandleBatch(filtered)
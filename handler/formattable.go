@@ -3,7 +3,6 @@ package handler
 import (
 	"github.com/syyongx/llog/formatter"
 	"github.com/syyongx/llog/types"
-	"time"
 )
 
 // Formattable struct definition
@@ -23,5 +22,5 @@ func (f *Formattable) GetFormatter() types.Formatter {
 
 // GetDefaultFormatter Gets the default formatter.
 func (f *Formattable) GetDefaultFormatter() types.Formatter {
-	return formatter.NewLine(formatter.DefaultFormat, time.RFC3339)
+	return formatter.NewLine(formatter.DefaultFormat, "")
 }
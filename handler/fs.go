@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FS Interface of the file systems the file handlers write to, such as an
+// in-memory one for tests or a custom storage. Paths use the OS separator.
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (FSFile, error)
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Stat(name string) (os.FileInfo, error)
+	Glob(pattern string) ([]string, error)
+}
+
+// FSFile Interface of the files opened by an FS.
+type FSFile interface {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// OSFS The file system of the OS, the default of the file handlers.
+var OSFS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (FSFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+func (osFS) Remove(name string) error              { return os.Remove(name) }
+func (osFS) Rename(oldname, newname string) error  { return os.Rename(oldname, newname) }
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+func (osFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+// MemFS An in-memory file system, such as to test file handlers.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+}
+
+type memData struct {
+	data    []byte
+	perm    os.FileMode
+	modTime time.Time
+}
+
+// NewMemFS New in-memory file system.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memData)}
+}
+
+// OpenFile Opens a file, supporting the O_CREATE, O_EXCL, O_TRUNC and O_APPEND flags.
+// Writes are always appended.
+func (m *MemFS) OpenFile(name string, flag int, perm os.FileMode) (FSFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case !ok:
+		d = &memData{perm: perm, modTime: time.Now()}
+		m.files[name] = d
+	case flag&os.O_TRUNC != 0:
+		d.data = nil
+	}
+	return &memFile{fs: m, d: d, name: name}, nil
+}
+
+// Remove Removes a file.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// Rename Renames a file, replacing newname.
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = d
+	return nil
+}
+
+// Stat Gets the info of a file.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memInfo{name: filepath.Base(name), size: int64(len(d.data)), perm: d.perm, modTime: d.modTime}, nil
+}
+
+// Glob Gets the names of the files matching the pattern, in order.
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.files {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ReadFile Gets the content of a file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), d.data...), nil
+}
+
+type memFile struct {
+	fs     *MemFS
+	d      *memData
+	name   string
+	off    int
+	closed bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.off >= len(f.d.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[f.off:])
+	f.off += n
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	f.d.data = append(f.d.data, p...)
+	f.d.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return errors.New("close " + f.name + ": file already closed")
+	}
+	f.closed = true
+	return nil
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	perm    os.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() os.FileMode  { return i.perm }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() interface{}   { return nil }
@@ -2,28 +2,72 @@
 package handler
 
 import (
+	"fmt"
 	"github.com/syyongx/llog/types"
+	"path"
+	"sync/atomic"
+	"time"
 )
 
 // Handler struct definition
 type Handler struct {
-	level  int
-	bubble bool
+	handled   uint64
+	bytes     uint64
+	errors    uint64
+	lastError int64 // unix nanoseconds
+
+	level    int32
+	bubble   bool
+	name     string
+	clock    types.Clock
+	channels []string
 }
 
 // IsHandling Checks whether the given record will be handled by this handler.
+// The events logged by Logger.Event are handled whatever their level.
 func (h *Handler) IsHandling(record *types.Record) bool {
-	return record.Level >= h.level
+	return (record.Level >= h.GetLevel() || types.EventOf(record) != nil) && h.MatchChannel(record.Channel)
+}
+
+// SetChannels Only handle the records of the channels matching one of the
+// patterns, in the path.Match syntax such as "db.*". No patterns handle all.
+func (h *Handler) SetChannels(patterns ...string) {
+	h.channels = patterns
+}
+
+// GetChannels Get the channel patterns.
+func (h *Handler) GetChannels() []string {
+	return h.channels
+}
+
+// MatchChannel Checks whether the records of a channel are handled.
+func (h *Handler) MatchChannel(channel string) bool {
+	if len(h.channels) == 0 {
+		return true
+	}
+	for _, pattern := range h.channels {
+		if ok, _ := path.Match(pattern, channel); ok {
+			return true
+		}
+	}
+	return false
 }
 
-// SetLevel Set level
+// SetLevel Set level, it may be changed while records are handled.
 func (h *Handler) SetLevel(level int) {
-	h.level = level
+	atomic.StoreInt32(&h.level, int32(level))
+}
+
+// forwardLevel Sets the level of the handler wrapped by another, if it has one.
+func forwardLevel(handler types.IHandler, level int) {
+	if s, ok := handler.(interface{ SetLevel(int) }); ok {
+		s.SetLevel(level)
+	}
 }
 
 // GetLevel Get level
 func (h *Handler) GetLevel() int {
-	return h.level
+	return int(atomic.LoadInt32(&h.level))
 }
 
 // SetBubble Set bubble
@@ -35,3 +79,73 @@ func (h *Handler) SetBubble(bubble bool) {
 func (h *Handler) GetBubble() bool {
 	return h.bubble
 }
+
+// SetClock Set the clock of time-based behaviours.
+func (h *Handler) SetClock(clock types.Clock) {
+	h.clock = clock
+}
+
+// GetClock Get the clock, the system clock if none was set.
+func (h *Handler) GetClock() types.Clock {
+	if h.clock == nil {
+		return types.SystemClock
+	}
+	return h.clock
+}
+
+// result the result of a handled record, stopping the chain unless the handler bubbles.
+func (h *Handler) result() types.Result {
+	if h.bubble {
+		return types.Result{Action: types.Handled}
+	}
+	return types.Result{Action: types.Stop}
+}
+
+// GetName Get the name the handler reports metrics under, its type such as "*handler.File".
+func (h *Handler) GetName() string {
+	return h.name
+}
+
+// HandlerStats Gets the counters of the handler.
+func (h *Handler) HandlerStats() types.HandlerStats {
+	stats := types.HandlerStats{
+		Handled: atomic.LoadUint64(&h.handled),
+		Bytes:   atomic.LoadUint64(&h.bytes),
+		Errors:  atomic.LoadUint64(&h.errors),
+	}
+	if last := atomic.LoadInt64(&h.lastError); last != 0 {
+		stats.LastErrorTime = time.Unix(0, last)
+	}
+	return stats
+}
+
+// count counts a handled record of n bytes.
+func (h *Handler) count(n int) {
+	atomic.AddUint64(&h.handled, 1)
+	if n > 0 {
+		atomic.AddUint64(&h.bytes, uint64(n))
+	}
+}
+
+// reportError reports a failed record to the metrics hook and the internal channel.
+func (h *Handler) reportError(err error) {
+	atomic.AddUint64(&h.errors, 1)
+	atomic.StoreInt64(&h.lastError, h.GetClock().Now().UnixNano())
+	if m := types.Metrics(); m != nil {
+		m.HandlerError(h.name, err)
+		m.RecordDropped(h.name)
+	}
+	types.Internal(types.WARNING, "record dropped", types.RecordContext{"handler": h.name, "error": err.Error()})
+}
+
+// reportLatency reports the time taken to handle a record since start.
+func (h *Handler) reportLatency(start time.Time) {
+	if m := types.Metrics(); m != nil {
+		m.HandlerLatency(h.name, time.Since(start))
+	}
+}
+
+// handlerName the name of a handler reported to the metrics hook.
+func handlerName(h interface{}) string {
+	return fmt.Sprintf("%T", h)
+}
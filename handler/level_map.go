@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+)
+
+// LevelMap routes records to different handlers by level, such as DEBUG to
+// stdout, ERROR to a file and CRITICAL and above to a pager. A record is passed
+// to every handler whose level or range matches it.
+// Routes are set up before the handler is used.
+type LevelMap struct {
+	Handler
+
+	routes []levelRoute
+}
+
+type levelRoute struct {
+	min     int
+	max     int
+	handler types.IHandler
+}
+
+// NewLevelMap New level map handler
+// bubble: Whether the messages that are handled can bubble up the stack or not
+func NewLevelMap(bubble bool) *LevelMap {
+	m := &LevelMap{}
+	m.SetBubble(bubble)
+	m.name = handlerName(m)
+	return m
+}
+
+// Set Routes the records of exactly the given level to handler.
+func (m *LevelMap) Set(level int, handler types.IHandler) *LevelMap {
+	return m.SetRange(level, level, handler)
+}
+
+// SetRange Routes the records from level min to max inclusive to handler,
+// use types.EMERGENCY as max for open ended ranges.
+func (m *LevelMap) SetRange(min, max int, handler types.IHandler) *LevelMap {
+	m.routes = append(m.routes, levelRoute{min: min, max: max, handler: handler})
+	return m
+}
+
+// IsHandling Checks whether a route matches the level of the record.
+func (m *LevelMap) IsHandling(record *types.Record) bool {
+	if !m.MatchChannel(record.Channel) {
+		return false
+	}
+	for _, r := range m.routes {
+		if r.min <= record.Level && record.Level <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle Passes the record to the handlers of the matching routes.
+func (m *LevelMap) Handle(record *types.Record) bool {
+	if !m.MatchChannel(record.Channel) {
+		return false
+	}
+	handled := false
+	for _, r := range m.routes {
+		if r.min <= record.Level && record.Level <= r.max {
+			r.handler.Handle(record)
+			handled = true
+		}
+	}
+	if !handled {
+		return false
+	}
+	m.count(0)
+	return false == m.GetBubble()
+}
+
+// HandleBatch Handles a set of records.
+func (m *LevelMap) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		m.Handle(record)
+	}
+}
+
+// Flush Flushes the routed handlers that buffer writes.
+func (m *LevelMap) Flush() error {
+	var err error
+	for _, h := range m.handlers() {
+		if f, ok := h.(types.Flusher); ok {
+			if e := f.Flush(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Close Closes the routed handlers, once each.
+func (m *LevelMap) Close() {
+	for _, h := range m.handlers() {
+		h.Close()
+	}
+}
+
+// handlers the distinct routed handlers.
+func (m *LevelMap) handlers() []types.IHandler {
+	seen := make(map[types.IHandler]bool, len(m.routes))
+	hs := make([]types.IHandler, 0, len(m.routes))
+	for _, r := range m.routes {
+		if !seen[r.handler] {
+			seen[r.handler] = true
+			hs = append(hs, r.handler)
+		}
+	}
+	return hs
+}
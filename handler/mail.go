@@ -1,13 +1,18 @@
 package handler
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/syyongx/llog/types"
+	"net"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 )
 
 // Mail handler struct definition
+// Sending blocks the logging goroutine, for the retries as well, so it should
+// sit behind a Buffer.
 type Mail struct {
 	Processing
 
@@ -21,15 +26,24 @@ type Mail struct {
 	contentType string // The Content-type for the message
 	encoding    string // The encoding for the message
 	auth        smtp.Auth
+	tls         *tls.Config
+	dialer      Dialer
+	retry       Retry
 }
 
-// NewMail new mail handler
+// NewMail new mail handler, its formatter must be set by SetFormatter.
 func NewMail(address, username, password, from, subject string, to []string, level int, bubble bool) *Mail {
+	return NewMailWith(address, username, password, from, subject, to, WithLevel(level), WithBubble(bubble), withoutFormatter())
+}
+
+// NewMailWith new mail handler configured by options.
+func NewMailWith(address, username, password, from, subject string, to []string, opts ...Option) *Mail {
+	o := newOptions(opts)
 	auth := smtp.PlainAuth(
 		"",
 		username,
 		password,
-		strings.Split(address, ":")[0],
+		hostOf(address),
 	)
 	mail := &Mail{
 		Addr:     address,
@@ -39,15 +53,23 @@ func NewMail(address, username, password, from, subject string, to []string, lev
 		From:     from,
 		To:       to,
 		auth:     auth,
+		tls:      o.TLS,
+		dialer:   o.Dialer,
 	}
-	mail.SetLevel(level)
-	mail.SetBubble(bubble)
+	if o.Retry != nil {
+		mail.retry = *o.Retry
+		if mail.retry.Retryable == nil {
+			mail.retry.Retryable = isMailRetryable
+		}
+	}
+	o.apply(&mail.Handler, mail)
+	mail.SetFormatter(o.formatter(mail))
 	mail.Writer = mail.Write
 	return mail
 }
 
 // Write to network.
-func (m *Mail) Write(record *types.Record) {
+func (m *Mail) Write(record *types.Record) error {
 	message := fmt.Sprintf("To: %v\r\nFrom: %v\r\nSubject: %v\r\nContent-Type: %v; charset=%v\r\n\r\n%v",
 		strings.Join(m.To, ";"),
 		m.From,
@@ -56,12 +78,98 @@ func (m *Mail) Write(record *types.Record) {
 		m.Encoding(),
 		record.Formatted.String(),
 	)
-	err := smtp.SendMail(m.Addr, m.auth, m.From, m.To, []byte(message))
+	err := m.retry.Do(m.GetClock(), func() error {
+		if m.tls != nil || m.dialer != nil {
+			return m.send([]byte(message))
+		}
+		return smtp.SendMail(m.Addr, m.auth, m.From, m.To, []byte(message))
+	})
+	if err != nil {
+		m.reportError(err)
+	}
+	return err
+}
+
+// isMailRetryable reports the network errors and the transient SMTP replies, the 4xx codes.
+func isMailRetryable(err error) bool {
+	if e, ok := err.(*textproto.Error); ok {
+		return e.Code/100 == 4
+	}
+	return IsRetryable(err)
+}
+
+// hostOf Gets the host of an address, such as "[::1]:25", the address itself without a port.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
-		// ...
+		return addr
 	}
+	return host
 }
 
+// send sends a message through the handler's dialer, requiring STARTTLS if
+// the handler has a TLS config, using it when offered otherwise.
+func (m *Mail) send(message []byte) error {
+	host := hostOf(m.Addr)
+	var conn net.Conn
+	var err error
+	if m.dialer != nil {
+		conn, err = m.dialer.Dial("tcp", m.Addr)
+	} else {
+		conn, err = net.Dial("tcp", m.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	config := m.tls
+	if config == nil {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			config = &tls.Config{ServerName: host}
+		}
+	} else if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = host
+	}
+	if config != nil {
+		if err := c.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Close nothing to close, every record is sent with its own connection.
+func (m *Mail) Close() {}
+
 // SetContentType Set the content type of the email - Defaults to text/plain. Use text/html for HTML
 func (m *Mail) SetContentType(contentType string) {
 	m.contentType = contentType
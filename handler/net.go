@@ -1,11 +1,31 @@
 package handler
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"github.com/syyongx/llog/types"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStale Reported for the records given up on by the write budget of a handler.
+var ErrStale = errors.New("record too stale to send")
+
+// The endpoint selections of Net.
+const (
+	// SelectFailover connects to the first reachable endpoint in order.
+	SelectFailover = iota
+	// SelectRoundRobin connects to the endpoints in turn, skipping unreachable ones.
+	SelectRoundRobin
 )
 
 // Net handler struct definition
+// Host names are resolved again on each connection, so a persistent handler
+// follows the DNS changes once reconnected.
 type Net struct {
 	Processing
 
@@ -13,60 +33,358 @@ type Net struct {
 	// "udp", "udp4" (IPv4-only), "udp6" (IPv6-only), "ip", "ip4"
 	// (IPv4-only), "ip6" (IPv6-only), "unix", "unixgram" and
 	// "unixpacket".
-	Network    string
-	Address    string
+	Network string
+	// Address may be prefixed by its network, overriding Network, such as
+	// "unix:///var/run/collector.sock" or "udp://127.0.0.1:514".
+	Address string
+	// Endpoints the addresses connected to instead of Address if not empty,
+	// chosen by Selection.
+	Endpoints  []string
+	Selection  int
 	Persistent bool
-	BufferSize int
-	conn       net.Conn
+	// KeepAlive the period of the TCP keep-alive probes, 0 uses the system
+	// default and a negative period disables them.
+	KeepAlive time.Duration
+	// IdleTimeout reconnects a persistent handler unused for that long, as
+	// NATs and firewalls drop idle connections silently. 0 never reconnects.
+	IdleTimeout time.Duration
+	BufferSize  int
+	// TLS secures the stream connections if set.
+	TLS *tls.Config
+	// Dialer connects the handler if set, such as through a proxy.
+	Dialer Dialer
+	// Retry the retry policy of Send, which tries once by default. The
+	// retries block the logging goroutine, see WithRetry.
+	Retry Retry
+
+	// connMu guards the connection and the endpoint selection, held across
+	// each send
+	connMu sync.Mutex
+	conn   net.Conn
+	next   int // the endpoint tried first by the next connection
+	used   time.Time
+
+	budget   time.Duration
+	fallback types.IHandler
+	stale    uint64
+
+	mu            sync.Mutex
+	failed        bool
+	lastErr       error
+	lastErrorTime time.Time
 }
 
-// NewNet new net handler
+// NewNet new net handler, its formatter must be set by SetFormatter.
 func NewNet(bufferSize int, persistent bool, level int, bubble bool) *Net {
+	return NewNetWith("", "", WithBufferSize(bufferSize), WithPersistent(persistent), WithLevel(level), WithBubble(bubble), withoutFormatter())
+}
+
+// NewNetWith new net handler configured by options.
+func NewNetWith(network, address string, opts ...Option) *Net {
+	o := newOptions(opts)
 	n := &Net{
-		BufferSize: bufferSize,
-		Persistent: persistent,
+		Network:     network,
+		Address:     address,
+		BufferSize:  o.BufferSize,
+		Persistent:  o.Persistent,
+		TLS:         o.TLS,
+		Dialer:      o.Dialer,
+		Endpoints:   o.Endpoints,
+		Selection:   o.Selection,
+		KeepAlive:   o.KeepAlive,
+		IdleTimeout: o.IdleTimeout,
+		budget:      o.Budget,
+		fallback:    o.Fallback,
 	}
-	n.SetLevel(level)
-	n.SetBubble(bubble)
+	if o.Retry != nil {
+		n.Retry = *o.Retry
+	}
+	o.apply(&n.Handler, n)
+	n.SetFormatter(o.formatter(n))
 	n.Writer = n.Write
+	n.BatchWriter = n.WriteBatch
 	return n
 }
 
 // Write to network.
-func (n *Net) Write(record *types.Record) {
-	if !n.Persistent {
-		if err := n.connect(); err != nil {
-			//
+// With a write budget, records not sent within the budget of their time, or
+// of the deadline of their context if sooner, go to the fallback handler.
+func (n *Net) Write(record *types.Record) error {
+	var deadline time.Time
+	if n.budget > 0 {
+		deadline = record.Datetime.Add(n.budget)
+		if record.Ctx != nil {
+			// the context deadline is on the system clock
+			if d, ok := record.Ctx.Deadline(); ok {
+				if d = n.GetClock().Now().Add(time.Until(d)); d.Before(deadline) {
+					deadline = d
+				}
+			}
+		}
+	}
+	err := n.SendDeadline(record.Formatted.Bytes(), deadline)
+	if err != nil && !deadline.IsZero() && (err == ErrStale || isTimeout(err)) {
+		return n.abandon(record)
+	}
+	if err != nil {
+		n.reportError(err)
+	}
+	return err
+}
+
+// WriteBatch Sends records at once, in a single vectored write on stream
+// connections and a datagram each otherwise. Records are written one by one
+// with a write budget, as each has its own deadline.
+func (n *Net) WriteBatch(records []*types.Record) error {
+	if n.budget > 0 {
+		var err error
+		for _, record := range records {
+			if e := n.Write(record); e != nil {
+				err = e
+			}
+		}
+		return err
+	}
+	bufs := make([][]byte, len(records))
+	for i, record := range records {
+		bufs[i] = record.Formatted.Bytes()
+	}
+	err := n.Retry.Do(n.GetClock(), func() error {
+		return n.send(bufs, time.Time{})
+	})
+	if err != nil {
+		n.reportError(err)
+	}
+	return err
+}
+
+// Send Sends formatted records, connecting first if needed.
+// Failed sends are retried by the retry policy.
+func (n *Net) Send(p []byte) error {
+	return n.SendDeadline(p, time.Time{})
+}
+
+// SendDeadline Sends formatted records, giving up with ErrStale once the
+// deadline passed, the zero time never gives up.
+func (n *Net) SendDeadline(p []byte, deadline time.Time) error {
+	return n.Retry.Do(n.GetClock(), func() error {
+		return n.send([][]byte{p}, deadline)
+	})
+}
+
+// Stale Get the number of records given up on by the write budget.
+func (n *Net) Stale() uint64 {
+	return atomic.LoadUint64(&n.stale)
+}
+
+// abandon passes a record given up on to the fallback, or drops it.
+func (n *Net) abandon(record *types.Record) error {
+	atomic.AddUint64(&n.stale, 1)
+	if n.fallback != nil {
+		n.fallback.Handle(record)
+		return nil
+	}
+	n.reportError(ErrStale)
+	return ErrStale
+}
+
+// isTimeout Whether err is a network timeout.
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// send sends formatted records once.
+func (n *Net) send(bufs [][]byte, deadline time.Time) error {
+	now := n.GetClock().Now()
+	var timeout time.Duration
+	if !deadline.IsZero() {
+		if timeout = deadline.Sub(now); timeout <= 0 {
+			return ErrStale
+		}
+	}
+	n.connMu.Lock()
+	defer n.connMu.Unlock()
+	if n.Persistent && n.conn != nil && n.IdleTimeout > 0 && now.Sub(n.used) >= n.IdleTimeout {
+		n.closeConn()
+	}
+	if !n.Persistent || n.conn == nil {
+		if err := n.connect(timeout); err != nil {
+			n.fail(err)
+			return err
 		}
-		defer n.conn.Close()
 	}
-	_, err := n.conn.Write(record.Formatted.Bytes())
+	if !n.Persistent {
+		defer n.closeConn()
+	}
+	// the deadline is on the clock of the records, the connection on the system's
+	var writeDeadline time.Time
+	if timeout > 0 {
+		writeDeadline = time.Now().Add(timeout)
+	}
+	n.conn.SetWriteDeadline(writeDeadline)
+	err := write(n.conn, bufs)
 	if err != nil {
-		//
+		if n.Persistent {
+			// reconnect on the next record
+			n.closeConn()
+		}
+		n.fail(err)
+		return err
+	}
+	n.used = now
+	n.succeed()
+	return nil
+}
+
+// write buffers to conn, each in its own datagram on packet connections, in
+// a single vectored write otherwise. The buffers are left untouched.
+func write(conn net.Conn, bufs [][]byte) error {
+	switch conn.LocalAddr().Network() {
+	case "udp", "udp4", "udp6", "unixgram", "ip", "ip4", "ip6":
+		for _, b := range bufs {
+			if _, err := conn.Write(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// WriteTo consumes the buffers
+	v := append(net.Buffers(nil), bufs...)
+	_, err := v.WriteTo(conn)
+	return err
+}
+
+// Health Get the connectivity of the handler.
+// A non persistent handler is connected if its last write succeeded.
+func (n *Net) Health() types.Health {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return types.Health{
+		Connected:     !n.failed,
+		LastError:     n.lastErr,
+		LastErrorTime: n.lastErrorTime,
+	}
+}
+
+// fail records a failed write.
+func (n *Net) fail(err error) {
+	n.mu.Lock()
+	n.failed = true
+	n.lastErr = err
+	n.lastErrorTime = n.GetClock().Now()
+	n.mu.Unlock()
+}
+
+// succeed records a successful write, logging the reconnection after a failure.
+func (n *Net) succeed() {
+	n.mu.Lock()
+	failed := n.failed
+	n.failed = false
+	n.mu.Unlock()
+	if failed {
+		types.Internal(types.WARNING, "reconnected", types.RecordContext{"handler": n.name, "address": n.Address})
 	}
 }
 
-// Close connect.
+// Close connect, and the fallback handler.
 func (n *Net) Close() {
-	if n.Persistent {
-		n.conn.Close()
+	n.CloseErr()
+	if n.fallback != nil {
+		n.fallback.Close()
 	}
 }
 
-// connect
-func (n *Net) connect() error {
-	if n.conn != nil {
-		n.Close()
-		n.conn = nil
+// CloseErr Closes the persistent connection, reporting close failures.
+func (n *Net) CloseErr() error {
+	n.connMu.Lock()
+	defer n.connMu.Unlock()
+	return n.closeConn()
+}
+
+// closeConn closes the connection if any, the connection lock being held.
+func (n *Net) closeConn() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// connect to the first reachable endpoint, within timeout if not zero,
+// the connection lock being held.
+func (n *Net) connect(timeout time.Duration) error {
+	n.closeConn()
+	if len(n.Endpoints) == 0 {
+		return n.dial(n.Address, timeout)
+	}
+	start := 0
+	if n.Selection == SelectRoundRobin {
+		start = n.next % len(n.Endpoints)
+	}
+	var err error
+	for i := range n.Endpoints {
+		k := (start + i) % len(n.Endpoints)
+		if err = n.dial(n.Endpoints[k], timeout); err == nil {
+			n.next = k + 1
+			return nil
+		}
+		types.Internal(types.WARNING, "endpoint unreachable", types.RecordContext{"handler": n.name, "address": n.Endpoints[k], "error": err.Error()})
+	}
+	return err
+}
+
+// dial connects to the address, the connection lock being held.
+func (n *Net) dial(address string, timeout time.Duration) error {
+	network, address := SplitAddress(n.Network, address)
+	var conn net.Conn
+	var err error
+	if n.Dialer != nil {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		conn, err = dialContext(ctx, n.Dialer, network, address)
+	} else if timeout > 0 {
+		conn, err = net.DialTimeout(network, address, timeout)
+	} else {
+		conn, err = net.Dial(network, address)
 	}
-	conn, err := net.Dial(n.Network, n.Address)
 	if err != nil {
 		return err
 	}
 	if tcp, ok := conn.(*net.TCPConn); ok {
-		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlive(n.KeepAlive >= 0)
+		if n.KeepAlive > 0 {
+			tcp.SetKeepAlivePeriod(n.KeepAlive)
+		}
+	}
+	if n.TLS != nil {
+		config := n.TLS
+		if config.ServerName == "" && !config.InsecureSkipVerify {
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
 	}
 
 	n.conn = conn
 	return nil
 }
+
+// SplitAddress Splits the network prefix off an address such as
+// "unixgram:///dev/log", the network defaults to def.
+func SplitAddress(def, address string) (network, addr string) {
+	if i := strings.Index(address, "://"); i > 0 {
+		return address[:i], address[i+3:]
+	}
+	return def, address
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"crypto/tls"
+	"github.com/syyongx/llog/types"
+	"io"
+	"os"
+	"time"
+)
+
+// Options holds the settings shared by the handler constructors.
+// Settings that do not apply to a handler are ignored by it.
+type Options struct {
+	Level       int
+	Bubble      bool
+	Formatter   types.Formatter
+	FilePerm    os.FileMode
+	BufferSize  int
+	Persistent  bool
+	Clock       types.Clock
+	Overflow    int
+	Spill       types.IHandler
+	TLS         *tls.Config
+	Dialer      Dialer
+	Wrapper     func(io.Writer) (io.Writer, error)
+	FS          FS
+	Channels    []string
+	Flush       time.Duration
+	Batching    Batching
+	Retry       *Retry
+	Endpoints   []string
+	Selection   int
+	KeepAlive   time.Duration
+	IdleTimeout time.Duration
+	Budget      time.Duration
+	Fallback    types.IHandler
+	MaxAge      time.Duration
+	Coalesce    bool
+	Adaptive    *Adaptive
+
+	noFormatter bool
+}
+
+// Option configures a handler.
+type Option func(*Options)
+
+// WithLevel The minimum logging level at which the handler will be triggered, defaults to DEBUG.
+func WithLevel(level int) Option {
+	return func(o *Options) {
+		o.Level = level
+	}
+}
+
+// WithBubble Whether the messages that are handled can bubble up the stack or not, defaults to true.
+func WithBubble(bubble bool) Option {
+	return func(o *Options) {
+		o.Bubble = bubble
+	}
+}
+
+// WithFormatter Set the formatter, defaults to the handler's default formatter.
+func WithFormatter(formatter types.Formatter) Option {
+	return func(o *Options) {
+		o.Formatter = formatter
+	}
+}
+
+// WithPerm Set the permissions of created files, defaults to 0644.
+func WithPerm(perm os.FileMode) Option {
+	return func(o *Options) {
+		o.FilePerm = perm
+	}
+}
+
+// WithBufferSize Set the buffer size of buffered handlers.
+func WithBufferSize(size int) Option {
+	return func(o *Options) {
+		o.BufferSize = size
+	}
+}
+
+// WithPersistent Whether network connections are kept open between records.
+func WithPersistent(persistent bool) Option {
+	return func(o *Options) {
+		o.Persistent = persistent
+	}
+}
+
+// WithClock Set the clock of time-based behaviours such as rotation and
+// flush intervals, defaults to the system clock.
+func WithClock(clock types.Clock) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// WithOverflow Set the policy of a full buffer, defaults to OverflowBlock.
+// spill: The handler receiving the overflow of OverflowSpill, without it the buffer blocks.
+func WithOverflow(policy int, spill types.IHandler) Option {
+	return func(o *Options) {
+		o.Overflow = policy
+		o.Spill = spill
+	}
+}
+
+// WithTLS Secure the connections of network handlers, see TLSConfig.
+func WithTLS(config *tls.Config) Option {
+	return func(o *Options) {
+		o.TLS = config
+	}
+}
+
+// WithDialer Set the dialer of network handlers, such as a proxy dialer, defaults to net.Dial.
+func WithDialer(dialer Dialer) Option {
+	return func(o *Options) {
+		o.Dialer = dialer
+	}
+}
+
+// WithFlushInterval Flushes buffered handlers every interval, even when few
+// records are written: File handlers write through a bufio buffer of the
+// WithBufferSize size, 4096 bytes by default, Buffer handlers flush the
+// wrapped handler when it implements types.Flusher.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.Flush = interval
+	}
+}
+
+// WithChannels Only handle the records of the channels matching one of the patterns, see Handler.SetChannels.
+func WithChannels(patterns ...string) Option {
+	return func(o *Options) {
+		o.Channels = patterns
+	}
+}
+
+// WithFS Set the file system of File and RotatingFile handlers, defaults to OSFS.
+// PreallocFile always uses the OS files.
+func WithFS(fs FS) Option {
+	return func(o *Options) {
+		o.FS = fs
+	}
+}
+
+// WithWrapper Wraps the writers of the files opened by file handlers, such as
+// to encrypt them with crypt.Wrapper.
+func WithWrapper(wrapper func(io.Writer) (io.Writer, error)) Option {
+	return func(o *Options) {
+		o.Wrapper = wrapper
+	}
+}
+
+// WithEndpoints Set the addresses of network handlers, chosen by selection
+// such as SelectFailover.
+func WithEndpoints(selection int, addresses ...string) Option {
+	return func(o *Options) {
+		o.Selection = selection
+		o.Endpoints = addresses
+	}
+}
+
+// WithKeepAlive Set the period of the TCP keep-alive probes of network
+// handlers, a negative period disables them.
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *Options) {
+		o.KeepAlive = period
+	}
+}
+
+// WithIdleTimeout Reconnects the persistent network handlers unused for timeout.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// WithWriteBudget Gives up on the records a network handler did not send
+// within budget of their time, passing them to fallback or dropping them if nil.
+func WithWriteBudget(budget time.Duration, fallback types.IHandler) Option {
+	return func(o *Options) {
+		o.Budget = budget
+		o.Fallback = fallback
+	}
+}
+
+// WithMaxAge Drops the records older than maxAge when queued handlers, such as
+// Buffer and Spool, drain a backlog, preferring recent records after an outage.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(o *Options) {
+		o.MaxAge = maxAge
+	}
+}
+
+// WithCoalescing Stages the records written concurrently to file handlers in a
+// lock-free queue, written at once by one of the writing goroutines, instead
+// of taking the file lock and writing each record. Improves the throughput of
+// many goroutines logging at once, write errors are reported to the writing
+// goroutine only.
+func WithCoalescing() Option {
+	return func(o *Options) {
+		o.Coalesce = true
+	}
+}
+
+// withoutFormatter Leaves the formatter unset unless set by WithFormatter, as
+// the positional constructors of File, Mail and Net always did.
+func withoutFormatter() Option {
+	return func(o *Options) {
+		o.noFormatter = true
+	}
+}
+
+// newOptions returns the default options overridden by opts.
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		Level:    types.DEBUG,
+		Bubble:   true,
+		FilePerm: 0644,
+		Clock:    types.SystemClock,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// formatter Gets the formatter set by WithFormatter, the default formatter of
+// h if none, nil with withoutFormatter.
+func (o *Options) formatter(h interface{ GetDefaultFormatter() types.Formatter }) types.Formatter {
+	if o.Formatter != nil || o.noFormatter {
+		return o.Formatter
+	}
+	return h.GetDefaultFormatter()
+}
+
+// apply the level and bubble settings to the Handler embedded in concrete.
+func (o *Options) apply(h *Handler, concrete interface{}) {
+	h.SetLevel(o.Level)
+	h.SetBubble(o.Bubble)
+	h.SetClock(o.Clock)
+	h.SetChannels(o.Channels...)
+	h.name = handlerName(concrete)
+}
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"errors"
+	"github.com/syyongx/llog/types"
+	"os"
+	"sync"
+)
+
+// default sizes of the preallocated file
+const (
+	DefaultPreallocSize int64 = 64 << 20
+	DefaultBlockSize    int   = 4096
+)
+
+// PreallocFile handler.
+// A high-performance file handler for services writing hundreds of MB/s.
+// The file is grown ahead of the writes in preallocSize steps, and records
+// are staged in memory and written out in block aligned chunks with WriteAt,
+// so the number of write and metadata syscalls stays low. On Linux the blocks
+// of each step are allocated with fallocate, so a full disk fails the growth
+// instead of a later write. Elsewhere, or on file systems without fallocate,
+// the file is only extended and stays sparse on most file systems. The file
+// is not memory-mapped: the aligned writes save as many syscalls, without the
+// platform specific mapping code, and a full disk fails a write instead of
+// raising SIGBUS on a page fault.
+//
+// The file is truncated to the written size when the handler is closed.
+// After a crash the file may end with zero bytes up to the preallocated size,
+// they are skipped when the file is opened again.
+//
+// As the partial last block is rewritten in place, the files can't be wrapped,
+// WithWrapper and WithFS are not supported.
+type PreallocFile struct {
+	Processing
+	sync.Mutex
+
+	Path     string
+	FilePerm os.FileMode
+	Fd       *os.File
+
+	preallocSize int64
+	blockSize    int
+	chunk        []byte
+	offset       int64 // block aligned offset of the first byte in chunk
+	allocated    int64 // current size of the file on disk
+}
+
+// NewPreallocFile New preallocated file handler
+// preallocSize: the file is grown by this many bytes at a time, 0 uses DefaultPreallocSize.
+// chunkSize: bytes staged before a write, rounded up to a multiple of DefaultBlockSize.
+func NewPreallocFile(path string, filePerm os.FileMode, preallocSize int64, chunkSize, level int, bubble bool) *PreallocFile {
+	return NewPreallocFileWith(path, preallocSize, WithBufferSize(chunkSize), WithPerm(filePerm), WithLevel(level), WithBubble(bubble))
+}
+
+// NewPreallocFileWith New preallocated file handler configured by options.
+// The chunk size is set by WithBufferSize.
+func NewPreallocFileWith(path string, preallocSize int64, opts ...Option) *PreallocFile {
+	o := newOptions(opts)
+	chunkSize := o.BufferSize
+	if preallocSize <= 0 {
+		preallocSize = DefaultPreallocSize
+	}
+	if chunkSize <= 0 {
+		chunkSize = 256 * DefaultBlockSize
+	}
+	if r := chunkSize % DefaultBlockSize; r != 0 {
+		chunkSize += DefaultBlockSize - r
+	}
+	pf := &PreallocFile{
+		Path:         path,
+		FilePerm:     o.FilePerm,
+		preallocSize: preallocSize,
+		blockSize:    DefaultBlockSize,
+		chunk:        make([]byte, 0, chunkSize),
+	}
+	o.apply(&pf.Handler, pf)
+	pf.SetFormatter(o.formatter(pf))
+	pf.Writer = pf.Write
+
+	return pf
+}
+
+// Write to file.
+func (pf *PreallocFile) Write(record *types.Record) error {
+	pf.Lock()
+	defer pf.Unlock()
+
+	if pf.Fd == nil {
+		if err := pf.open(); err != nil {
+			pf.reportError(err)
+			return err
+		}
+	}
+	b := record.Formatted.Bytes()
+	for len(b) > 0 {
+		n := copy(pf.chunk[len(pf.chunk):cap(pf.chunk)], b)
+		pf.chunk = pf.chunk[:len(pf.chunk)+n]
+		b = b[n:]
+		if len(pf.chunk) == cap(pf.chunk) {
+			if err := pf.writeChunk(); err != nil {
+				pf.reportError(err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush writes the staged bytes to the file.
+func (pf *PreallocFile) Flush() error {
+	pf.Lock()
+	defer pf.Unlock()
+
+	if pf.Fd == nil {
+		return nil
+	}
+	return pf.writeChunk()
+}
+
+// Close writer
+func (pf *PreallocFile) Close() {
+	pf.CloseErr()
+}
+
+// CloseErr Closes the file, reporting write and close failures.
+func (pf *PreallocFile) CloseErr() error {
+	pf.Lock()
+	defer pf.Unlock()
+
+	if pf.Fd == nil {
+		return nil
+	}
+	err := pf.writeChunk()
+	// drop the preallocated tail
+	if e := pf.Fd.Truncate(pf.offset + int64(len(pf.chunk))); e != nil && err == nil {
+		err = e
+	}
+	if e := pf.Fd.Close(); e != nil && err == nil {
+		err = e
+	}
+	pf.Fd = nil
+	return err
+}
+
+// open the file and continue after the existing content.
+func (pf *PreallocFile) open() error {
+	fd, err := os.OpenFile(pf.Path, os.O_CREATE|os.O_RDWR, pf.FilePerm)
+	if err != nil {
+		return err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	size, err := pf.dataEnd(fd, stat.Size())
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	// reload the partial last block so writes stay aligned
+	tail := size % int64(pf.blockSize)
+	pf.chunk = pf.chunk[:tail]
+	if _, err := fd.ReadAt(pf.chunk, size-tail); err != nil {
+		fd.Close()
+		return err
+	}
+	pf.Fd = fd
+	pf.offset = size - tail
+	pf.allocated = stat.Size()
+	return nil
+}
+
+// dataEnd finds the end of the data of a file of the given size, before the
+// zero bytes preallocated and left unwritten by a crash.
+func (pf *PreallocFile) dataEnd(fd *os.File, size int64) (int64, error) {
+	block := make([]byte, cap(pf.chunk))
+	for end := size; end > 0; {
+		start := end - int64(len(block))
+		if start < 0 {
+			start = 0
+		}
+		b := block[:end-start]
+		if _, err := fd.ReadAt(b, start); err != nil {
+			return 0, err
+		}
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] != 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// writeChunk writes the staged bytes at the current offset. The partial
+// last block stays staged and is rewritten together with the next chunk.
+func (pf *PreallocFile) writeChunk() error {
+	if len(pf.chunk) == 0 {
+		return nil
+	}
+	end := pf.offset + int64(len(pf.chunk))
+	if end > pf.allocated {
+		if err := pf.grow(end); err != nil {
+			return err
+		}
+	}
+	if _, err := pf.Fd.WriteAt(pf.chunk, pf.offset); err != nil {
+		return err
+	}
+	whole := len(pf.chunk) / pf.blockSize * pf.blockSize
+	pf.chunk = pf.chunk[:copy(pf.chunk, pf.chunk[whole:])]
+	pf.offset += int64(whole)
+	return nil
+}
+
+// grow the file to cover at least size bytes.
+func (pf *PreallocFile) grow(size int64) error {
+	if size < 0 {
+		return errors.New("invalid size")
+	}
+	allocated := pf.allocated
+	for allocated < size {
+		allocated += pf.preallocSize
+	}
+	if err := allocate(pf.Fd, pf.allocated, allocated); err != nil {
+		return err
+	}
+	pf.allocated = allocated
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package handler
+
+import (
+	"os"
+	"syscall"
+)
+
+// allocate Allocates the blocks of the file from off to size with fallocate,
+// extending the file, or only extends it if the file system can't allocate.
+func allocate(f *os.File, off, size int64) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno error
+	err = rc.Control(func(fd uintptr) {
+		errno = syscall.Fallocate(int(fd), 0, off, size-off)
+	})
+	if err != nil {
+		return err
+	}
+	if errno == syscall.EOPNOTSUPP || errno == syscall.ENOSYS {
+		return f.Truncate(size)
+	}
+	return errno
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package handler
+
+import (
+	"os"
+)
+
+// allocate Extends the file to size, sparse on most file systems.
+func allocate(f *os.File, off, size int64) error {
+	return f.Truncate(size)
+}
@@ -10,13 +10,19 @@ type Processable struct {
 }
 
 // PushProcessor push processor
-func (p *Processable) PushProcessor(types.Processor) {
-
+// Processors of a handler change a clone of the record, not the record seen by the other handlers.
+func (p *Processable) PushProcessor(processor types.Processor) {
+	p.processors = append([]types.Processor{processor}, p.processors...)
 }
 
 // PopProcessor pop processor
 func (p *Processable) PopProcessor() types.Processor {
-	return nil
+	if len(p.processors) == 0 {
+		return nil
+	}
+	processor := p.processors[0]
+	p.processors = p.processors[1:]
+	return processor
 }
 
 // ProcessRecord Processes a record.
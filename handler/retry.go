@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Retry the retry policy of the network handlers. A failed attempt is retried
+// after a backoff starting at Base and doubling up to Max, shortened by up to
+// Jitter of itself at random so handlers failing together spread their retries.
+type Retry struct {
+	// MaxAttempts the number of attempts including the first one, 1 or less
+	// disables the retries.
+	MaxAttempts int
+	Base        time.Duration
+	// Max caps the backoff, 0 is uncapped.
+	Max time.Duration
+	// Jitter the randomized fraction of the backoff, from 0 to 1.
+	Jitter float64
+	// Retryable reports whether an error is worth retrying, defaults to IsRetryable.
+	Retryable func(err error) bool
+}
+
+// WithRetry Set the retry policy of network handlers, such as Net and Mail.
+// The retries and their backoffs run on the logging goroutine, so a handler
+// retrying should sit behind a Buffer:
+//
+//	NewBufferWith(NewNetWith("tcp", addr, WithRetry(retry)), WithBufferSize(1000))
+func WithRetry(retry Retry) Option {
+	return func(o *Options) {
+		o.Retry = &retry
+	}
+}
+
+// Backoff Gets the wait before the retry following the failed attempt, counting from 1.
+func (r Retry) Backoff(attempt int) time.Duration {
+	d := r.Base
+	for i := 1; i < attempt && d > 0; i++ {
+		if r.Max > 0 && d >= r.Max {
+			break
+		}
+		if d*2 < d {
+			// overflow
+			break
+		}
+		d *= 2
+	}
+	if r.Max > 0 && d > r.Max {
+		d = r.Max
+	}
+	if r.Jitter > 0 && d > 0 {
+		d -= time.Duration(float64(d) * r.Jitter * rand.Float64())
+	}
+	return d
+}
+
+// IsRetryable Reports whether an error is worth retrying.
+func (r Retry) IsRetryable(err error) bool {
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// Do Calls fn until it succeeds, fails with an error not worth retrying or
+// runs out of attempts, waiting the backoffs on clock, blocking the caller.
+// Returns the last error.
+func (r Retry) Do(clock types.Clock, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.MaxAttempts || !r.IsRetryable(err) {
+			return err
+		}
+		sleep(clock, r.Backoff(attempt))
+	}
+}
+
+// Retryable Marks an error as worth retrying, such as an HTTP 503 response.
+func Retryable(err error) error {
+	return retryableError{err}
+}
+
+type retryableError struct {
+	error
+}
+
+func (retryableError) Retryable() bool {
+	return true
+}
+
+// IsRetryable Reports whether an error is worth retrying: network errors,
+// including timeouts and failed lookups, and errors marked by Retryable.
+func IsRetryable(err error) bool {
+	if r, ok := err.(interface{ Retryable() bool }); ok {
+		return r.Retryable()
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// sleep waits d on clock.
+func sleep(clock types.Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	ticker := clock.NewTicker(d)
+	<-ticker.C()
+	ticker.Stop()
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Ring keeps the last records in memory, so that the recent logs of a process
+// can be inspected even when its other handlers are misconfigured.
+// It is also an http.Handler serving the kept records, formatted by its
+// formatter, such as a debug endpoint:
+//
+//	http.Handle("/debug/llog/recent", ring)
+//
+// The "n" query parameter limits the response to the last n records.
+type Ring struct {
+	Handler
+	Formattable
+
+	mu      sync.Mutex
+	records []*types.Record
+	next    int
+	full    bool
+}
+
+// NewRing New ring handler keeping the last size records.
+func NewRing(size int, opts ...Option) *Ring {
+	o := newOptions(opts)
+	if size < 1 {
+		size = 1
+	}
+	r := &Ring{
+		records: make([]*types.Record, size),
+	}
+	o.apply(&r.Handler, r)
+	r.SetFormatter(o.formatter(r))
+	return r
+}
+
+// Handle Keeps a copy of the record, replacing the oldest one.
+func (r *Ring) Handle(record *types.Record) bool {
+	if !r.IsHandling(record) {
+		return false
+	}
+	c := record.Clone()
+	r.mu.Lock()
+	if old := r.records[r.next]; old != nil {
+		types.ReleaseRecord(old)
+	}
+	r.records[r.next] = c
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+	r.count(0)
+
+	return false == r.GetBubble()
+}
+
+// HandleBatch Handles a set of records.
+func (r *Ring) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		r.Handle(record)
+	}
+}
+
+// Snapshot Get copies of the kept records, from the oldest to the newest.
+// The copies may be released with types.ReleaseRecord once used.
+func (r *Ring) Snapshot() []*types.Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start, n := 0, r.next
+	if r.full {
+		start, n = r.next, len(r.records)
+	}
+	snapshot := make([]*types.Record, 0, n)
+	for i := 0; i < n; i++ {
+		snapshot = append(snapshot, r.records[(start+i)%len(r.records)].Clone())
+	}
+	return snapshot
+}
+
+// ServeHTTP Writes the kept records formatted by the formatter.
+func (r *Ring) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	snapshot := r.Snapshot()
+	records := snapshot
+	if n, err := strconv.Atoi(req.URL.Query().Get("n")); err == nil && n >= 0 && n < len(records) {
+		records = records[len(records)-n:]
+	}
+	f := r.GetFormatter()
+	formatted := make([]*types.Record, 0, len(records))
+	for _, record := range records {
+		record.Formatted.Reset()
+		if err := f.Format(record); err == nil {
+			formatted = append(formatted, record)
+		}
+	}
+	body, contentType := formatter.Frame(f, formatted)
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+	for _, record := range snapshot {
+		types.ReleaseRecord(record)
+	}
+}
+
+// Close Drops the kept records.
+func (r *Ring) Close() {
+	r.mu.Lock()
+	for i, record := range r.records {
+		if record != nil {
+			types.ReleaseRecord(record)
+			r.records[i] = nil
+		}
+	}
+	r.next = 0
+	r.full = false
+	r.mu.Unlock()
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/syyongx/llog/types"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -24,6 +27,14 @@ const (
 //
 // This rotation is only intended to be used as a workaround. Using logrotate to
 // handle the rotation is strongly encouraged when you can use it.
+//
+// Files are never renamed: the current file is closed before the next one is
+// opened, so rotating works on Windows too. Opening and removing files held
+// open by other processes is retried on Windows sharing violations.
+//
+// A restarted handler appends to today's file. On its first write it removes
+// the files exceeding maxFiles and, with checksums, finishes the rotation of
+// the files of the previous days a stopped run left unchecksummed.
 type RotatingFile struct {
 	*File
 
@@ -33,6 +44,13 @@ type RotatingFile struct {
 	nextRotation   int
 	filenameFormat string
 	dateFormat     string
+	tokens         map[string]string
+	location       *time.Location
+	rotateAt       time.Time
+	recovered      bool
+	manifest       string
+	checksum       bool
+	onRotate       []func(path string)
 	sync.Mutex
 }
 
@@ -41,20 +59,36 @@ type RotatingFile struct {
 // bubble: Whether the messages that are handled can bubble up the stack or not
 // filePerm: Optional file permissions (default (0644) are only for owner read/write)
 func NewRotatingFile(filename string, filePerm os.FileMode, maxFiles, level int, bubble bool) *RotatingFile {
+	return NewRotatingFileWith(filename, maxFiles, WithPerm(filePerm), WithLevel(level), WithBubble(bubble))
+}
+
+// NewRotatingFileWith New rotatingFile handler configured by options.
+// maxFiles: The maximal amount of files to keep (0 means unlimited)
+func NewRotatingFileWith(filename string, maxFiles int, opts ...Option) *RotatingFile {
 	rf := &RotatingFile{
 		filename:       filename,
 		maxFiles:       maxFiles,
 		filenameFormat: "{filename}-{date}",
 		dateFormat:     FilePerDay,
+		tokens: map[string]string{
+			"hostname": hostname(),
+			"pid":      strconv.Itoa(os.Getpid()),
+		},
 	}
-	rf.nextRotation = rf.day(time.Now().AddDate(0, 0, 1))
-	path := rf.timedFilename()
-	rf.File = NewFile(path, filePerm, level, bubble)
+	rf.File = NewFileWith("", opts...)
+	now := rf.GetClock().Now()
+	rf.nextRotation = rf.nextDay(now)
+	rf.Path = rf.timedFilename(now)
 	rf.File.Writer = rf.Write
+	// Records are written one by one, so each can trigger the rotation.
+	rf.File.BatchWriter = nil
+	rf.name = handlerName(rf)
 	return rf
 }
 
 // SetFilenameFormat Set filename format.
+// The format holds {date} and optionally {filename}, {hostname}, {pid} and the
+// tokens set by SetFilenameToken, such as "{filename}-{hostname}-{date}".
 func (rf *RotatingFile) SetFilenameFormat(filenameFormat, dateFormat string) error {
 	// validate data format
 	match, _ := regexp.MatchString("^2006(([/_.-]?01)([/_.-]?02)?)?$", dateFormat)
@@ -67,55 +101,224 @@ func (rf *RotatingFile) SetFilenameFormat(filenameFormat, dateFormat string) err
 
 	rf.filenameFormat = filenameFormat
 	rf.dateFormat = dateFormat
-	rf.Path = rf.timedFilename()
+	rf.Path = rf.timedFilename(rf.GetClock().Now())
+	rf.Close()
+
+	return nil
+}
+
+// SetFilenameToken Set the value of a {name} token of the filename format,
+// such as an instance id, besides {filename}, {date}, {hostname} and {pid}.
+// Tokens let instances sharing a volume write distinct files.
+func (rf *RotatingFile) SetFilenameToken(name, value string) error {
+	if name == "" || name == "date" || name == "filename" || strings.ContainsAny(name, "{}") {
+		return errors.New("invalid filename token " + name)
+	}
+	if strings.ContainsAny(value, "*?[/\\") {
+		return errors.New("invalid filename token value " + value)
+	}
+	rf.Lock()
+	rf.tokens[name] = value
+	rf.Path = rf.timedFilename(rf.GetClock().Now())
+	rf.Unlock()
 	rf.Close()
 
 	return nil
 }
 
+// SetLocation Set the location the days start in for the rotation and the
+// dates of the filenames, such as time.UTC. Defaults to time.Local.
+func (rf *RotatingFile) SetLocation(loc *time.Location) {
+	rf.Lock()
+	rf.location = loc
+	now := rf.GetClock().Now()
+	rf.nextRotation = rf.nextDay(now)
+	rf.Path = rf.timedFilename(now)
+	rf.Unlock()
+	rf.Close()
+}
+
+// SetChecksum Writes a SHA-256 checksum sidecar next to each rotated file, such
+// as "app-2020-01-01.log.sha256" in the sha256sum format, and appends it to
+// the manifest file if not empty, so archived files can be verified later.
+func (rf *RotatingFile) SetChecksum(manifest string) {
+	rf.Lock()
+	rf.checksum = true
+	rf.manifest = manifest
+	rf.Unlock()
+}
+
+// OnRotate Adds a callback called with the path of each rotated file once it
+// is closed and its checksum written. Callbacks run in their own goroutine,
+// in the order they were added.
+func (rf *RotatingFile) OnRotate(fn func(path string)) {
+	rf.Lock()
+	rf.onRotate = append(rf.onRotate, fn)
+	rf.Unlock()
+}
+
 // Write to file.
-func (rf *RotatingFile) Write(record *types.Record) {
-	// need rotate
+func (rf *RotatingFile) Write(record *types.Record) error {
 	rf.Lock()
-	if rf.nextRotation < rf.day(record.Datetime) {
+	if !rf.recovered {
+		rf.recovered = true
+		rf.recover()
+	}
+	// need rotate
+	if rf.nextRotation <= rf.day(record.Datetime) {
 		rf.mustRotate = true
-		rf.Close()
+		rf.rotateAt = record.Datetime
+		rf.close()
 	}
 	rf.Unlock()
 
-	rf.File.Write(record)
+	return rf.File.Write(record)
 }
 
 // Close the handler.
 func (rf *RotatingFile) Close() {
-	rf.File.Close()
+	rf.CloseErr()
+}
+
+// CloseErr Closes the handler, reporting close failures.
+func (rf *RotatingFile) CloseErr() error {
+	rf.Lock()
+	defer rf.Unlock()
+	return rf.close()
+}
+
+// close the file and rotates it if due, the lock being held.
+func (rf *RotatingFile) close() error {
+	rf.File.drain()
+	rf.File.Lock()
+	defer rf.File.Unlock()
+	err := rf.File.close()
 
 	if rf.mustRotate {
 		// do ratate
 		rf.rotate()
 	}
+	return err
 }
 
 // Rotates the files.
 func (rf *RotatingFile) rotate() error {
+	rotated := rf.Path
+	// the file is named after the day of the record triggering the rotation
+	at := rf.rotateAt
+	if at.IsZero() {
+		at = rf.GetClock().Now()
+	}
+	rf.rotateAt = time.Time{}
 	// update path
-	rf.Path = rf.timedFilename()
-	rf.Fd = nil
+	rf.Path = rf.timedFilename(at)
+	rf.mustRotate = false
+	if m := types.Metrics(); m != nil {
+		m.Rotated(rf.name)
+	}
 	// tomorrow
-	rf.nextRotation = rf.day(time.Now().AddDate(0, 0, 1))
-	// skip remove old files if files are unlimited
-	if rf.maxFiles == 0 {
+	rf.nextRotation = rf.nextDay(at)
+
+	checksum, manifest := rf.checksum, rf.manifest
+	callbacks := rf.onRotate
+	go func() {
+		if checksum {
+			if err := writeChecksum(rf.fs, rotated, manifest); err != nil {
+				rf.reportError(err)
+			}
+		}
+		for _, fn := range callbacks {
+			fn(rotated)
+		}
+		// skip remove old files if files are unlimited
+		if rf.maxFiles > 0 {
+			rf.removeOldLogs()
+		}
+	}()
+
+	return nil
+}
+
+// recover the state left by a previous run on the first write, the lock
+// being held: the files of the previous days missing their checksum, as the
+// run stopped before rotating them, are checksummed and passed to the OnRotate
+// callbacks, then the files exceeding maxFiles are removed. Today's file is
+// appended to.
+func (rf *RotatingFile) recover() {
+	checksum, manifest := rf.checksum, rf.manifest
+	callbacks := rf.onRotate
+	names := rf.names()
+	go func() {
+		if checksum {
+			files, err := rf.rotatedFiles(names)
+			if err != nil {
+				rf.reportError(err)
+			}
+			today, _ := rf.fileDate(names, names.current)
+			for _, file := range files {
+				// skip the files created since, such as by a rotation
+				if date, _ := rf.fileDate(names, file); !date.Before(today) {
+					continue
+				}
+				if _, err := rf.fs.Stat(file + ".sha256"); err == nil {
+					continue
+				}
+				if err := writeChecksum(rf.fs, file, manifest); err != nil {
+					rf.reportError(err)
+					continue
+				}
+				for _, fn := range callbacks {
+					fn(file)
+				}
+			}
+		}
+		if rf.maxFiles > 0 {
+			rf.removeOldLogs()
+		}
+	}()
+}
+
+// writeChecksum writes the checksum sidecar of a file and appends it to the manifest.
+func writeChecksum(fs FS, path, manifest string) error {
+	var f FSFile
+	err := retrySharing(func() (err error) {
+		f, err = fs.OpenFile(path, os.O_RDONLY, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	line := hex.EncodeToString(h.Sum(nil)) + "  " + filepath.Base(path) + "\n"
+	if err := writeFile(fs, path+".sha256", os.O_TRUNC, line); err != nil {
+		return err
+	}
+	if manifest == "" {
 		return nil
 	}
-	// async remove old files.
-	go rf.removeOldLogs()
+	return writeFile(fs, manifest, os.O_APPEND, line)
+}
 
-	rf.mustRotate = false
-	return nil
+// writeFile creates or opens a file of fs with the extra flag and writes s to it.
+func writeFile(fs FS, path string, flag int, s string) error {
+	f, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, s)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
-// Get timed filename
-func (rf *RotatingFile) timedFilename() string {
+// Get timed filename of the day of t
+func (rf *RotatingFile) timedFilename(t time.Time) string {
 	dir := filepath.Dir(rf.filename)
 	basename := filepath.Base(rf.filename)
 	ext := filepath.Ext(rf.filename)
@@ -123,15 +326,16 @@ func (rf *RotatingFile) timedFilename() string {
 		basename = basename[:strings.Index(basename, ext)]
 	}
 
-	date := time.Unix(time.Now().Unix(), 0).Format(rf.dateFormat)
-	timedFilename := strings.NewReplacer("{filename}", basename, "{date}", date).Replace(dir + "/" + rf.filenameFormat)
+	date := t.In(rf.loc()).Format(rf.dateFormat)
+	format := rf.tokenReplacer(basename).Replace(rf.filenameFormat)
+	timedFilename := filepath.Join(dir, strings.Replace(format, "{date}", date, -1))
 	timedFilename += ext
 
 	return timedFilename
 }
 
-// Get blob pattern
-func (rf *RotatingFile) globPattern() string {
+// Get the prefix and suffix of the paths around the date.
+func (rf *RotatingFile) namePattern() (prefix, suffix string) {
 	dir := filepath.Dir(rf.filename)
 	basename := filepath.Base(rf.filename)
 	ext := filepath.Ext(rf.filename)
@@ -139,30 +343,153 @@ func (rf *RotatingFile) globPattern() string {
 		basename = basename[:strings.Index(basename, ext)]
 	}
 
-	glob := strings.NewReplacer("{filename}", basename, "{date}", "*").Replace(dir + "/" + rf.filenameFormat)
-	glob += ext
+	format := filepath.Join(dir, rf.tokenReplacer(basename).Replace(rf.filenameFormat))
+	n := strings.Index(format, "{date}")
+	return format[:n], format[n+len("{date}"):] + ext
+}
+
+// Get the replacer of the tokens of the filename format but {date}.
+func (rf *RotatingFile) tokenReplacer(basename string) *strings.Replacer {
+	pairs := []string{"{filename}", basename}
+	for name, value := range rf.tokens {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// hostname gets the host name, "localhost" if unknown.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
 
-	return glob
+// Get blob pattern
+func (rf *RotatingFile) globPattern() string {
+	prefix, suffix := rf.namePattern()
+	return prefix + "*" + strings.Replace(suffix, "{date}", "*", -1)
 }
 
-// get tomorrow day
+// get the day of t in the rotation location
 func (rf *RotatingFile) day(t time.Time) int {
-	day, _ := strconv.Atoi(t.Format("20060102"))
+	day, _ := strconv.Atoi(t.In(rf.loc()).Format("20060102"))
 	return day
 }
 
+// get the day after the one of t
+func (rf *RotatingFile) nextDay(t time.Time) int {
+	loc := rf.loc()
+	y, m, d := t.In(loc).Date()
+	return rf.day(time.Date(y, m, d+1, 0, 0, 0, 0, loc))
+}
+
+// get the rotation location
+func (rf *RotatingFile) loc() *time.Location {
+	if rf.location == nil {
+		return time.Local
+	}
+	return rf.location
+}
+
+// fileDate parses the date of a file matching the names.
+func (rf *RotatingFile) fileDate(names fileNames, file string) (time.Time, bool) {
+	prefix, suffix := names.prefix, names.suffix
+	if len(file) < len(prefix)+len(suffix) || !strings.HasPrefix(file, prefix) || !strings.HasSuffix(file, suffix) {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(rf.dateFormat, file[len(prefix):len(file)-len(suffix)])
+	return date, err == nil
+}
+
 // Remove old logs.
 func (rf *RotatingFile) removeOldLogs() {
-	files, err := filepath.Glob(rf.globPattern())
+	if _, err := rf.PruneNow(); err != nil {
+		rf.reportError(err)
+	}
+}
+
+// PruneCandidates Gets the rotated files PruneNow would remove, oldest first,
+// without removing them. The current file counts towards maxFiles, and only
+// files whose date parses with the date format are considered, so other files
+// matching the pattern are never removed.
+func (rf *RotatingFile) PruneCandidates() ([]string, error) {
+	if rf.maxFiles <= 0 {
+		return nil, nil
+	}
+	rf.Lock()
+	names := rf.names()
+	rf.Unlock()
+	logs, err := rf.rotatedFiles(names)
 	if err != nil {
-		return
+		return nil, err
+	}
+	n := len(logs) - (rf.maxFiles - 1)
+	if n <= 0 {
+		return nil, nil
 	}
-	if len(files) <= rf.maxFiles {
-		return
+	return logs[:n], nil
+}
+
+// fileNames the names of the current and rotated files.
+type fileNames struct {
+	current, glob, prefix, suffix string
+}
+
+// names gets the names of the files, the lock being held.
+func (rf *RotatingFile) names() fileNames {
+	prefix, suffix := rf.namePattern()
+	return fileNames{rf.Path, rf.globPattern(), prefix, suffix}
+}
+
+// rotatedFiles gets the files matching the names but the current one, whose
+// date parses with the date format, oldest first.
+func (rf *RotatingFile) rotatedFiles(names fileNames) ([]string, error) {
+	files, err := rf.fs.Glob(names.glob)
+	if err != nil {
+		return nil, err
+	}
+	type dated struct {
+		path string
+		date time.Time
+	}
+	logs := make([]dated, 0, len(files))
+	for _, file := range files {
+		if file == names.current {
+			continue
+		}
+		if date, ok := rf.fileDate(names, file); ok {
+			logs = append(logs, dated{file, date})
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].date.Before(logs[j].date)
+	})
+	paths := make([]string, len(logs))
+	for i := range logs {
+		paths[i] = logs[i].path
+	}
+	return paths, nil
+}
+
+// PruneNow Removes the rotated files exceeding maxFiles along with their
+// checksum sidecars, returns the removed files.
+func (rf *RotatingFile) PruneNow() ([]string, error) {
+	candidates, err := rf.PruneCandidates()
+	if err != nil {
+		return nil, err
 	}
-	// Sorting the files by name to remove the older ones
-	sort.Strings(files)
-	for _, file := range files[:len(files)-rf.maxFiles] {
-		os.Remove(file)
+	removed := candidates[:0]
+	for _, file := range candidates {
+		if e := retrySharing(func() error { return rf.fs.Remove(file) }); e != nil {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		removed = append(removed, file)
+		rf.fs.Remove(file + ".sha256")
 	}
+	return removed, err
 }
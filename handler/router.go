@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+)
+
+// Router dispatches records to named handlers by the routing hint in their
+// context under types.TargetKey, such as "audit". Events without a hint are
+// routed under types.EventRoute. Records without a hint or with an unknown
+// one go to the fallback handler, if any.
+// Routes are set up before the handler is used.
+type Router struct {
+	Handler
+
+	routes   map[string]types.IHandler
+	fallback types.IHandler
+}
+
+// NewRouter New router handler
+// fallback: The handler of records without a known target, may be nil
+// bubble: Whether the messages that are handled can bubble up the stack or not
+func NewRouter(fallback types.IHandler, bubble bool) *Router {
+	r := &Router{
+		routes:   make(map[string]types.IHandler),
+		fallback: fallback,
+	}
+	r.SetBubble(bubble)
+	r.name = handlerName(r)
+	return r
+}
+
+// Route Dispatches the records targeting name to handler.
+func (r *Router) Route(name string, handler types.IHandler) *Router {
+	r.routes[name] = handler
+	return r
+}
+
+// IsHandling Checks whether any routed handler handles the level of the record.
+func (r *Router) IsHandling(record *types.Record) bool {
+	if !r.MatchChannel(record.Channel) {
+		return false
+	}
+	if h := r.target(record); h != nil {
+		return h.IsHandling(record)
+	}
+	for _, h := range r.routes {
+		if h.IsHandling(record) {
+			return true
+		}
+	}
+	return r.fallback != nil && r.fallback.IsHandling(record)
+}
+
+// Handle Passes the record to the handler of its target.
+func (r *Router) Handle(record *types.Record) bool {
+	return r.HandleResult(record).Action == types.Stop
+}
+
+// HandleResult Passes the record to the handler of its target.
+func (r *Router) HandleResult(record *types.Record) types.Result {
+	if !r.MatchChannel(record.Channel) {
+		return types.Result{Action: types.Continue}
+	}
+	h := r.target(record)
+	if h == nil {
+		h = r.fallback
+	}
+	if h == nil || !h.IsHandling(record) {
+		return types.Result{Action: types.Continue}
+	}
+	res := types.HandleResult(h, record)
+	r.count(0)
+	if res.Action == types.Continue {
+		return res
+	}
+	res.Action = r.result().Action
+	return res
+}
+
+// HandleBatch Handles a set of records.
+func (r *Router) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		r.Handle(record)
+	}
+}
+
+// Close Closes the routed handlers, once each.
+func (r *Router) Close() {
+	closed := make(map[types.IHandler]bool, len(r.routes)+1)
+	for _, h := range r.routes {
+		if !closed[h] {
+			closed[h] = true
+			h.Close()
+		}
+	}
+	if r.fallback != nil && !closed[r.fallback] {
+		r.fallback.Close()
+	}
+}
+
+// target the handler named by the routing hint of the record.
+func (r *Router) target(record *types.Record) types.IHandler {
+	name, ok := record.Context[types.TargetKey].(string)
+	if !ok {
+		if types.EventOf(record) == nil {
+			return nil
+		}
+		name = types.EventRoute
+	}
+	return r.routes[name]
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// samplerSize the number of fingerprint counters, fingerprints colliding share one.
+const samplerSize = 4096
+
+// Sampler passes on the first records of a fingerprint within each tick, then
+// one in thereafter of them, to tame repetitive logging in hot loops. The
+// fingerprint is the level and the message template of the records logged
+// with a format, or else the message, so messages should not embed values
+// that belong in the context. The events logged by Logger.Event all pass.
+type Sampler struct {
+	Handler
+
+	handler    types.IHandler
+	tick       time.Duration
+	first      uint64
+	thereafter uint64
+	mu         sync.Mutex
+	counters   [samplerSize]sampleCounter
+}
+
+type sampleCounter struct {
+	reset time.Time
+	n     uint64
+}
+
+// NewSampler New sampling handler, such as "first 5 then 1 per 100" per second:
+//
+//	NewSampler(h, time.Second, 5, 100)
+//
+// thereafter: 0 drops all the records after the first ones of the tick.
+func NewSampler(handler types.IHandler, tick time.Duration, first, thereafter int, opts ...Option) *Sampler {
+	o := newOptions(opts)
+	s := &Sampler{
+		handler:    handler,
+		tick:       tick,
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+	}
+	o.apply(&s.Handler, s)
+	return s
+}
+
+// IsHandling Checks whether both the sampler and the wrapped handler handle the record.
+func (s *Sampler) IsHandling(record *types.Record) bool {
+	return s.Handler.IsHandling(record) && s.handler.IsHandling(record)
+}
+
+// SetLevel Set the level of the sampler and of the wrapped handler.
+func (s *Sampler) SetLevel(level int) {
+	s.Handler.SetLevel(level)
+	forwardLevel(s.handler, level)
+}
+
+// Handle Passes the record on if it is sampled.
+func (s *Sampler) Handle(record *types.Record) bool {
+	if !s.IsHandling(record) || !s.sample(record) {
+		return false
+	}
+	s.handler.Handle(record)
+	s.count(0)
+	return false == s.GetBubble()
+}
+
+// HandleBatch Passes the sampled records on.
+func (s *Sampler) HandleBatch(records []*types.Record) {
+	sampled := make([]*types.Record, 0, len(records))
+	for _, record := range records {
+		if s.IsHandling(record) && s.sample(record) {
+			sampled = append(sampled, record)
+			s.count(0)
+		}
+	}
+	if len(sampled) > 0 {
+		s.handler.HandleBatch(sampled)
+	}
+}
+
+// Close Closes the wrapped handler.
+func (s *Sampler) Close() {
+	s.handler.Close()
+}
+
+// sample counts the record against its fingerprint, reporting whether it passes.
+func (s *Sampler) sample(record *types.Record) bool {
+	if types.EventOf(record) != nil {
+		return true
+	}
+	now := s.GetClock().Now()
+	c := &s.counters[Fingerprint(record)%samplerSize]
+	s.mu.Lock()
+	if !now.Before(c.reset) {
+		c.reset = now.Add(s.tick)
+		c.n = 0
+	}
+	c.n++
+	n := c.n
+	s.mu.Unlock()
+
+	if n <= s.first {
+		return true
+	}
+	if s.thereafter == 0 {
+		return false
+	}
+	return (n-s.first)%s.thereafter == 0
+}
+
+// Fingerprint Gets the hash of the level and message template of a record,
+// or of its message if it has no template.
+func Fingerprint(record *types.Record) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(record.Level >> 8), byte(record.Level)})
+	if record.Template != "" {
+		h.Write([]byte(record.Template))
+	} else {
+		h.Write([]byte(record.Message))
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"time"
+)
+
+// Attempts and first backoff of the file operations retried on sharing violations.
+const (
+	sharingRetries = 5
+	sharingBackoff = 10 * time.Millisecond
+)
+
+// retrySharing runs fn until it does not fail with a sharing violation,
+// such as removing a file another process holds open on Windows.
+func retrySharing(fn func() error) error {
+	backoff := sharingBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isSharingViolation(err) || attempt >= sharingRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package handler
+
+// isSharingViolation Files can be removed and renamed while open.
+func isSharingViolation(err error) bool {
+	return false
+}
@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package handler
+
+import (
+	"os"
+	"syscall"
+)
+
+// Windows errors of files opened by other processes without the share flags.
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// isSharingViolation reports whether err is a sharing or lock violation.
+func isSharingViolation(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	return err == errorSharingViolation || err == errorLockViolation
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sender Interface of the handlers sending formatted records, such as Net.
+// A nil error means the records were handed to the remote end, how far that
+// goes depends on the sender: for Net, they were written to the connection,
+// not acknowledged by the receiver, and may be lost with the connection.
+type Sender interface {
+	Send(p []byte) error
+}
+
+// Spool Queues the formatted records on disk and sends them from there, so
+// records survive restarts and outages of the remote end. Failed sends are
+// retried every retry interval, or after the backoff of the policy set by
+// WithRetry, records are only removed once sent without error. The delivery
+// is at-least-once only with a sender returning once the remote end confirmed
+// the receipt of the records: the records Net wrote to a connection dropped
+// before the receiver read them are lost. The records failing with an error
+// the policy does not retry go to the dead-letter file right away if there is
+// one.
+type Spool struct {
+	Processing
+
+	sender Sender
+	queue  *DiskQueue
+	retry  time.Duration
+	policy *Retry
+	maxAge time.Duration
+	stale  uint64
+	notify chan bool
+	close  chan bool
+	done   chan bool
+
+	mu         sync.Mutex
+	maxRetries int
+	deadLetter string
+	attempts   int
+}
+
+// NewSpool New spool handler, queueing in dir the records sent by sender.
+// retry: The interval of the send retries
+// The size of the queue segment files is set by WithBufferSize.
+func NewSpool(sender Sender, dir string, retry time.Duration, opts ...Option) (*Spool, error) {
+	queue, err := NewDiskQueue(dir, int64(newOptions(opts).BufferSize))
+	if err != nil {
+		return nil, err
+	}
+	return NewSpoolQueue(sender, queue, retry, opts...), nil
+}
+
+// NewSpoolQueue New spool handler sending the records of queue.
+// The formatter defaults to the sender's if it has one.
+func NewSpoolQueue(sender Sender, queue *DiskQueue, retry time.Duration, opts ...Option) *Spool {
+	o := newOptions(opts)
+	s := &Spool{
+		sender: sender,
+		queue:  queue,
+		retry:  retry,
+		policy: o.Retry,
+		maxAge: o.MaxAge,
+		notify: make(chan bool, 1),
+		close:  make(chan bool),
+		done:   make(chan bool),
+	}
+	o.apply(&s.Handler, s)
+	if f, ok := sender.(interface{ GetFormatter() types.Formatter }); ok && o.Formatter == nil {
+		o.Formatter = f.GetFormatter()
+	}
+	s.SetFormatter(o.formatter(s))
+	s.Writer = s.Write
+
+	go s.drain()
+	return s
+}
+
+// Write queues a record.
+func (s *Spool) Write(record *types.Record) error {
+	if err := s.queue.PushTime(record.Formatted.Bytes(), record.Datetime); err != nil {
+		s.reportError(err)
+		return err
+	}
+	select {
+	case s.notify <- true:
+	default:
+	}
+	return nil
+}
+
+// SetDeadLetter Moves the records failing more than maxRetries sends to the
+// dead-letter file at path, instead of retrying them forever.
+// maxRetries: 0 retries forever
+func (s *Spool) SetDeadLetter(maxRetries int, path string) {
+	s.mu.Lock()
+	s.maxRetries = maxRetries
+	s.deadLetter = path
+	s.mu.Unlock()
+}
+
+// HandlerStats Gets the counters of the handler, with the number of queued records.
+func (s *Spool) HandlerStats() types.HandlerStats {
+	stats := s.Handler.HandlerStats()
+	stats.QueueDepth = s.queue.Len()
+	return stats
+}
+
+// Health Get the number of queued records, and the connectivity of the
+// sender if it reports its health.
+func (s *Spool) Health() types.Health {
+	health := types.Health{Connected: true}
+	if hc, ok := s.sender.(types.HealthChecker); ok {
+		health = hc.Health()
+	}
+	health.Backlog += s.queue.Len()
+	return health
+}
+
+// Close Stops sending and closes the queue, unsent records stay queued.
+func (s *Spool) Close() {
+	close(s.close)
+	<-s.done
+	s.queue.Close()
+}
+
+// drain sends the queued records until closed.
+func (s *Spool) drain() {
+	ticker := s.GetClock().NewTicker(s.retry)
+	defer ticker.Stop()
+	defer close(s.done)
+	for {
+		failed := s.send()
+		if failed && s.policy != nil {
+			s.backoff()
+			continue
+		}
+		notify := s.notify
+		if failed {
+			// retry on the next tick, not on each record queued
+			notify = nil
+		}
+		select {
+		case <-s.close:
+			return
+		case <-notify:
+		case <-ticker.C():
+		}
+	}
+}
+
+// backoff waits the backoff of the failed attempt, or until closed.
+func (s *Spool) backoff() {
+	ticker := s.GetClock().NewTicker(s.policy.Backoff(s.attempts))
+	defer ticker.Stop()
+	select {
+	case <-s.close:
+	case <-ticker.C():
+	}
+}
+
+// send sends the queued records until the queue is empty or a send fails,
+// reporting whether a send failed.
+func (s *Spool) send() bool {
+	for {
+		select {
+		case <-s.close:
+			return false
+		default:
+		}
+		p, err := s.queue.Peek()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			types.Internal(types.WARNING, "spool read failed", types.RecordContext{"handler": s.name, "error": err.Error()})
+			if err != ErrCorruptSegment {
+				return false
+			}
+			continue
+		}
+		if s.expired() {
+			atomic.AddUint64(&s.stale, 1)
+			s.reportError(ErrStale)
+			s.attempts = 0
+			s.queue.Pop()
+			continue
+		}
+		if err := s.sender.Send(p); err != nil {
+			types.Internal(types.WARNING, "spool send failed", types.RecordContext{"handler": s.name, "error": err.Error()})
+			if !s.failed(p, err) {
+				return true
+			}
+		}
+		s.attempts = 0
+		s.queue.Pop()
+	}
+}
+
+// expired checks whether the peeked record is older than the max age.
+func (s *Spool) expired() bool {
+	if s.maxAge <= 0 {
+		return false
+	}
+	t, err := s.queue.PeekTime()
+	return err == nil && s.GetClock().Now().Sub(t) > s.maxAge
+}
+
+// Stale Get the number of records dropped for their age.
+func (s *Spool) Stale() uint64 {
+	return atomic.LoadUint64(&s.stale)
+}
+
+// failed counts a failed send of p, reporting whether it was moved to the dead-letter file.
+func (s *Spool) failed(p []byte, err error) bool {
+	s.mu.Lock()
+	maxRetries, path := s.maxRetries, s.deadLetter
+	s.mu.Unlock()
+	s.attempts++
+	retryable := s.policy == nil || s.policy.IsRetryable(err)
+	if path == "" || retryable && (maxRetries <= 0 || s.attempts <= maxRetries) {
+		return false
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err == nil {
+		_, err = f.Write(p)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		types.Internal(types.WARNING, "spool dead letter failed", types.RecordContext{"handler": s.name, "error": err.Error()})
+		return false
+	}
+	types.Internal(types.WARNING, "record dead lettered", types.RecordContext{"handler": s.name, "path": path})
+	return true
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/syyongx/llog/types"
+	"io"
+	"sync"
+)
+
+// Stream handler writes records to any io.Writer, such as os.Stdout or os.Stderr.
+type Stream struct {
+	Processing
+	sync.Mutex
+
+	w io.Writer
+}
+
+// NewStream New stream handler
+func NewStream(w io.Writer, level int, bubble bool) *Stream {
+	return NewStreamWith(w, WithLevel(level), WithBubble(bubble))
+}
+
+// NewStreamWith New stream handler configured by options.
+func NewStreamWith(w io.Writer, opts ...Option) *Stream {
+	o := newOptions(opts)
+	s := &Stream{
+		w: w,
+	}
+	o.apply(&s.Handler, s)
+	s.SetFormatter(o.formatter(s))
+	s.Writer = s.Write
+	s.BatchWriter = s.WriteBatch
+
+	return s
+}
+
+// Write to the stream.
+func (s *Stream) Write(record *types.Record) error {
+	s.Lock()
+	_, err := s.w.Write(record.Formatted.Bytes())
+	s.Unlock()
+	if err != nil {
+		s.reportError(err)
+	}
+	return err
+}
+
+// WriteBatch Writes records to the stream at once.
+func (s *Stream) WriteBatch(records []*types.Record) error {
+	buf := joinRecords(records)
+	s.Lock()
+	_, err := s.w.Write(buf.Bytes())
+	s.Unlock()
+	types.PutBuffer(buf)
+	if err != nil {
+		s.reportError(err)
+	}
+	return err
+}
+
+// joinRecords assembles formatted records into a pooled buffer, written in
+// one call instead of one per record.
+func joinRecords(records []*types.Record) *bytes.Buffer {
+	size := 0
+	for _, record := range records {
+		size += record.Formatted.Len()
+	}
+	buf := types.GetBuffer()
+	buf.Grow(size)
+	for _, record := range records {
+		buf.Write(record.Formatted.Bytes())
+	}
+	return buf
+}
+
+// Close nothing to close, the writer is owned by the caller.
+func (s *Stream) Close() {}
@@ -1,3 +1,6 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
 package handler
 
 import (
@@ -18,23 +21,39 @@ type Syslog struct {
 // priority (a combination of the syslog facility and severity) and
 // prefix tag. If tag is empty, the os.Args[0] is used.
 func NewSyslog(priority syslog.Priority, tag string, level int, bubble bool) (*Syslog, error) {
+	return NewSyslogWith(priority, tag, WithLevel(level), WithBubble(bubble))
+}
+
+// NewSyslogWith New syslog handler configured by options.
+func NewSyslogWith(priority syslog.Priority, tag string, opts ...Option) (*Syslog, error) {
+	return NewSyslogDial("", priority, tag, opts...)
+}
+
+// NewSyslogDial New syslog handler connected to the daemon at address, such
+// as "unixgram:///dev/log" or "udp://logs.example.com:514", an empty address
+// connects to the local daemon.
+func NewSyslogDial(address string, priority syslog.Priority, tag string, opts ...Option) (*Syslog, error) {
+	o := newOptions(opts)
 	sys := &Syslog{}
-	w, err := syslog.New(priority, tag)
+	network, raddr := SplitAddress("", address)
+	if network == "" && raddr != "" {
+		network = "udp"
+	}
+	w, err := syslog.Dial(network, raddr, priority, tag)
 	if err != nil {
 		return nil, err
 	}
 	sys.SysWriter = w
-	sys.SetLevel(level)
-	sys.SetBubble(bubble)
-	sys.SetFormatter(sys.GetDefaultFormatter())
+	o.apply(&sys.Handler, sys)
+	sys.SetFormatter(o.formatter(sys))
 	sys.Writer = sys.Write
 	return sys, nil
 }
 
 // Write to console.
-func (s *Syslog) Write(record *types.Record) {
+func (s *Syslog) Write(record *types.Record) error {
 	if s.SysWriter == nil {
-		return
+		return nil
 	}
 	var fn func(m string) error
 	switch record.Level {
@@ -55,10 +74,23 @@ func (s *Syslog) Write(record *types.Record) {
 	case types.EMERGENCY:
 		fn = s.SysWriter.Emerg
 	}
-	fn(record.Formatted.String())
+	err := fn(record.Formatted.String())
+	if err != nil {
+		s.reportError(err)
+	}
+	return err
+}
+
+// Close the connection to the system log daemon.
+func (s *Syslog) Close() {
+	if s.SysWriter != nil {
+		s.SysWriter.Close()
+	}
 }
 
 // GetDefaultFormatter Gets the default syslog formatter.
+// The header timestamp is written by log/syslog with second precision,
+// add %Datetime% to the format to carry sub-second precision.
 func (s *Syslog) GetDefaultFormatter() types.Formatter {
 	return formatter.NewLine("%Channel%.%LevelName%: %Message% %Context% %Extra%", "")
 }
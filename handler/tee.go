@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"io"
+	"sync"
+	"time"
+)
+
+// Tee writes each record formatted by several formatters to their own writers,
+// such as a human-readable line to the console and JSON to a file. The
+// processors run once per record whatever the number of outputs.
+// Outputs are added before the handler is used.
+type Tee struct {
+	Handler
+	Processable
+	sync.Mutex
+
+	outputs []teeOutput
+}
+
+type teeOutput struct {
+	formatter types.Formatter
+	w         io.Writer
+}
+
+// NewTee New tee handler
+func NewTee(level int, bubble bool) *Tee {
+	return NewTeeWith(WithLevel(level), WithBubble(bubble))
+}
+
+// NewTeeWith New tee handler configured by options.
+func NewTeeWith(opts ...Option) *Tee {
+	o := newOptions(opts)
+	t := &Tee{}
+	o.apply(&t.Handler, t)
+	return t
+}
+
+// Add Writes the records formatted by formatter to w.
+func (t *Tee) Add(formatter types.Formatter, w io.Writer) *Tee {
+	t.outputs = append(t.outputs, teeOutput{formatter: formatter, w: w})
+	return t
+}
+
+// Handle a record.
+func (t *Tee) Handle(record *types.Record) bool {
+	return t.HandleResult(record).Action == types.Stop
+}
+
+// HandleResult Handles a record, reporting the first format or write error.
+// A failing output does not prevent writing the others.
+func (t *Tee) HandleResult(record *types.Record) types.Result {
+	if !t.IsHandling(record) {
+		return types.Result{Action: types.Continue}
+	}
+	if t.processors != nil {
+		record = record.Clone()
+		defer types.ReleaseRecord(record)
+		t.ProcessRecord(record)
+	}
+	if types.Metrics() != nil {
+		defer t.reportLatency(time.Now())
+	}
+	var err error
+	n := 0
+	for _, out := range t.outputs {
+		record.Formatted.Reset()
+		e := out.formatter.Format(record)
+		if e == nil {
+			t.Lock()
+			_, e = out.w.Write(record.Formatted.Bytes())
+			t.Unlock()
+		}
+		if e != nil {
+			t.reportError(e)
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		n += record.Formatted.Len()
+	}
+	if err != nil {
+		return types.Result{Action: types.Continue, Err: err}
+	}
+	t.count(n)
+	return t.result()
+}
+
+// HandleBatch Handles a set of records.
+func (t *Tee) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		t.Handle(record)
+	}
+}
+
+// Close nothing to close, the writers are owned by the caller.
+func (t *Tee) Close() {}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"github.com/syyongx/llog/types"
+	"sync"
+	"time"
+)
+
+// Tenant dispatches records to a handler per tenant, read from the record
+// context under types.TenantKey, such as the files of the customers of a SaaS
+// application. Handlers are created on the first record of their tenant and
+// closed once idle. Records without a tenant go to the fallback, if any.
+type Tenant struct {
+	Handler
+
+	factory  func(tenant string) (types.IHandler, error)
+	fallback types.IHandler
+	idle     time.Duration
+
+	mu        sync.Mutex
+	tenants   map[string]*tenantEntry
+	nextSweep time.Time
+}
+
+type tenantEntry struct {
+	sync.RWMutex
+	handler  types.IHandler
+	lastUsed time.Time
+	closed   bool
+}
+
+// NewTenant New tenant handler
+// factory: Creates the handler of a tenant, such as a file named after it
+// idle: The time after which the handler of an idle tenant is closed, 0 keeps them open
+// fallback: The handler of records without a tenant, may be nil
+func NewTenant(factory func(tenant string) (types.IHandler, error), idle time.Duration, fallback types.IHandler, opts ...Option) *Tenant {
+	o := newOptions(opts)
+	t := &Tenant{
+		factory:  factory,
+		fallback: fallback,
+		idle:     idle,
+		tenants:  make(map[string]*tenantEntry),
+	}
+	o.apply(&t.Handler, t)
+	return t
+}
+
+// Handle Passes the record to the handler of its tenant.
+func (t *Tenant) Handle(record *types.Record) bool {
+	return t.HandleResult(record).Action == types.Stop
+}
+
+// HandleResult Passes the record to the handler of its tenant.
+func (t *Tenant) HandleResult(record *types.Record) types.Result {
+	if !t.IsHandling(record) {
+		return types.Result{Action: types.Continue}
+	}
+	tenant, _ := record.Context[types.TenantKey].(string)
+	if tenant == "" {
+		if t.fallback == nil || !t.fallback.IsHandling(record) {
+			return types.Result{Action: types.Continue}
+		}
+		return t.pass(types.HandleResult(t.fallback, record))
+	}
+	for {
+		e, err := t.entry(tenant)
+		if err != nil {
+			t.reportError(err)
+			return types.Result{Action: types.Continue, Err: err}
+		}
+		e.RLock()
+		if e.closed {
+			// closed as idle meanwhile
+			e.RUnlock()
+			continue
+		}
+		res := types.HandleResult(e.handler, record)
+		e.RUnlock()
+		return t.pass(res)
+	}
+}
+
+// HandleBatch Handles a set of records.
+func (t *Tenant) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		t.Handle(record)
+	}
+}
+
+// Tenants Get the tenants having an open handler.
+func (t *Tenant) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenants := make([]string, 0, len(t.tenants))
+	for tenant := range t.tenants {
+		tenants = append(tenants, tenant)
+	}
+	return tenants
+}
+
+// Close Closes the handlers of all the tenants and the fallback.
+func (t *Tenant) Close() {
+	t.mu.Lock()
+	entries := t.tenants
+	t.tenants = make(map[string]*tenantEntry)
+	t.mu.Unlock()
+	for _, e := range entries {
+		e.close()
+	}
+	if t.fallback != nil {
+		t.fallback.Close()
+	}
+}
+
+// pass the result of the handler of a record, bubbling as set.
+func (t *Tenant) pass(res types.Result) types.Result {
+	t.count(0)
+	if res.Action != types.Continue {
+		res.Action = t.result().Action
+	}
+	return res
+}
+
+// entry gets the entry of a tenant, creating its handler if needed and
+// closing the idle ones.
+func (t *Tenant) entry(tenant string) (*tenantEntry, error) {
+	now := t.GetClock().Now()
+	var idle []*tenantEntry
+	t.mu.Lock()
+	if t.idle > 0 && !now.Before(t.nextSweep) {
+		for name, e := range t.tenants {
+			if name != tenant && now.Sub(e.lastUsed) >= t.idle {
+				delete(t.tenants, name)
+				idle = append(idle, e)
+			}
+		}
+		t.nextSweep = now.Add(t.idle / 2)
+	}
+	e, ok := t.tenants[tenant]
+	if !ok {
+		h, err := t.factory(tenant)
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		e = &tenantEntry{handler: h}
+		t.tenants[tenant] = e
+	}
+	e.lastUsed = now
+	t.mu.Unlock()
+
+	for _, e := range idle {
+		e.close()
+	}
+	return e, nil
+}
+
+// close closes the handler once the records being handled are done.
+func (e *tenantEntry) close() {
+	e.Lock()
+	e.closed = true
+	e.handler.Close()
+	e.Unlock()
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"errors"
+	"github.com/syyongx/llog/types"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTimeout Reported for the records a Timeout handler gave up on.
+var ErrTimeout = errors.New("handler timed out")
+
+// Timeout Bounds the time a handler may take per record, protecting the
+// latency of the logging goroutine from slow synchronous sinks. Records whose
+// deadline expires go to the fallback handler or are dropped, and while the
+// handler is still stuck on an expired record the next records skip it.
+type Timeout struct {
+	Handler
+
+	handler  types.IHandler
+	fallback types.IHandler
+	timeout  time.Duration
+	stuck    int32
+	expired  uint64
+}
+
+// NewTimeout New timeout handler
+// timeout: The deadline of each record
+// fallback: The handler of the expired records, nil drops them
+func NewTimeout(handler types.IHandler, timeout time.Duration, fallback types.IHandler, opts ...Option) *Timeout {
+	o := newOptions(opts)
+	t := &Timeout{
+		handler:  handler,
+		fallback: fallback,
+		timeout:  timeout,
+	}
+	o.apply(&t.Handler, t)
+	return t
+}
+
+// IsHandling Checks whether the wrapped handler handles the record.
+func (t *Timeout) IsHandling(record *types.Record) bool {
+	return t.MatchChannel(record.Channel) && t.handler.IsHandling(record)
+}
+
+// SetLevel Set the level of the timeout handler and of the wrapped handler.
+func (t *Timeout) SetLevel(level int) {
+	t.Handler.SetLevel(level)
+	forwardLevel(t.handler, level)
+}
+
+// Handle Passes the record to the handler within the deadline.
+func (t *Timeout) Handle(record *types.Record) bool {
+	return t.HandleResult(record).Action == types.Stop
+}
+
+// HandleResult Passes the record to the handler within the deadline.
+func (t *Timeout) HandleResult(record *types.Record) types.Result {
+	if !t.IsHandling(record) {
+		return types.Result{Action: types.Continue}
+	}
+	if atomic.LoadInt32(&t.stuck) > 0 {
+		return t.expire(record)
+	}
+
+	// The handler may outlive the deadline, it gets a copy the logger does not release.
+	c := record.Clone()
+	done := make(chan types.Result, 1)
+	var state int32 // running, finished or expired
+	go func() {
+		res := types.HandleResult(t.handler, c)
+		types.ReleaseRecord(c)
+		if atomic.CompareAndSwapInt32(&state, 0, 1) {
+			done <- res
+			return
+		}
+		atomic.AddInt32(&t.stuck, -1)
+	}()
+
+	ticker := t.GetClock().NewTicker(t.timeout)
+	defer ticker.Stop()
+	select {
+	case res := <-done:
+		return t.finish(res)
+	case <-ticker.C():
+	}
+	atomic.AddInt32(&t.stuck, 1)
+	if !atomic.CompareAndSwapInt32(&state, 0, 2) {
+		// finished right at the deadline
+		atomic.AddInt32(&t.stuck, -1)
+		return t.finish(<-done)
+	}
+	return t.expire(record)
+}
+
+// finish the result of a record handled within the deadline.
+func (t *Timeout) finish(res types.Result) types.Result {
+	t.count(0)
+	if res.Action != types.Continue {
+		res.Action = t.result().Action
+	}
+	return res
+}
+
+// HandleBatch Handles a set of records.
+func (t *Timeout) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		t.Handle(record)
+	}
+}
+
+// Expired Get the number of records the handler gave up on.
+func (t *Timeout) Expired() uint64 {
+	return atomic.LoadUint64(&t.expired)
+}
+
+// Close Closes the handler and the fallback.
+func (t *Timeout) Close() {
+	t.handler.Close()
+	if t.fallback != nil {
+		t.fallback.Close()
+	}
+}
+
+// expire passes a record given up on to the fallback, or drops it.
+func (t *Timeout) expire(record *types.Record) types.Result {
+	atomic.AddUint64(&t.expired, 1)
+	if t.fallback != nil {
+		t.fallback.Handle(record)
+		return t.result()
+	}
+	t.reportError(ErrTimeout)
+	return types.Result{Action: types.Continue, Err: ErrTimeout}
+}
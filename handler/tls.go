@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// TLSConfig The transport security settings shared by the network handlers,
+// to be built into the tls.Config of WithTLS.
+type TLSConfig struct {
+	// PEM file of the CA certificates verifying the server, the system pool if empty.
+	CAFile string
+	// PEM files of the client certificate and key for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// The name verified against the server certificate, the dialed host if empty.
+	ServerName string
+	// Skip the verification of the server certificate, for testing only.
+	InsecureSkipVerify bool
+	// The minimum TLS version, such as tls.VersionTLS12.
+	MinVersion uint16
+}
+
+// Build Builds the tls.Config, loading the certificate files.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         c.MinVersion,
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ParseTLSVersion Gets the TLS version by its name, such as "1.2".
+func ParseTLSVersion(name string) (uint16, error) {
+	switch name {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		// tls.VersionTLS13
+		return 0x0304, nil
+	}
+	return 0, errors.New("unknown tls version " + name)
+}
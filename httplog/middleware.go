@@ -0,0 +1,137 @@
+// Package httplog provides a net/http middleware logging requests through llog.
+//
+//	m := httplog.New(logger)
+//	m.SampleRate = 10
+//	http.ListenAndServe(":8080", m.Handler(mux))
+//
+// Handlers get the request-scoped logger by llog.FromContext(r.Context()).
+package httplog
+
+import (
+	"fmt"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware logs the start and finish of requests.
+// Finished requests are logged at INFO, WARNING for 4xx and ERROR for 5xx
+// status codes. Panics are logged at CRITICAL and answered with a 500.
+type Middleware struct {
+	logger *llog.Logger
+	count  uint32
+
+	// StartLevel the level of the request start records, defaults to DEBUG.
+	StartLevel int
+	// SampleRate logs one in SampleRate successful requests, 0 or 1 logs all of them.
+	// Failed and panicking requests are always logged.
+	SampleRate uint32
+}
+
+// New New middleware
+func New(logger *llog.Logger) *Middleware {
+	return &Middleware{
+		logger:     logger,
+		StartLevel: types.DEBUG,
+	}
+}
+
+// Handler Wraps next with request logging.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sampled := m.SampleRate <= 1 || atomic.AddUint32(&m.count, 1)%m.SampleRate == 1
+		logger := m.logger.With(types.RecordContext{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"remote_addr": r.RemoteAddr,
+		})
+		ctx := llog.NewContext(r.Context(), logger)
+		if sampled {
+			logger.AddRecordContext(ctx, m.StartLevel, "request started")
+		}
+
+		rw := &responseWriter{ResponseWriter: w}
+		defer func() {
+			fields := types.RecordContext{
+				"status":      rw.Status(),
+				"bytes":       rw.bytes,
+				"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				fields["panic"] = fmt.Sprint(p)
+				fields["stack"] = string(debug.Stack())
+				if rw.status == 0 {
+					http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+				fields["status"] = rw.Status()
+				logger.AddRecordFields(ctx, types.CRITICAL, "request panicked", fields)
+				return
+			}
+			level := StatusLevel(rw.Status())
+			if level == types.INFO && !sampled {
+				return
+			}
+			logger.AddRecordFields(ctx, level, "request finished", fields)
+		}()
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// StatusLevel Gets the level of a finished request: INFO, WARNING for 4xx
+// and ERROR for 5xx status codes.
+func StatusLevel(status int) int {
+	switch {
+	case status >= 500:
+		return types.ERROR
+	case status >= 400:
+		return types.WARNING
+	}
+	return types.INFO
+}
+
+// responseWriter records the status code and the size of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader records the status code.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the response.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status Get the status code, 200 if nothing was written.
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
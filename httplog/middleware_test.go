@@ -0,0 +1,56 @@
+package httplog
+
+import (
+	"bytes"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	logger := llog.NewLogger("http")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLogfmt(""))))
+	m := New(logger)
+
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if llog.FromContext(r.Context()).GetFields()["path"] != "/boom" {
+			t.Error("expected the request-scoped logger in the context")
+		}
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", out.String())
+	}
+	for _, want := range []string{"level=critical", "panic=boom", "path=/boom", "status=500"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("missing %s in %s", want, lines[1])
+		}
+	}
+}
+
+func TestMiddlewareSampling(t *testing.T) {
+	var out bytes.Buffer
+	logger := llog.NewLogger("http")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithLevel(types.INFO)))
+	m := New(logger)
+	m.SampleRate = 2
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 4; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if n := strings.Count(out.String(), "request finished"); n != 2 {
+		t.Errorf("expected 2 sampled records, got %d", n)
+	}
+}
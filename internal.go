@@ -0,0 +1,20 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/types"
+)
+
+// SetInternalLogger Routes the failures the library logs about itself, such as
+// reconnects and dropped records, to a clone of l on the "llog" channel.
+// Records raised while an internal record is being handled are dropped.
+// nil disables the internal logging.
+func SetInternalLogger(l *Logger) {
+	if l == nil {
+		types.SetInternal(nil)
+		return
+	}
+	internal := l.Clone(types.InternalChannel)
+	types.SetInternal(func(level int, message string, context types.RecordContext) {
+		internal.AddRecordFields(nil, level, message, context)
+	})
+}
@@ -0,0 +1,208 @@
+// Package llogtest helps testing the logging of an application: a handler
+// capturing the records, assertions on them, and golden files of the
+// formatted output with the timestamps and uids scrubbed.
+//
+//	h := llogtest.NewHandler()
+//	logger.PushHandler(h)
+//	run(logger)
+//	llogtest.AssertLogged(t, h, types.WARNING, "disk almost full")
+//	llogtest.AssertGolden(t, "testdata/run.golden", h.Output())
+//
+// Golden files are written instead of compared when the LLOGTEST_UPDATE
+// environment variable is set.
+package llogtest
+
+import (
+	"bytes"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultFormat the format of the captured records, without the timestamp.
+var DefaultFormat = "%Channel%.%LevelName%: %Message% %Context% %Extra%\n"
+
+// Entry a captured record.
+type Entry struct {
+	Level     int
+	LevelName string
+	Channel   string
+	Message   string
+	Context   types.RecordContext
+	Extra     types.RecordExtra
+	Formatted string
+}
+
+// Handler captures the records it handles.
+type Handler struct {
+	handler.Processing
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewHandler New capture handler of all the levels, formatting the records by DefaultFormat.
+func NewHandler() *Handler {
+	h := &Handler{}
+	h.SetLevel(types.DEBUG)
+	h.SetBubble(true)
+	h.SetFormatter(formatter.NewLine(DefaultFormat, ""))
+	h.Writer = h.Write
+	return h
+}
+
+// Write captures a record.
+func (h *Handler) Write(record *types.Record) error {
+	e := Entry{
+		Level:     record.Level,
+		LevelName: record.LevelName,
+		Channel:   record.Channel,
+		Message:   record.Message,
+		Formatted: record.Formatted.String(),
+	}
+	if record.Context != nil {
+		e.Context = make(types.RecordContext, len(record.Context))
+		for k, v := range record.Context {
+			e.Context[k] = v
+		}
+	}
+	if record.Extra != nil {
+		e.Extra = make(types.RecordExtra, len(record.Extra))
+		for k, v := range record.Extra {
+			e.Extra[k] = v
+		}
+	}
+	h.mu.Lock()
+	h.entries = append(h.entries, e)
+	h.mu.Unlock()
+	return nil
+}
+
+// Close nothing to close.
+func (h *Handler) Close() {}
+
+// Entries Get the captured records.
+func (h *Handler) Entries() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Entry(nil), h.entries...)
+}
+
+// Output Get the formatted captured records.
+func (h *Handler) Output() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var b bytes.Buffer
+	for _, e := range h.entries {
+		b.WriteString(e.Formatted)
+	}
+	return b.String()
+}
+
+// Reset Drops the captured records.
+func (h *Handler) Reset() {
+	h.mu.Lock()
+	h.entries = nil
+	h.mu.Unlock()
+}
+
+// Logged Checks whether a record of the level has a message containing substr.
+func (h *Handler) Logged(level int, substr string) bool {
+	for _, e := range h.Entries() {
+		if e.Level == level && strings.Contains(e.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TB the part of testing.TB used by the assertions.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertLogged Fails the test unless a record of the level has a message containing substr.
+func AssertLogged(t TB, h *Handler, level int, substr string) bool {
+	t.Helper()
+	if h.Logged(level, substr) {
+		return true
+	}
+	t.Errorf("no %s record containing %q, got:\n%s", levelName(level), substr, h.Output())
+	return false
+}
+
+// AssertNotLogged Fails the test if a record of the level has a message containing substr.
+func AssertNotLogged(t TB, h *Handler, level int, substr string) bool {
+	t.Helper()
+	if !h.Logged(level, substr) {
+		return true
+	}
+	t.Errorf("unexpected %s record containing %q, got:\n%s", levelName(level), substr, h.Output())
+	return false
+}
+
+// levelName gets the name of a level, its number if unknown.
+func levelName(level int) string {
+	if name, err := llog.Default().GetLevelName(level); err == nil {
+		return name
+	}
+	return strconv.Itoa(level)
+}
+
+// Scrubber replaces the matches of Pattern by Replacement.
+type Scrubber struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Scrubbers the scrubbers applied by Scrub, in order.
+var Scrubbers = []Scrubber{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`\b[0-9a-f]{13}\b`), "<uid>"},
+}
+
+// Scrub Replaces the parts of s varying between runs, such as timestamps and uids.
+func Scrub(s string) string {
+	for _, sc := range Scrubbers {
+		s = sc.Pattern.ReplaceAllString(s, sc.Replacement)
+	}
+	return s
+}
+
+// AssertGolden Fails the test unless the scrubbed got equals the content of
+// the golden file at path. The file is written instead if the LLOGTEST_UPDATE
+// environment variable is set.
+func AssertGolden(t TB, path, got string) bool {
+	t.Helper()
+	got = Scrub(got)
+	if os.Getenv("LLOGTEST_UPDATE") != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("update golden file: %v", err)
+			return false
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Errorf("update golden file: %v", err)
+			return false
+		}
+		return true
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("read golden file: %v", err)
+		return false
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", path, got, want)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package llogtest
+
+import (
+	"fmt"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/processor"
+	"github.com/syyongx/llog/types"
+	"testing"
+)
+
+// recorder records the failures of the assertions.
+type recorder struct {
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler()
+	logger := llog.NewLogger("app")
+	logger.PushHandler(h)
+	logger.PushProcessor(processor.UID)
+	logger.With(types.RecordContext{"free": 1024}).Warning("disk almost full")
+
+	AssertLogged(t, h, types.WARNING, "almost full")
+	AssertNotLogged(t, h, types.ERROR, "almost full")
+	r := &recorder{}
+	if AssertLogged(r, h, types.INFO, "almost full") || len(r.failures) != 1 {
+		t.Errorf("expected a failed assertion, got %q", r.failures)
+	}
+	if e := h.Entries(); len(e) != 1 || e[0].Context["free"] != 1024 {
+		t.Errorf("unexpected entries %+v", e)
+	}
+	AssertGolden(t, "testdata/handler.golden", h.Output())
+	h.Reset()
+	if h.Output() != "" {
+		t.Errorf("unexpected output after reset %q", h.Output())
+	}
+}
+
+func TestScrub(t *testing.T) {
+	got := Scrub("[2020-01-01T12:00:00.123+08:00] app.info: started {\"Uid\":\"5e0c1a00abcde\"}")
+	if got != "[<time>] app.info: started {\"Uid\":\"<uid>\"}" {
+		t.Errorf("unexpected scrubbed line %q", got)
+	}
+}
@@ -6,20 +6,37 @@
 package llog
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/syyongx/llog/types"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Logger logger struct
 type Logger struct {
-	name       string
-	levels     map[int]string
-	handlers   []types.IHandler
-	processors []types.Processor
-	timezone   string
+	name        string
+	levels      map[int]string
+	handlers    []types.IHandler
+	processors  []types.Processor
+	timezone    string
+	location    *time.Location
+	level       int32
+	parent      *Logger
+	fields      types.RecordContext
+	clock       types.Clock
+	merge       int
+	mergePrefix string
+	mirror      types.IHandler
+	// scopeThreshold the minimal duration of the successful scopes logged by TimedScope.
+	scopeThreshold time.Duration
+	onError        atomic.Value // func(error)
+	occurrences    *occurrences
+	mu             sync.RWMutex
 }
 
 var levels = map[int]string{
@@ -33,11 +50,17 @@ var levels = map[int]string{
 	types.EMERGENCY: "emergency",
 }
 
+// ParseLevel Gets the logging level by its name, such as "warning".
+func ParseLevel(name string) (int, error) {
+	return (&Logger{levels: levels}).GetLevelByName(name)
+}
+
 // NewLogger new logger
 func NewLogger(name string) *Logger {
 	return &Logger{
-		name:   name,
-		levels: levels,
+		name:        name,
+		levels:      levels,
+		occurrences: &occurrences{},
 	}
 }
 
@@ -48,11 +71,15 @@ func (l *Logger) GetName() string {
 
 // PushHandler pushes a handler on to the stack.
 func (l *Logger) PushHandler(h types.IHandler) {
+	l.mu.Lock()
 	l.handlers = append([]types.IHandler{h}, l.handlers...)
+	l.mu.Unlock()
 }
 
 // PopHandler Pops a handler from the stack.
 func (l *Logger) PopHandler() (types.IHandler, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if len(l.handlers) < 1 {
 		return nil, errors.New("you tried to pop from an empty handler slice")
 	}
@@ -63,24 +90,86 @@ func (l *Logger) PopHandler() (types.IHandler, error) {
 
 // SetHandlers Set handlers, replacing all existing ones.
 func (l *Logger) SetHandlers(handlers []types.IHandler) {
-	l.handlers = l.handlers[:0]
-	for i := len(handlers); i > 0; i-- {
-		l.PushHandler(handlers[i-1])
+	l.SwapHandlers(handlers)
+}
+
+// SwapHandlers Replaces all the handlers, the swap waits for records being
+// dispatched to the old handlers, which are returned so the caller can close them.
+func (l *Logger) SwapHandlers(handlers []types.IHandler) []types.IHandler {
+	hs := make([]types.IHandler, len(handlers))
+	copy(hs, handlers)
+	l.mu.Lock()
+	old := l.handlers
+	l.handlers = hs
+	l.mu.Unlock()
+	return old
+}
+
+// PushHandler2 pushes a handler reporting its failures on to the stack.
+func (l *Logger) PushHandler2(h types.IHandler2) {
+	l.PushHandler(types.FromHandler2(h))
+}
+
+// SetErrorHandler Set the function handler failures are passed to, such as
+// write and close errors. Children without one use the nearest ancestor's.
+// It must not log to the logger whose handlers failed.
+func (l *Logger) SetErrorHandler(fn func(error)) {
+	l.onError.Store(fn)
+}
+
+// reportError Passes err to the error handler of the logger or of its nearest ancestor having one.
+func (l *Logger) reportError(err error) {
+	for p := l; p != nil; p = p.parent {
+		if fn, _ := p.onError.Load().(func(error)); fn != nil {
+			fn(err)
+			return
+		}
 	}
 }
 
 // GetHandlers Get handlers
 func (l *Logger) GetHandlers() []types.IHandler {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.handlers
 }
 
+// GetParent Get the logger whose handlers are inherited while the logger has none.
+func (l *Logger) GetParent() *Logger {
+	return l.parent
+}
+
+// stack Gets the handlers and processors records go through, each inherited
+// from the nearest ancestor having some. The returned func releases the read locks.
+func (l *Logger) stack() ([]types.IHandler, []types.Processor, func()) {
+	l.mu.RLock()
+	if l.parent == nil || len(l.handlers) > 0 && len(l.processors) > 0 {
+		return l.handlers, l.processors, l.mu.RUnlock
+	}
+	handlers, processors, unlock := l.parent.stack()
+	if len(l.handlers) > 0 {
+		handlers = l.handlers
+	}
+	if len(l.processors) > 0 {
+		processors = l.processors
+	}
+	return handlers, processors, func() {
+		unlock()
+		l.mu.RUnlock()
+	}
+}
+
 // PushProcessor Pushes a processor on to the stack.
 func (l *Logger) PushProcessor(p types.Processor) {
+	l.mu.Lock()
 	l.processors = append([]types.Processor{p}, l.processors...)
+	l.mu.Unlock()
 }
 
 // PopProcessor Pops a processor from the stack.
 func (l *Logger) PopProcessor() (types.Processor, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if len(l.processors) < 1 {
 		return nil, errors.New("you tried to pop from an empty processor stack")
 	}
@@ -89,47 +178,164 @@ func (l *Logger) PopProcessor() (types.Processor, error) {
 	return first, nil
 }
 
+// SetProcessors Set processors, replacing all existing ones.
+func (l *Logger) SetProcessors(processors []types.Processor) {
+	ps := make([]types.Processor, len(processors))
+	copy(ps, processors)
+	l.mu.Lock()
+	l.processors = ps
+	l.mu.Unlock()
+}
+
 // GetProcessor Get processors
 func (l *Logger) GetProcessor() []types.Processor {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.processors
 }
 
 // AddRecord Adds a log record.
 func (l *Logger) AddRecord(level int, message string) (bool, error) {
+	return l.AddRecordContext(nil, level, message)
+}
+
+// AddRecordContext Adds a log record carrying the context of the call,
+// which processors such as trace extractors can read.
+func (l *Logger) AddRecordContext(ctx context.Context, level int, message string) (bool, error) {
+	return l.AddRecordFields(ctx, level, message, nil)
+}
+
+// AddRecordFields Adds a log record carrying the context of the call and
+// fields, which are merged over the fields bound by With into the record context.
+// The error is the first one a handler reported through types.Result.
+func (l *Logger) AddRecordFields(ctx context.Context, level int, message string, fields types.RecordContext) (bool, error) {
+	return l.addRecord(ctx, level, message, nil, fields)
+}
+
+// AddRecordf Adds a log record whose message is rendered from the template
+// and args only if a handler handles it, keeping both in the record.
+func (l *Logger) AddRecordf(ctx context.Context, level int, template string, args []interface{}) (bool, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return l.addRecord(ctx, level, template, args, nil)
+}
+
+// addRecord adds a record, message being a template if args is not nil.
+func (l *Logger) addRecord(ctx context.Context, level int, message string, args []interface{}, fields types.RecordContext) (bool, error) {
+	_, event := fields[types.EventKey].(*types.Event)
+	if level < l.GetLevel() && !event {
+		return false, nil
+	}
+	handlers, processors, unlock := l.stack()
+	defer unlock()
+
 	hKey := -1
 	record := types.GetRecord()
 	defer types.ReleaseRecord(record)
 	record.Level = level
-	for i, v := range l.handlers {
+	record.Channel = l.name
+	if event {
+		// the handlers pass the events whatever their level
+		record.Context = fields
+	}
+	for i, v := range handlers {
 		if v.IsHandling(record) {
 			hKey = i
 		}
 	}
-	if hKey == -1 {
+	mirror := l.mirror != nil && l.mirror.IsHandling(record)
+	if hKey == -1 && !mirror {
 		return false, nil
 	}
 	levelName, err := l.GetLevelName(level)
 	if err != nil {
 		return false, err
 	}
-	record.Message = message
-	record.LevelName = levelName
-	record.Channel = l.name
-	record.Datetime = time.Now()
-
-	for _, p := range l.processors {
+	if args != nil {
+		record.Template = message
+		record.Args = args
+		message = fmt.Sprintf(message, args...)
+	}
+	l.fill(record, ctx, levelName, message, fields, l.now())
+	for _, p := range processors {
 		p(record)
 	}
-	for j, h := range l.handlers {
-		if hKey < j {
-			continue
+	mergeExtra(record.Context, record.Extra, l.merge, l.mergePrefix)
+
+	err = l.dispatch(handlers[:hKey+1], record)
+	if mirror {
+		handle(l.mirror, record)
+	}
+	return true, err
+}
+
+// HandleRecord Dispatches a complete record as is to the handlers, without
+// running the processors, such as a record replayed from a dump.
+// The record is not released.
+func (l *Logger) HandleRecord(record *types.Record) (bool, error) {
+	if record.Level < l.GetLevel() && types.EventOf(record) == nil {
+		return false, nil
+	}
+	handlers, _, unlock := l.stack()
+	defer unlock()
+
+	hKey := -1
+	for i, v := range handlers {
+		if v.IsHandling(record) {
+			hKey = i
+		}
+	}
+	if hKey == -1 {
+		return false, nil
+	}
+	if record.Extra == nil {
+		record.Extra = make(types.RecordExtra)
+	}
+	return true, l.dispatch(handlers[:hKey+1], record)
+}
+
+// dispatch passes a record down the handlers until one stops it, returning
+// the first error a handler reported.
+func (l *Logger) dispatch(handlers []types.IHandler, record *types.Record) error {
+	var err error
+	for _, h := range handlers {
+		res := handle(h, record)
+		if res.Err != nil {
+			l.reportError(res.Err)
+			if err == nil {
+				err = res.Err
+			}
 		}
-		if h.Handle(record) { // Will not bubble
+		if res.Action == types.Stop {
 			break
 		}
 	}
+	return err
+}
 
-	return true, nil
+// fill Sets the fields of a record about to be dispatched.
+func (l *Logger) fill(record *types.Record, ctx context.Context, levelName, message string, fields types.RecordContext, t time.Time) {
+	record.Message = message
+	record.LevelName = levelName
+	record.Channel = l.name
+	record.Datetime = t
+	record.Seq = types.NextSeq()
+	record.Ctx = ctx
+	if m := types.Metrics(); m != nil {
+		m.RecordLogged(l.name, levelName)
+	}
+	if record.Extra == nil {
+		record.Extra = make(types.RecordExtra)
+	}
+	record.Context = nil
+	if len(l.fields) > 0 || len(fields) > 0 {
+		record.Context = make(types.RecordContext, len(l.fields)+len(fields))
+		for k, v := range l.fields {
+			record.Context[k] = v
+		}
+		mergeFields(record.Context, fields, l.merge, l.mergePrefix)
+	}
 }
 
 // GetLevels Gets all supported logging levels.
@@ -160,7 +366,65 @@ func (l *Logger) GetLevelByName(levelName string) (int, error) {
 
 // IsHandling Checks whether the Logger has a handler that listens on the given level.
 func (l *Logger) IsHandling(level int) bool {
-	return true
+	if level < l.GetLevel() {
+		return false
+	}
+	record := &types.Record{Level: level, Channel: l.name}
+	handlers, _, unlock := l.stack()
+	defer unlock()
+	for _, h := range handlers {
+		if h.IsHandling(record) {
+			return true
+		}
+	}
+	return false
+}
+
+// inheritLevel the level of the children without one of their own.
+const inheritLevel = -1 << 31
+
+// SetLevel Set the minimum level of the records the logger dispatches to its handlers.
+func (l *Logger) SetLevel(level int) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// GetLevel Get the minimum level, 0 dispatches all records. Children without
+// a level of their own get the current level of their parent.
+func (l *Logger) GetLevel() int {
+	level := atomic.LoadInt32(&l.level)
+	if level != inheritLevel {
+		return int(level)
+	}
+	if l.parent != nil {
+		return l.parent.GetLevel()
+	}
+	return 0
+}
+
+// Flush Flushes the handlers that buffer writes.
+func (l *Logger) Flush() error {
+	var err error
+	for _, h := range l.GetHandlers() {
+		if f, ok := h.(types.Flusher); ok {
+			if e := f.Flush(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Close Closes all the handlers, passing close failures to the error handler.
+func (l *Logger) Close() {
+	for _, h := range l.GetHandlers() {
+		if c, ok := h.(types.ErrCloser); ok {
+			if err := c.CloseErr(); err != nil {
+				l.reportError(err)
+			}
+			continue
+		}
+		h.Close()
+	}
 }
 
 // Log Logs with an arbitrary level.
@@ -172,6 +436,77 @@ func (l *Logger) Log(level int, message string) {
 	l.AddRecord(level, message)
 }
 
+// LogContext Logs with an arbitrary level and the context of the call.
+func (l *Logger) LogContext(ctx context.Context, level int, message string) {
+	if _, ok := l.levels[level]; !ok {
+		return
+	}
+
+	l.AddRecordContext(ctx, level, message)
+}
+
+// Event Logs a business or audit event at the INFO level, its name being the
+// message. Events pass whatever the levels of the logger and of its handlers,
+// and are never sampled. Formatters render the event apart from the context,
+// and handler.Router routes it under types.EventRoute.
+func (l *Logger) Event(e types.Event) {
+	l.EventContext(nil, e)
+}
+
+// EventContext Logs an event with the context of the call.
+func (l *Logger) EventContext(ctx context.Context, e types.Event) {
+	l.addRecord(ctx, types.INFO, e.Name, nil, types.RecordContext{types.EventKey: &e})
+}
+
+// Logf Logs with an arbitrary level a message formatted by fmt.Sprintf.
+func (l *Logger) Logf(level int, template string, args ...interface{}) {
+	if _, ok := l.levels[level]; !ok {
+		return
+	}
+
+	l.AddRecordf(nil, level, template, args)
+}
+
+// Debugf Logs at the DEBUG level a message formatted by fmt.Sprintf.
+func (l *Logger) Debugf(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.DEBUG, template, args)
+}
+
+// Infof Logs at the INFO level a message formatted by fmt.Sprintf.
+func (l *Logger) Infof(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.INFO, template, args)
+}
+
+// Noticef Logs at the NOTICE level a message formatted by fmt.Sprintf.
+func (l *Logger) Noticef(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.NOTICE, template, args)
+}
+
+// Warningf Logs at the WARNING level a message formatted by fmt.Sprintf.
+func (l *Logger) Warningf(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.WARNING, template, args)
+}
+
+// Errorf Logs at the ERROR level a message formatted by fmt.Sprintf.
+func (l *Logger) Errorf(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.ERROR, template, args)
+}
+
+// Criticalf Logs at the CRITICAL level a message formatted by fmt.Sprintf.
+func (l *Logger) Criticalf(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.CRITICAL, template, args)
+}
+
+// Alertf Logs at the ALERT level a message formatted by fmt.Sprintf.
+func (l *Logger) Alertf(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.ALERT, template, args)
+}
+
+// Emergencyf Logs at the EMERGENCY level a message formatted by fmt.Sprintf.
+func (l *Logger) Emergencyf(template string, args ...interface{}) {
+	l.AddRecordf(nil, types.EMERGENCY, template, args)
+}
+
 // Debug Detailed debug information.
 func (l *Logger) Debug(message interface{}) {
 	l.AddRecord(types.DEBUG, l.String(message))
@@ -201,6 +536,12 @@ func (l *Logger) Error(message interface{}) {
 	l.AddRecord(types.ERROR, l.String(message))
 }
 
+// Critical Critical conditions.
+// Example: Application component unavailable, unexpected exception.
+func (l *Logger) Critical(message interface{}) {
+	l.AddRecord(types.CRITICAL, l.String(message))
+}
+
 // Alert Adds a log record at the ALERT level.
 func (l *Logger) Alert(message interface{}) {
 	l.AddRecord(types.ALERT, l.String(message))
@@ -211,16 +552,82 @@ func (l *Logger) Emergency(message interface{}) {
 	l.AddRecord(types.EMERGENCY, l.String(message))
 }
 
-// SetTimezone Set the timezone to be used for the timestamp of log records.
-func (l *Logger) SetTimezone(tz string) {
+// SetClock Set the clock timestamping the records, for tests.
+func (l *Logger) SetClock(clock types.Clock) {
+	l.mu.Lock()
+	l.clock = clock
+	l.mu.Unlock()
+}
+
+// GetClock Get the clock, the system clock if none was set.
+func (l *Logger) GetClock() types.Clock {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.clock == nil {
+		return types.SystemClock
+	}
+	return l.clock
+}
+
+// now Gets the current time of the clock in the location of the logger,
+// the read lock being held.
+func (l *Logger) now() time.Time {
+	var t time.Time
+	if l.clock == nil {
+		t = time.Now()
+	} else {
+		t = l.clock.Now()
+	}
+	if l.location != nil {
+		t = t.In(l.location)
+	}
+	return t
+}
+
+// SetTimezone Set the timezone to be used for the timestamp of log records,
+// such as "UTC", "Local" or "Europe/Paris". Empty keeps the clock's location.
+func (l *Logger) SetTimezone(tz string) error {
+	var loc *time.Location
+	if tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
 	l.timezone = tz
+	l.location = loc
+	l.mu.Unlock()
+	return nil
 }
 
-// GetTimezone Get timezone
+// GetTimezone Get timezone, tz is unused.
 func (l *Logger) GetTimezone(tz string) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	return l.timezone
 }
 
+// SetLocation Set the location of the timestamp of log records, carried by
+// the record Datetime so all handlers agree. Nil keeps the clock's location.
+// Children get the location of their parent when created.
+func (l *Logger) SetLocation(loc *time.Location) {
+	l.mu.Lock()
+	l.location = loc
+	l.timezone = ""
+	if loc != nil {
+		l.timezone = loc.String()
+	}
+	l.mu.Unlock()
+}
+
+// GetLocation Get the location of the timestamp of log records, nil if not set.
+func (l *Logger) GetLocation() *time.Location {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.location
+}
+
 // String Stringfy
 func (l *Logger) String(data interface{}) string {
 	switch data.(type) {
@@ -231,3 +638,103 @@ func (l *Logger) String(data interface{}) string {
 	}
 	return fmt.Sprint(data)
 }
+
+// Child Creates a logger with the given name that inherits the handlers,
+// processors and level of this logger for as long as it has none of its own.
+func (l *Logger) Child(name string) *Logger {
+	child := NewLogger(name)
+	child.parent = l
+	l.mu.RLock()
+	child.clock = l.clock
+	l.mu.RUnlock()
+	child.timezone = l.GetTimezone("")
+	child.location = l.GetLocation()
+	child.merge, child.mergePrefix = l.GetMergePolicy()
+	child.mirror = l.GetMirror()
+	child.scopeThreshold = l.GetScopeThreshold()
+	child.occurrences = l.getOccurrences()
+	child.level = inheritLevel
+	return child
+}
+
+// With Creates a child logger with the same name that adds the fields to the
+// context of every record, such as a request-scoped logger.
+func (l *Logger) With(fields types.RecordContext) *Logger {
+	child := l.Child(l.name)
+	child.fields = make(types.RecordContext, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		child.fields[k] = v
+	}
+	mergeFields(child.fields, fields, child.merge, child.mergePrefix)
+	return child
+}
+
+// WithError Creates a child logger adding err to the context of every record
+// as an "error" field, holding the chain of wrapped errors and their stack frames.
+func (l *Logger) WithError(err error) *Logger {
+	return l.With(types.RecordContext{"error": types.NewError(err)})
+}
+
+// Target Creates a child logger whose records carry the routing hint name,
+// dispatching them to the handler routed under that name by handler.Router.
+func (l *Logger) Target(name string) *Logger {
+	return l.With(types.RecordContext{types.TargetKey: name})
+}
+
+// Tenant Creates a child logger whose records carry the tenant id, dispatching
+// them to the handler of that tenant by handler.Tenant.
+func (l *Logger) Tenant(id string) *Logger {
+	return l.With(types.RecordContext{types.TenantKey: id})
+}
+
+// GetFields Get the fields bound by With.
+func (l *Logger) GetFields() types.RecordContext {
+	return l.fields
+}
+
+// Clone Creates an independent logger with the given name and copies of the
+// handler and processor stacks. Handlers themselves are shared.
+func (l *Logger) Clone(name string) *Logger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	clone := NewLogger(name)
+	clone.SetHandlers(l.handlers)
+	clone.SetProcessors(l.processors)
+	clone.SetLevel(l.GetLevel())
+	clone.timezone = l.timezone
+	clone.location = l.location
+	clone.clock = l.clock
+	clone.merge = l.merge
+	clone.mergePrefix = l.mergePrefix
+	clone.mirror = l.mirror
+	clone.scopeThreshold = l.scopeThreshold
+	if fn, ok := l.onError.Load().(func(error)); ok {
+		clone.onError.Store(fn)
+	}
+	clone.parent = l.parent
+	clone.fields = l.fields
+	return clone
+}
+
+// WithName Alias of Clone.
+func (l *Logger) WithName(name string) *Logger {
+	return l.Clone(name)
+}
+
+// handle passes a record to a handler, recovering its panic so the other
+// handlers and the program carry on. The panic is logged to the internal
+// logger and reported as the handler error.
+func handle(h types.IHandler, record *types.Record) (res types.Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			name := fmt.Sprintf("%T", h)
+			types.Internal(types.CRITICAL, "handler panicked", types.RecordContext{
+				"handler": name,
+				"panic":   fmt.Sprint(p),
+				"stack":   string(debug.Stack()),
+			})
+			res = types.Result{Action: types.Continue, Err: fmt.Errorf("handler %s panicked: %v", name, p)}
+		}
+	}()
+	return types.HandleResult(h, record)
+}
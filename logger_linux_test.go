@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package llog
+
+import (
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPreallocFileAllocates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	pf := handler.NewPreallocFileWith(path, 1<<20, handler.WithBufferSize(4096),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	defer pf.Close()
+	logger := NewLogger("test")
+	logger.PushHandler(pf)
+	logger.Info("hello")
+	if err := pf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Size != 1<<20 || st.Blocks*512 < 1<<20 {
+		t.Errorf("expected 1MiB allocated, got a size of %d and %d blocks", st.Size, st.Blocks)
+	}
+}
@@ -1,9 +1,33 @@
 package llog
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/syyongx/llog/formatter"
 	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/processor"
 	"github.com/syyongx/llog/types"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -45,3 +69,2990 @@ func BenchmarkBasic(b *testing.B) {
 		}
 	})
 }
+
+func TestHandlerOptions(t *testing.T) {
+	// the positional constructors leave the formatter unset
+	if f := handler.NewFile("/dev/null", 0600, types.INFO, false).GetFormatter(); f != nil {
+		t.Errorf("expected no NewFile formatter, got %T", f)
+	}
+	if f := handler.NewNet(0, false, types.INFO, false).GetFormatter(); f != nil {
+		t.Errorf("expected no NewNet formatter, got %T", f)
+	}
+	if f := handler.NewMail("localhost:25", "", "", "a@example.com", "alert", nil, types.INFO, false).GetFormatter(); f != nil {
+		t.Errorf("expected no NewMail formatter, got %T", f)
+	}
+	file := handler.NewFile("/dev/null", 0600, types.INFO, false)
+	if file.FilePerm != 0600 || file.GetLevel() != types.INFO || file.GetBubble() {
+		t.Errorf("unexpected NewFile settings %v %d %v", file.FilePerm, file.GetLevel(), file.GetBubble())
+	}
+
+	// the option constructors default to the handler's default formatter
+	if _, ok := handler.NewFileWith("/dev/null").GetFormatter().(*formatter.Line); !ok {
+		t.Error("expected the line formatter by default")
+	}
+	if _, ok := handler.NewNetWith("tcp", "localhost:514").GetFormatter().(*formatter.Line); !ok {
+		t.Error("expected the line formatter by default")
+	}
+	if _, ok := handler.NewJSONFile("/dev/null", types.INFO).GetFormatter().(*formatter.JSON); !ok {
+		t.Error("expected the JSON formatter of NewJSONFile")
+	}
+
+	f := formatter.NewLogfmt("")
+	clock := types.NewManualClock(time.Unix(0, 0))
+	file = handler.NewFileWith("/dev/null", handler.WithLevel(types.ERROR), handler.WithBubble(false),
+		handler.WithFormatter(f), handler.WithPerm(0640), handler.WithClock(clock), handler.WithChannels("app.*"))
+	if file.GetLevel() != types.ERROR || file.GetBubble() || file.GetFormatter() != f || file.FilePerm != 0640 {
+		t.Errorf("unexpected settings %d %v %T %v", file.GetLevel(), file.GetBubble(), file.GetFormatter(), file.FilePerm)
+	}
+	if file.GetClock() != clock || !file.MatchChannel("app.db") || file.MatchChannel("other") {
+		t.Error("expected the clock and the channels to be set")
+	}
+	n := handler.NewNetWith("udp", "localhost:514", handler.WithBufferSize(512), handler.WithPersistent(true),
+		handler.WithKeepAlive(time.Minute), handler.WithIdleTimeout(time.Hour), handler.WithEndpoints(handler.SelectRoundRobin, "a:1", "b:2"))
+	if n.Network != "udp" || n.Address != "localhost:514" || n.BufferSize != 512 || !n.Persistent {
+		t.Errorf("unexpected net settings %+v", n)
+	}
+	if n.KeepAlive != time.Minute || n.IdleTimeout != time.Hour || n.Selection != handler.SelectRoundRobin || len(n.Endpoints) != 2 {
+		t.Errorf("unexpected net settings %+v", n)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	file := handler.NewFile("/dev/null", 0664, types.WARNING, true)
+	buf := handler.NewBuffer(file, 1, types.WARNING, true)
+	logger := NewBuilder().
+		Channel("api").
+		FormattedHandler(file, formatter.NewJSON(nil, true)).
+		Handler(buf).
+		Build()
+	if logger.GetName() != "api" {
+		t.Errorf("expected name api, got %s", logger.GetName())
+	}
+	if hs := logger.GetHandlers(); len(hs) != 2 || hs[0] != file || hs[1] != buf {
+		t.Errorf("unexpected handlers %v", hs)
+	}
+	buf.Close()
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.AddLogger(NewLogger("b"), "", false)
+	r.AddLogger(NewLogger("a"), "", false)
+	if err := r.AddLogger(NewLogger("a"), "", false); err == nil {
+		t.Error("expected error adding an existing logger")
+	}
+	var names []string
+	r.Range(func(name string, l *Logger) bool {
+		names = append(names, name)
+		return true
+	})
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("unexpected names %v", names)
+	}
+	r.Clear()
+	if err := r.AddLogger(NewLogger("a"), "", false); err != nil {
+		t.Errorf("expected add after clear to succeed, got %v", err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	defaultMu.RLock()
+	prev := defaultLogger
+	defaultMu.RUnlock()
+	defer SetDefault(prev)
+
+	// an invalid environment falls back to info records on stderr
+	os.Setenv(EnvLevel, "loud")
+	SetDefault(nil)
+	l := Default()
+	os.Unsetenv(EnvLevel)
+	if l.GetName() != filepath.Base(os.Args[0]) || len(l.GetHandlers()) != 1 {
+		t.Errorf("unexpected fallback logger %s with %d handlers", l.GetName(), len(l.GetHandlers()))
+	}
+	if Default() != l {
+		t.Error("expected the default logger to be created once")
+	}
+
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%LevelName% %Message% %Context%\n", ""))))
+	SetDefault(logger)
+	if Default() != logger {
+		t.Fatal("expected the logger set by SetDefault")
+	}
+	Log(types.NOTICE, "log")
+	Debug("debug")
+	Info("info")
+	Notice("notice")
+	Warning("warning")
+	Error("error")
+	Critical("critical")
+	Alert("alert")
+	Emergency("emergency")
+	WithError(errors.New("boom")).Error("failed")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{"notice log", "debug debug", "info info", "notice notice", "warning warning",
+		"error error", "critical critical", "alert alert", "emergency emergency", "error failed"}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d records, got %q", len(want), out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w+" ") {
+			t.Errorf("expected %q, got %q", w, lines[i])
+		}
+	}
+	if !strings.Contains(lines[9], `"message":"boom"`) {
+		t.Errorf("expected the error in %q", lines[9])
+	}
+
+	// GetLogger prefers the registered ancestors to the default logger
+	app := NewLogger("llogtest")
+	DefaultRegistry().AddLogger(app, "", true)
+	defer DefaultRegistry().RemoveLogger("llogtest")
+	defer DefaultRegistry().RemoveLogger("llogtest.db")
+	if l := GetLogger("llogtest.db"); l.GetName() != "llogtest.db" || l.GetParent() != app {
+		t.Errorf("expected a child of the registered ancestor, got %s", l.GetName())
+	}
+	if l := GetLogger("unregistered.db"); l.GetName() != "unregistered.db" || l.GetParent() != logger {
+		t.Errorf("expected a child of the default logger, got %s", l.GetName())
+	}
+}
+
+// flushHandler counts its flushes and closes.
+type flushHandler struct {
+	err     error
+	flushes int
+	closes  int
+}
+
+func (h *flushHandler) IsHandling(record *types.Record) bool { return true }
+func (h *flushHandler) Handle(record *types.Record) bool     { return false }
+func (h *flushHandler) HandleBatch(records []*types.Record)  {}
+func (h *flushHandler) Close()                               { h.closes++ }
+func (h *flushHandler) Flush() error {
+	h.flushes++
+	return h.err
+}
+
+// errCloseHandler fails to close.
+type errCloseHandler struct {
+	flushHandler
+}
+
+func (h *errCloseHandler) CloseErr() error {
+	h.closes++
+	return errors.New("close failed")
+}
+
+func TestFlushClose(t *testing.T) {
+	ok, failing, errClose := &flushHandler{}, &flushHandler{err: errors.New("flush failed")}, &errCloseHandler{}
+	logger := NewLogger("app")
+	logger.PushHandler(ok)
+	logger.PushHandler(failing)
+	logger.PushHandler(errClose)
+	logger.PushHandler(handler.NewStream(ioutil.Discard, types.DEBUG, true))
+	if err := logger.Flush(); err == nil || err.Error() != "flush failed" {
+		t.Errorf("expected the flush error, got %v", err)
+	}
+	if ok.flushes != 1 || failing.flushes != 1 || errClose.flushes != 1 {
+		t.Errorf("expected every flusher flushed once, got %d %d %d", ok.flushes, failing.flushes, errClose.flushes)
+	}
+
+	var reported error
+	logger.SetErrorHandler(func(err error) { reported = err })
+	logger.Close()
+	if ok.closes != 1 || failing.closes != 1 || errClose.closes != 1 {
+		t.Errorf("expected every handler closed once, got %d %d %d", ok.closes, failing.closes, errClose.closes)
+	}
+	if reported == nil || reported.Error() != "close failed" {
+		t.Errorf("expected the close error reported, got %v", reported)
+	}
+}
+
+func TestRegistryAll(t *testing.T) {
+	r := NewRegistry()
+	shared, failing := &flushHandler{}, &flushHandler{err: errors.New("flush failed")}
+	a, b := NewLogger("a"), NewLogger("b")
+	a.PushHandler(shared)
+	b.PushHandler(shared)
+	b.PushHandler(failing)
+	r.AddLogger(a, "", false)
+	r.AddLogger(b, "", false)
+
+	r.SetLevel(types.ERROR)
+	if a.GetLevel() != types.ERROR || b.GetLevel() != types.ERROR {
+		t.Errorf("expected the level set on every logger, got %d %d", a.GetLevel(), b.GetLevel())
+	}
+	if err := r.FlushAll(); err == nil || err.Error() != "flush failed" {
+		t.Errorf("expected the flush error, got %v", err)
+	}
+	if shared.flushes != 2 || failing.flushes != 1 {
+		t.Errorf("expected every logger flushed, got %d %d", shared.flushes, failing.flushes)
+	}
+	r.CloseAll()
+	if shared.closes != 1 || failing.closes != 1 {
+		t.Errorf("expected the shared handler closed once, got %d %d", shared.closes, failing.closes)
+	}
+}
+
+func TestRegistryGetOrCreate(t *testing.T) {
+	r := NewRegistry()
+	calls := 0
+	r.Register("lazy", func() *Logger {
+		calls++
+		return NewLogger("lazy")
+	})
+	l1, err := r.GetOrCreate("lazy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, _ := r.GetOrCreate("lazy")
+	if l1 != l2 || calls != 1 {
+		t.Errorf("expected one shared logger, factory called %d times", calls)
+	}
+	if _, err := r.GetOrCreate("missing"); err == nil {
+		t.Error("expected error without factory")
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry()
+	app := NewLogger("app")
+	file := handler.NewFile("/dev/null", 0664, types.DEBUG, true)
+	app.PushHandler(file)
+	r.AddLogger(app, "", false)
+
+	l, err := r.Lookup("app.db.queries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.GetName() != "app.db.queries" || l.GetParent() != app {
+		t.Errorf("expected child of app, got %s", l.GetName())
+	}
+	if !l.IsHandling(types.DEBUG) {
+		t.Error("expected inherited handlers to handle records")
+	}
+	// the level of the ancestor applies until the child sets its own
+	app.SetLevel(types.ERROR)
+	if l.GetLevel() != types.ERROR || l.IsHandling(types.WARNING) {
+		t.Errorf("expected the ancestor level, got %d", l.GetLevel())
+	}
+	l.SetLevel(types.DEBUG)
+	app.SetLevel(types.INFO)
+	if l.GetLevel() != types.DEBUG {
+		t.Errorf("expected the child level, got %d", l.GetLevel())
+	}
+	if _, err := r.Lookup("other"); err == nil {
+		t.Error("expected error without registered ancestor")
+	}
+}
+
+func TestClone(t *testing.T) {
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewFile("/dev/null", 0664, types.DEBUG, true))
+	clone := logger.Clone("app.db")
+	clone.PushHandler(handler.NewFile("/dev/null", 0664, types.DEBUG, true))
+	if clone.GetName() != "app.db" || len(clone.GetHandlers()) != 2 {
+		t.Errorf("unexpected clone %s with %d handlers", clone.GetName(), len(clone.GetHandlers()))
+	}
+	if len(logger.GetHandlers()) != 1 {
+		t.Error("expected the original logger to be unchanged")
+	}
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLogfmt(""))))
+	func() {
+		defer RecoverAndLog(logger)
+		panic("boom")
+	}()
+	if !strings.Contains(out.String(), "level=critical") || !strings.Contains(out.String(), "panic=boom") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%LevelName% %Message%\n", ""))))
+	w := NewWriter(logger, types.WARNING)
+	p := []byte("first\r\n\nsecond\nthird")
+	if n, err := w.Write(p); n != len(p) || err != nil {
+		t.Fatalf("expected %d bytes written, got %d, %v", len(p), n, err)
+	}
+	if want := "warning first\nwarning second\nwarning third\n"; out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+
+	out.Reset()
+	w = NewWriter(logger, types.DEBUG)
+	logger.SetLevel(types.INFO)
+	w.Write([]byte("hidden\n"))
+	if out.Len() != 0 {
+		t.Errorf("expected the level of the logger to apply, got %q", out.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]int{"debug": types.DEBUG, "WARNING": types.WARNING, "Emergency": types.EMERGENCY} {
+		if level, err := ParseLevel(name); err != nil || level != want {
+			t.Errorf("%s: expected %d, got %d, %v", name, want, level, err)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		os.Unsetenv(EnvLevel)
+		os.Unsetenv(EnvFormat)
+		os.Unsetenv(EnvOutput)
+	}()
+
+	tests := []struct {
+		level, format string
+		err           bool
+		want          string
+	}{
+		{"", "", false, "info: shown"},
+		{"warning", "", false, ""},
+		{"DEBUG", "text", false, "debug: hidden"},
+		{"debug", "JSON", false, `"Message":"hidden"`},
+		{"", "logfmt", false, "msg=shown"},
+		{"loud", "", true, ""},
+		{"", "xml", true, ""},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("%d.log", i))
+		os.Setenv(EnvLevel, tt.level)
+		os.Setenv(EnvFormat, tt.format)
+		os.Setenv(EnvOutput, path)
+		logger, err := FromEnv()
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q %q: expected an error", tt.level, tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q %q: %v", tt.level, tt.format, err)
+		}
+		if logger.GetName() != filepath.Base(os.Args[0]) {
+			t.Errorf("expected the program name, got %s", logger.GetName())
+		}
+		logger.Debug("hidden")
+		logger.Info("shown")
+		logger.Close()
+		b, _ := ioutil.ReadFile(path)
+		if tt.want == "" && len(b) != 0 || !strings.Contains(string(b), tt.want) {
+			t.Errorf("%q %q: expected %q, got %q", tt.level, tt.format, tt.want, b)
+		}
+	}
+
+	for _, output := range []string{"", "stderr", "stdout"} {
+		os.Unsetenv(EnvLevel)
+		os.Unsetenv(EnvFormat)
+		os.Setenv(EnvOutput, output)
+		logger, err := FromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := logger.GetHandlers()[0].(*handler.Stream); !ok {
+			t.Errorf("%q: expected a stream handler, got %T", output, logger.GetHandlers()[0])
+		}
+	}
+}
+
+func TestLogfmtQuoting(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"plain", " v=plain\n"},
+		{"", ` v=""` + "\n"},
+		{"two words", ` v="two words"` + "\n"},
+		{"a=b", ` v="a=b"` + "\n"},
+		{`say "hi"`, ` v="say \"hi\""` + "\n"},
+		{"tab\there", ` v="tab\there"` + "\n"},
+		{"line\nbreak", ` v="line\nbreak"` + "\n"},
+		{"bell\a", ` v="bell\a"` + "\n"},
+		{"\xff", ` v="\xff"` + "\n"},
+		{"héllo", " v=héllo\n"},
+		{42, " v=42\n"},
+		{true, " v=true\n"},
+		{1.5, " v=1.500\n"},
+		{1500 * time.Millisecond, " v=1.5s\n"},
+		{errors.New("not found"), ` v="not found"` + "\n"},
+		{&codeError{42}, ` v="{\"code\":42}"` + "\n"},
+		{[]int{1, 2}, " v=[1,2]\n"},
+		{map[string]string{"a": "b c"}, ` v="{\"a\":\"b c\"}"` + "\n"},
+	}
+	f := formatter.NewLogfmt("")
+	for _, tt := range tests {
+		record := &types.Record{Level: types.INFO, LevelName: "info", Message: "m", Channel: "app",
+			Context: types.RecordContext{"v": tt.value}, Formatted: new(bytes.Buffer)}
+		if err := f.Format(record); err != nil {
+			t.Fatal(err)
+		}
+		if got := record.Formatted.String(); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%#v: expected suffix %q, got %q", tt.value, tt.want, got)
+		}
+	}
+
+	// keys are never quoted, the runes they can't hold are replaced
+	record := &types.Record{Level: types.INFO, LevelName: "info", Message: "m", Channel: "app",
+		Context: types.RecordContext{"a key=\"x\"": 1}, Formatted: new(bytes.Buffer)}
+	f.Format(record)
+	if got := record.Formatted.String(); !strings.HasSuffix(got, " a_key__x_=1\n") {
+		t.Errorf("unexpected key in %q", got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	var out bytes.Buffer
+	s := handler.NewStreamWith(&out, handler.WithLevel(types.INFO), handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("app")
+	logger.PushHandler(s)
+	logger.Debug("hidden")
+	logger.Info("a")
+	logger.LogBatch([]Entry{{Level: types.INFO, Message: "b"}, {Level: types.ERROR, Message: "c"}})
+	if out.String() != "a\nb\nc\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if stats := s.HandlerStats(); stats.Handled != 3 || stats.Errors != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	failing := handler.NewStreamWith(failingWriter{})
+	logger = NewLogger("app")
+	logger.PushHandler(failing)
+	logger.Info("lost")
+	logger.LogBatch([]Entry{{Level: types.INFO, Message: "lost"}})
+	if stats := failing.HandlerStats(); stats.Errors != 2 {
+		t.Errorf("expected 2 write errors, got %+v", stats)
+	}
+}
+
+type stackError struct {
+	msg string
+	pcs []uintptr
+}
+
+func (e *stackError) Error() string         { return e.msg }
+func (e *stackError) StackTrace() []uintptr { return e.pcs }
+
+type wrapError struct {
+	err error
+}
+
+func (e *wrapError) Error() string { return "wrapped: " + e.err.Error() }
+func (e *wrapError) Unwrap() error { return e.err }
+
+func TestWithError(t *testing.T) {
+	pcs := make([]uintptr, 8)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	e := types.NewError(&wrapError{&stackError{"boom", pcs}})
+	if e.Message != "wrapped: boom" || e.Cause == nil || e.Cause.Message != "boom" {
+		t.Fatalf("unexpected chain %+v", e)
+	}
+	if len(e.Cause.Stack) == 0 || !strings.HasSuffix(e.Cause.Stack[0].Function, "TestWithError") {
+		t.Errorf("unexpected stack %+v", e.Cause.Stack)
+	}
+
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewJSON(nil, true))))
+	logger.WithError(errors.New("boom")).Error("failed")
+	if !strings.Contains(out.String(), `\"message\":\"boom\"`) {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestRecordSeq(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Seq% %UnixNano%\n", ""))))
+	logger.Info("a")
+	logger.Info("b")
+	var seq1, seq2, ns1, ns2 int64
+	if _, err := fmt.Sscan(out.String(), &seq1, &ns1, &seq2, &ns2); err != nil {
+		t.Fatal(err)
+	}
+	if seq2 != seq1+1 || ns2 < ns1 {
+		t.Errorf("unexpected order %q", out.String())
+	}
+}
+
+func TestRotatingFileClock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+	logger := NewLogger("test")
+	logger.SetClock(clock)
+	r := handler.NewRotatingFileWith(filepath.Join(dir, "app.log"), 0, handler.WithClock(clock))
+	logger.PushHandler(r)
+	logger.Info("first day")
+	clock.Add(24 * time.Hour)
+	logger.Info("second day")
+	r.Close()
+	for _, name := range []string{"app-2020-01-01.log", "app-2020-01-02.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSetClockConcurrent(t *testing.T) {
+	logger := NewLogger("test")
+	logger.PushHandler(handler.NewStreamWith(ioutil.Discard))
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			logger.Info("record")
+		}
+		close(done)
+	}()
+	clock := types.NewManualClock(time.Now())
+	for i := 0; i < 100; i++ {
+		logger.SetClock(clock)
+		logger.SetClock(nil)
+	}
+	<-done
+	if logger.GetClock() != types.SystemClock {
+		t.Error("expected the system clock once reset")
+	}
+}
+
+func TestRotatingFileFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the records are dated days apart to rotate, while the handler flushes on the system clock
+	clock := types.NewManualClock(time.Now())
+	logger := NewLogger("test")
+	logger.SetClock(clock)
+	r := handler.NewRotatingFileWith(filepath.Join(dir, "app.log"), 0, handler.WithFlushInterval(time.Millisecond))
+	logger.PushHandler(r)
+	for day := 0; day < 10; day++ {
+		clock.Add(24 * time.Hour)
+		for i := 0; i < 5; i++ {
+			logger.Info("record")
+			time.Sleep(200 * time.Microsecond)
+		}
+		if day%3 == 0 {
+			r.Close()
+		}
+	}
+	r.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(files) != 10 {
+		t.Errorf("expected 10 files, got %d", len(files))
+	}
+}
+
+func TestLevelMap(t *testing.T) {
+	var debug, errs bytes.Buffer
+	f := handler.WithFormatter(formatter.NewLine("%LevelName% %Message%\n", ""))
+	m := handler.NewLevelMap(true).
+		Set(types.DEBUG, handler.NewStreamWith(&debug, f)).
+		SetRange(types.ERROR, types.EMERGENCY, handler.NewStreamWith(&errs, f))
+	logger := NewLogger("app")
+	logger.PushHandler(m)
+	logger.Debug("a")
+	logger.Info("b")
+	logger.Critical("c")
+	if debug.String() != "debug a\n" || errs.String() != "critical c\n" {
+		t.Errorf("unexpected routing %q %q", debug.String(), errs.String())
+	}
+}
+
+type resultHandler struct {
+	result types.Result
+	calls  int
+}
+
+func (h *resultHandler) IsHandling(record *types.Record) bool { return true }
+func (h *resultHandler) Handle(record *types.Record) bool {
+	return h.HandleResult(record).Action == types.Stop
+}
+func (h *resultHandler) HandleBatch(records []*types.Record) {}
+func (h *resultHandler) Close()                              {}
+func (h *resultHandler) HandleResult(record *types.Record) types.Result {
+	h.calls++
+	return h.result
+}
+
+func TestHandleResult(t *testing.T) {
+	last := &resultHandler{result: types.Result{Action: types.Handled}}
+	first := &resultHandler{result: types.Result{Action: types.Handled, Err: errors.New("disk full")}}
+	logger := NewLogger("app")
+	logger.PushHandler(last)
+	logger.PushHandler(first)
+	if _, err := logger.AddRecord(types.INFO, "a"); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+	first.result = types.Result{Action: types.Stop}
+	logger.AddRecord(types.INFO, "b")
+	if first.calls != 2 || last.calls != 1 {
+		t.Errorf("expected the chain to stop, got %d %d calls", first.calls, last.calls)
+	}
+}
+
+type failingHandler struct{}
+
+func (failingHandler) IsHandling(record *types.Record) bool { return true }
+func (failingHandler) Handle(record *types.Record) (bool, error) {
+	return false, errors.New("write failed")
+}
+func (failingHandler) HandleBatch(records []*types.Record) error { return nil }
+func (failingHandler) Close() error                              { return errors.New("close failed") }
+
+func TestErrorHandler(t *testing.T) {
+	var errs []string
+	logger := NewLogger("app")
+	logger.PushHandler2(failingHandler{})
+	logger.SetErrorHandler(func(err error) {
+		errs = append(errs, err.Error())
+	})
+	logger.Child("app.db").Info("a")
+	logger.Close()
+	if strings.Join(errs, ",") != "write failed,close failed" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var app, audit bytes.Buffer
+	f := handler.WithFormatter(formatter.NewLine("%Message%\n", ""))
+	r := handler.NewRouter(handler.NewStreamWith(&app, f), true).
+		Route("audit", handler.NewStreamWith(&audit, f))
+	logger := NewLogger("app")
+	logger.PushHandler(r)
+	logger.Info("started")
+	logger.Target("audit").Info("user deleted")
+	logger.Target("unknown").Info("fallback")
+	if app.String() != "started\nfallback\n" || audit.String() != "user deleted\n" {
+		t.Errorf("unexpected routing %q %q", app.String(), audit.String())
+	}
+}
+
+func TestEvent(t *testing.T) {
+	var events, logs bytes.Buffer
+	router := handler.NewRouter(handler.NewStreamWith(&logs, handler.WithFormatter(formatter.NewLogfmt(""))), true).
+		Route(types.EventRoute, handler.NewStreamWith(&events, handler.WithFormatter(formatter.NewJSON([]string{"Message", "Context"}, true))))
+	logger := NewLogger("app")
+	logger.PushHandler(router)
+	e := types.Event{Name: "order.deleted", Actor: "bob", Subject: "42", Payload: map[string]interface{}{"reason": "fraud"}}
+	logger.With(types.RecordContext{"request": "r1"}).Event(e)
+	logger.Info("diagnostic")
+
+	want := `{"Context":"{\"request\":\"r1\"}","Event":"{\"actor\":\"bob\",\"name\":\"order.deleted\",\"payload\":{\"reason\":\"fraud\"},\"subject\":\"42\"}","Message":"order.deleted"}` + "\n"
+	if events.String() != want {
+		t.Errorf("unexpected event %q", events.String())
+	}
+	if strings.Contains(logs.String(), "order.deleted") || !strings.Contains(logs.String(), "msg=diagnostic") {
+		t.Errorf("unexpected logs %q", logs.String())
+	}
+
+	logs.Reset()
+	logger.Target("audit").Event(types.Event{Name: "login", Actor: "bob"})
+	if !strings.Contains(logs.String(), " msg=login event=login actor=bob _target=audit\n") {
+		t.Errorf("expected the event routed by its hint, got %q", logs.String())
+	}
+}
+
+func TestEventLevelAndSampling(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.SetLevel(types.ERROR)
+	stream := handler.NewStreamWith(&out, handler.WithLevel(types.ERROR), handler.WithFormatter(formatter.NewLine("%Message% %Event% %Context%\n", "")))
+	logger.PushHandler(handler.NewSampler(stream, time.Second, 1, 0))
+	for i := 0; i < 3; i++ {
+		logger.Event(types.Event{Name: "order.deleted", Actor: "bob"})
+	}
+	logger.Info("dropped")
+	want := strings.Repeat(`order.deleted {"actor":"bob","name":"order.deleted"} {}`+"\n", 3)
+	if out.String() != want {
+		t.Errorf("expected the events to pass the levels and the sampling, got %q", out.String())
+	}
+
+	// without %Event%, the event is written in the context
+	out.Reset()
+	logger.PopHandler()
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Message% %Context%\n", ""))))
+	logger.Event(types.Event{Name: "login", Payload: map[string]interface{}{"at": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}})
+	if out.String() != `login {"_event":{"name":"login","payload":{"at":"2020-01-01T00:00:00Z"}}}`+"\n" {
+		t.Errorf("unexpected event %q", out.String())
+	}
+}
+
+func TestTimedScope(t *testing.T) {
+	var out bytes.Buffer
+	f := formatter.NewLogfmt("")
+	f.SetSortKeys(true)
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	logger := NewLogger("app")
+	logger.SetClock(clock)
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(f)))
+	logger.SetScopeThreshold(100 * time.Millisecond)
+	child := logger.With(types.RecordContext{"request": "r1"})
+
+	done := child.TimedScope("db.query", types.RecordContext{"table": "users"})
+	clock.Add(10 * time.Millisecond)
+	done(nil)
+	if out.Len() != 0 {
+		t.Errorf("expected the fast scope skipped, got %q", out.String())
+	}
+	done = child.TimedScope("db.query", types.RecordContext{"table": "users"})
+	clock.Add(150 * time.Millisecond)
+	done(nil)
+	if !strings.HasSuffix(out.String(), "level=info channel=app msg=db.query elapsed=150ms request=r1 success=true table=users\n") {
+		t.Errorf("unexpected scope %q", out.String())
+	}
+	out.Reset()
+	done = child.TimedScope("db.query", nil)
+	done(errors.New("timeout"))
+	if !strings.HasSuffix(out.String(), "level=error channel=app msg=db.query elapsed=0s error=timeout request=r1 success=false\n") {
+		t.Errorf("unexpected failed scope %q", out.String())
+	}
+}
+
+func TestLogEvery(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%LevelName% %Message% %Context%\n", ""))))
+	for i := 0; i < 7; i++ {
+		logger.With(types.RecordContext{"i": i}).InfoOnce("deprecated", "config format deprecated")
+		logger.ErrorEvery("retry", 3, "retrying")
+	}
+	want := "info config format deprecated {\"i\":0}\n" +
+		"error retrying null\n" +
+		"error retrying {\"occurrences\":4}\n" +
+		"error retrying {\"occurrences\":7}\n"
+	if out.String() != want {
+		t.Errorf("unexpected records %q", out.String())
+	}
+	out.Reset()
+	logger.Clone("other").InfoOnce("deprecated", "config format deprecated")
+	if out.Len() == 0 {
+		t.Error("expected a clone to count apart")
+	}
+
+	// the occurrences below the level of the logger are not counted
+	out.Reset()
+	logger.SetLevel(types.WARNING)
+	logger.InfoOnce("quiet", "hidden")
+	logger.SetLevel(types.DEBUG)
+	logger.InfoOnce("quiet", "shown")
+	if out.String() != "info shown null\n" {
+		t.Errorf("unexpected records %q", out.String())
+	}
+
+	// a zero-value logger creates its counters on first use
+	var zero Logger
+	zero.WarningOnce("zero", "once")
+	zero.WarningOnce("zero", "once")
+	if n := zero.getOccurrences().next(types.WARNING, "zero"); n != 3 {
+		t.Errorf("expected 3 occurrences, got %d", n)
+	}
+}
+
+func TestLogBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "batch.log")
+	file := handler.NewFileWith(path, handler.WithLevel(types.INFO), handler.WithFormatter(formatter.NewLine("%LevelName% %Message%\n", "")))
+	logger := NewLogger("import")
+	logger.PushHandler(file)
+	n := logger.LogBatch([]Entry{
+		{Level: types.INFO, Message: "a"},
+		{Level: types.DEBUG, Message: "skipped"},
+		{Level: types.ERROR, Message: "b"},
+	})
+	file.Close()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || string(b) != "info a\nerror b\n" {
+		t.Errorf("unexpected batch %d %q", n, b)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	var out bytes.Buffer
+	clock := types.NewManualClock(time.Unix(0, 0))
+	stream := handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewSampler(stream, time.Second, 2, 3, handler.WithClock(clock)))
+	for i := 0; i < 8; i++ {
+		logger.Info("hot")
+	}
+	logger.Info("cold")
+	clock.Add(time.Second)
+	logger.Info("hot")
+	// hot 1, 2, 5, 8, cold, then hot again in the next tick
+	if got := strings.Count(out.String(), "hot\n"); got != 5 || !strings.Contains(out.String(), "cold") {
+		t.Errorf("unexpected sampling %q", out.String())
+	}
+
+	// the level of the sampler applies too, events pass it
+	out.Reset()
+	logger = NewLogger("app")
+	logger.PushHandler(handler.NewSampler(stream, time.Second, 2, 3, handler.WithClock(clock), handler.WithLevel(types.WARNING)))
+	logger.Info("quiet")
+	logger.Warning("loud")
+	logger.Event(types.Event{Name: "order.deleted"})
+	if out.String() != "loud\norder.deleted\n" {
+		t.Errorf("unexpected records %q", out.String())
+	}
+}
+
+func TestUnitFields(t *testing.T) {
+	var out bytes.Buffer
+	f := formatter.NewLogfmt("")
+	f.SetNumericUnits(true)
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(f)))
+	logger.AddRecordFields(nil, types.INFO, "uploaded", types.RecordContext{
+		"elapsed": 1500 * time.Millisecond,
+		"size":    types.Size(1536 * 1024),
+	})
+	for _, want := range []string{"elapsed=1.5s", "elapsed_ms=1500.000", "size=1.5MiB", "size_bytes=1572864"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %s in %q", want, out.String())
+		}
+	}
+
+	// without the numeric units, durations keep their encoding in nanoseconds
+	out.Reset()
+	logger.PopHandler()
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewJSON(nil, true))))
+	logger.AddRecordFields(nil, types.INFO, "uploaded", types.RecordContext{"elapsed": 1500 * time.Millisecond})
+	if !strings.Contains(out.String(), `\"elapsed\":1500000000`) {
+		t.Errorf("unexpected duration encoding %q", out.String())
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	cases := map[formatter.Multiline]string{
+		formatter.MultilineRaw:    "a\nb\n",
+		formatter.MultilineEscape: "a\\nb\n",
+		formatter.MultilineIndent: "a\n\tb\n",
+		formatter.MultilineJSON:   "\"a\\nb\"\n",
+	}
+	for mode, want := range cases {
+		var out bytes.Buffer
+		f := formatter.NewLine("%Message%\n", "")
+		f.SetMultiline(mode)
+		logger := NewLogger("app")
+		logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(f)))
+		logger.Info("a\nb")
+		if out.String() != want {
+			t.Errorf("mode %d: expected %q, got %q", mode, want, out.String())
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	var out bytes.Buffer
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	logger := NewLogger("app")
+	logger.SetClock(clock)
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Datetime%\n", time.RFC3339))))
+	if err := logger.SetTimezone("Asia/Tokyo"); err != nil {
+		t.Skip(err)
+	}
+	logger.Child("app.db").Info("a")
+	if out.String() != "2020-01-01T21:00:00+09:00\n" {
+		t.Errorf("unexpected timestamp %q", out.String())
+	}
+	if err := logger.SetTimezone("Nowhere/Unknown"); err == nil {
+		t.Error("expected an unknown timezone error")
+	}
+}
+
+func TestDefaultDateFormat(t *testing.T) {
+	var out bytes.Buffer
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 123456789, time.UTC))
+	logger := NewLogger("app")
+	logger.SetClock(clock)
+	micro := formatter.NewLine("%Datetime%\n", formatter.RFC3339Micro)
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(micro)))
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Datetime%\n", ""))))
+	logger.Info("a")
+	if out.String() != "2020-01-01T12:00:00.123456789Z\n2020-01-01T12:00:00.123456Z\n" {
+		t.Errorf("unexpected timestamps %q", out.String())
+	}
+}
+
+func TestInternalLogger(t *testing.T) {
+	var out bytes.Buffer
+	internal := NewLogger("app")
+	internal.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Channel%.%LevelName%: %Message%\n", ""))))
+	SetInternalLogger(internal)
+	defer SetInternalLogger(nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	n := handler.NewNetWith("tcp", addr)
+	logger := NewLogger("app")
+	logger.PushHandler(n)
+	logger.Info("lost")
+	if h := n.Health(); h.Connected || h.LastError == nil {
+		t.Errorf("unexpected health %+v", h)
+	}
+	if out.String() != "llog.warning: record dropped\n" {
+		t.Errorf("unexpected internal records %q", out.String())
+	}
+}
+
+// gateHandler blocks on each record until released.
+type gateHandler struct {
+	started chan bool
+	release chan bool
+}
+
+func (h *gateHandler) IsHandling(record *types.Record) bool { return true }
+func (h *gateHandler) Handle(record *types.Record) bool {
+	h.started <- true
+	<-h.release
+	return false
+}
+func (h *gateHandler) HandleBatch(records []*types.Record) {}
+func (h *gateHandler) Close()                              {}
+
+func TestBufferOverflow(t *testing.T) {
+	var spilled bytes.Buffer
+	gate := &gateHandler{make(chan bool), make(chan bool)}
+	spill := handler.NewStreamWith(&spilled, handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	buf := handler.NewBufferWith(gate, handler.WithBufferSize(1), handler.WithOverflow(handler.OverflowSpill, spill))
+	logger := NewLogger("app")
+	logger.PushHandler(buf)
+
+	logger.Info("a")
+	<-gate.started
+	logger.Info("b")
+	logger.Info("c")
+	logger.Info("d")
+	if spilled.String() != "c\nd\n" {
+		t.Errorf("unexpected spilled records %q", spilled.String())
+	}
+	if s := buf.Stats(); s.Spilled != 2 || s.Blocked != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	close(gate.release)
+	go func() {
+		for range gate.started {
+		}
+	}()
+	buf.Close()
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := handler.NewDiskQueue(dir, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"first", "second", "third"} {
+		if err := q.Push([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Push(make([]byte, 33)); err != handler.ErrEntryTooLarge || q.Len() != 3 {
+		t.Errorf("expected an oversized entry to be rejected, got %v", err)
+	}
+	p, _ := q.Peek()
+	q.Pop()
+	q.Close()
+	if string(p) != "first" {
+		t.Errorf("unexpected entry %q", p)
+	}
+
+	// reopened after a torn write
+	f, _ := os.OpenFile(filepath.Join(dir, "00000003.seg"), os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 0, 9, 1})
+	f.Close()
+	q, err = handler.NewDiskQueue(dir, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Push([]byte("fourth"))
+	if q.Len() != 3 {
+		t.Errorf("unexpected length %d", q.Len())
+	}
+	var got []string
+	for {
+		p, err := q.Peek()
+		if err != nil {
+			break
+		}
+		got = append(got, string(p))
+		q.Pop()
+	}
+	if strings.Join(got, ",") != "second,third,fourth" {
+		t.Errorf("unexpected entries %v", got)
+	}
+}
+
+// flakySender fails until up, then collects what it is sent.
+type flakySender struct {
+	mu    sync.Mutex
+	up    bool
+	sends int
+	sent  []string
+}
+
+func (s *flakySender) Send(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sends++
+	if !s.up {
+		return errors.New("unreachable")
+	}
+	s.sent = append(s.sent, string(p))
+	return nil
+}
+
+func (s *flakySender) Sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.sent...)
+}
+
+func (s *flakySender) Sends() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sends
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := types.NewManualClock(time.Now())
+	sender := &flakySender{}
+	spool, err := handler.NewSpool(sender, dir, time.Second,
+		handler.WithClock(clock), handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := NewLogger("app")
+	logger.PushHandler(spool)
+	logger.Info("a")
+	logger.Info("b")
+
+	sender.mu.Lock()
+	sender.up = true
+	sender.mu.Unlock()
+	for i := 0; i < 100 && len(sender.Sent()) < 2; i++ {
+		clock.Add(time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+	spool.Close()
+	if strings.Join(sender.Sent(), "") != "a\nb\n" {
+		t.Errorf("unexpected sent records %q", sender.Sent())
+	}
+	if spool.Health().Backlog != 0 {
+		t.Errorf("unexpected backlog %d", spool.Health().Backlog)
+	}
+}
+
+func TestSpoolRetryInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := types.NewManualClock(time.Now())
+	sender := &flakySender{}
+	spool, err := handler.NewSpool(sender, dir, time.Hour,
+		handler.WithClock(clock), handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	logger := NewLogger("app")
+	logger.PushHandler(spool)
+	for i := 0; i < 10; i++ {
+		logger.Info("a")
+		time.Sleep(time.Millisecond)
+	}
+	if n := sender.Sends(); n != 1 {
+		t.Errorf("expected the records queued after a failure to wait for the retry, got %d sends", n)
+	}
+	clock.Add(time.Hour)
+	for deadline := time.Now().Add(time.Second); sender.Sends() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := sender.Sends(); n != 2 {
+		t.Errorf("expected a retry on the tick, got %d sends", n)
+	}
+}
+
+func TestSpoolDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := types.NewManualClock(time.Now())
+	spool, err := handler.NewSpool(&flakySender{}, filepath.Join(dir, "queue"), time.Second,
+		handler.WithClock(clock), handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadLetter := filepath.Join(dir, "dead.log")
+	spool.SetDeadLetter(2, deadLetter)
+	logger := NewLogger("app")
+	logger.PushHandler(spool)
+	logger.Info("lost")
+
+	for i := 0; i < 100 && spool.Health().Backlog > 0; i++ {
+		clock.Add(time.Second)
+		time.Sleep(10 * time.Millisecond)
+	}
+	spool.Close()
+	data, _ := ioutil.ReadFile(deadLetter)
+	if string(data) != "lost\n" {
+		t.Errorf("unexpected dead letters %q", data)
+	}
+}
+
+func TestNetTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	n := handler.NewNetWith("tcp", addr, handler.WithTLS(&tls.Config{RootCAs: pool}))
+	if err := n.Send([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	n = handler.NewNetWith("tcp", addr, handler.WithTLS(&tls.Config{}))
+	if err := n.Send([]byte("GET / HTTP/1.0\r\n\r\n")); err == nil {
+		t.Error("expected an unknown authority error")
+	}
+}
+
+func TestProxyDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		got <- req.Method + " " + req.Host
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		line, _ := r.ReadString('\n')
+		got <- line
+	}()
+
+	dialer, err := handler.NewProxyDialer("http://"+ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := handler.NewNetWith("tcp", "logs.example.com:514", handler.WithDialer(dialer))
+	if err := n.Send([]byte("tunneled\n")); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-got; req != "CONNECT logs.example.com:514" {
+		t.Errorf("unexpected request %q", req)
+	}
+	if line := <-got; line != "tunneled\n" {
+		t.Errorf("unexpected line %q", line)
+	}
+}
+
+func TestProxyDialerBufferedTunnel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		// the first tunneled bytes come along with the response
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nhello\n"))
+	}()
+
+	dialer, err := handler.NewProxyDialer("http://"+ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.Dial("tcp", "logs.example.com:514")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if line != "hello\n" {
+		t.Errorf("unexpected tunneled bytes %q %v", line, err)
+	}
+}
+
+func TestProxyDialerTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// accepts and never answers the handshake
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, scheme := range []string{"http", "socks5"} {
+		dialer, err := handler.NewProxyDialer(scheme+"://"+ln.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dialer.Dial("udp", "logs.example.com:514"); err != handler.ErrProxyNetwork {
+			t.Errorf("%s: expected udp to be rejected, got %v", scheme, err)
+		}
+		n := handler.NewNetWith("tcp", "logs.example.com:514", handler.WithDialer(dialer))
+		start := time.Now()
+		if err := n.SendDeadline([]byte("a\n"), time.Now().Add(50*time.Millisecond)); !isTimeoutErr(err) {
+			t.Errorf("%s: expected a timeout, got %v", scheme, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("%s: the dial timeout was not honoured, took %v", scheme, d)
+		}
+	}
+}
+
+// isTimeoutErr Whether err is a network timeout.
+func isTimeoutErr(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// serveSMTP accepts one SMTP session offering AUTH PLAIN, sending the message to got.
+func serveSMTP(ln net.Listener, got chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+	var data bytes.Buffer
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case inData && line == ".\r\n":
+			inData = false
+			got <- data.String()
+			fmt.Fprint(conn, "250 OK\r\n")
+		case inData:
+			data.WriteString(line)
+		case strings.HasPrefix(line, "EHLO"):
+			fmt.Fprint(conn, "250-localhost\r\n250 AUTH PLAIN\r\n")
+		case strings.HasPrefix(line, "AUTH"):
+			fmt.Fprint(conn, "235 OK\r\n")
+		case strings.HasPrefix(line, "DATA"):
+			inData = true
+			fmt.Fprint(conn, "354 go ahead\r\n")
+		case strings.HasPrefix(line, "QUIT"):
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 OK\r\n")
+		}
+	}
+}
+
+func TestMailIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("no IPv6 loopback")
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go serveSMTP(ln, got)
+
+	mail := handler.NewMailWith(ln.Addr().String(), "user", "secret", "app@example.com", "alert", []string{"ops@example.com"},
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("app")
+	logger.PushHandler(mail)
+	var reported error
+	logger.SetErrorHandler(func(err error) { reported = err })
+	logger.Error("disk full")
+	if reported != nil {
+		t.Fatal(reported)
+	}
+	if msg := <-got; !strings.HasSuffix(msg, "\r\n\r\ndisk full\r\n") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+// errHandler fails every record while down.
+type errHandler struct {
+	down    bool
+	handled int
+}
+
+func (h *errHandler) IsHandling(record *types.Record) bool { return true }
+func (h *errHandler) Handle(record *types.Record) bool {
+	return h.HandleResult(record).Action == types.Stop
+}
+func (h *errHandler) HandleBatch(records []*types.Record) {}
+func (h *errHandler) Close()                              {}
+func (h *errHandler) HandleResult(record *types.Record) types.Result {
+	if h.down {
+		return types.Result{Err: errors.New("down")}
+	}
+	h.handled++
+	return types.Result{Action: types.Handled}
+}
+
+func TestBreaker(t *testing.T) {
+	var fallback bytes.Buffer
+	clock := types.NewManualClock(time.Now())
+	sink := &errHandler{down: true}
+	b := handler.NewBreaker(sink, 2, time.Minute,
+		handler.NewStreamWith(&fallback, handler.WithFormatter(formatter.NewLine("%Message%\n", ""))),
+		handler.WithClock(clock))
+	logger := NewLogger("app")
+	logger.PushHandler(b)
+
+	logger.Info("a")
+	logger.Info("b")
+	logger.Info("c")
+	if b.State() != handler.BreakerOpen || fallback.String() != "c\n" {
+		t.Errorf("unexpected state %d, fallback %q", b.State(), fallback.String())
+	}
+	sink.down = false
+	logger.Info("d")
+	clock.Add(time.Minute)
+	logger.Info("e")
+	if b.State() != handler.BreakerClosed || sink.handled != 1 {
+		t.Errorf("unexpected state %d, %d handled", b.State(), sink.handled)
+	}
+	if s := b.Stats(); s.Fallback != 2 || s.Opened != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var fallback bytes.Buffer
+	gate := &gateHandler{make(chan bool, 1), make(chan bool)}
+	h := handler.NewTimeout(gate, 10*time.Millisecond,
+		handler.NewStreamWith(&fallback, handler.WithFormatter(formatter.NewLine("%Message%\n", ""))))
+	logger := NewLogger("app")
+	logger.PushHandler(h)
+
+	logger.Info("slow")
+	<-gate.started
+	// skips the handler stuck on the slow record
+	logger.Info("next")
+	if fallback.String() != "slow\nnext\n" || h.Expired() != 2 {
+		t.Errorf("unexpected fallback %q, %d expired", fallback.String(), h.Expired())
+	}
+	close(gate.release)
+}
+
+func TestHandlerProcessorIsolation(t *testing.T) {
+	var a, b bytes.Buffer
+	f := formatter.NewLine("%Message% %Extra%\n", "")
+	tagged := handler.NewStreamWith(&a, handler.WithFormatter(f))
+	tagged.PushProcessor(func(record *types.Record, _ ...interface{}) {
+		record.Extra["tag"] = "a"
+	})
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&b, handler.WithFormatter(f)))
+	logger.PushHandler(tagged)
+	logger.Info("x")
+	if a.String() != "x {\"tag\":\"a\"}\n" || b.String() != "x {}\n" {
+		t.Errorf("unexpected records %q %q", a.String(), b.String())
+	}
+
+	record := types.NewRecord()
+	record.Context = types.RecordContext{"k": 1}
+	c := record.Clone()
+	c.Context["k"] = 2
+	if record.Context["k"] != 1 {
+		t.Error("clone shares its context")
+	}
+}
+
+func TestMergePolicy(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Context% %Extra%\n", ""))))
+	logger.PushProcessor(func(record *types.Record, _ ...interface{}) {
+		record.Extra["user"] = "processor"
+	})
+
+	logger.With(types.RecordContext{"user": "bound"}).AddRecordFields(nil, types.INFO, "x", types.RecordContext{"user": "call"})
+	logger.SetMergePolicy(MergeKeepFirst, "")
+	logger.With(types.RecordContext{"user": "bound"}).AddRecordFields(nil, types.INFO, "x", types.RecordContext{"user": "call"})
+	logger.SetMergePolicy(MergePrefix, "")
+	logger.With(types.RecordContext{"user": "bound"}).AddRecordFields(nil, types.INFO, "x", types.RecordContext{"user": "call"})
+
+	expected := `{} {"user":"processor"}` + "\n" +
+		`{"user":"bound"} {}` + "\n" +
+		`{"dup.user":"call","user":"bound"} {"dup.user":"processor"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("unexpected records %q", out.String())
+	}
+}
+
+func TestRecordGetters(t *testing.T) {
+	record := types.NewRecord()
+	record.Context = types.RecordContext{"n": int32(3), "s": "4", "err": errors.New("failed")}
+	record.Extra = types.RecordExtra{"b": "true", "n": "extra"}
+
+	if n, ok := record.GetInt("n"); !ok || n != 3 {
+		t.Errorf("unexpected int %d", n)
+	}
+	if n, ok := record.GetInt("s"); !ok || n != 4 {
+		t.Errorf("unexpected int %d", n)
+	}
+	if b, ok := record.GetBool("b"); !ok || !b {
+		t.Error("unexpected bool")
+	}
+	if err, ok := record.GetError("err"); !ok || err.Error() != "failed" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if s, _ := record.GetString("n"); s != "3" || record.HasKey("missing") {
+		t.Errorf("unexpected string %q", s)
+	}
+	var keys []string
+	record.Walk(func(key string, value interface{}, extra bool) bool {
+		keys = append(keys, fmt.Sprint(key, extra))
+		return true
+	})
+	if strings.Join(keys, ",") != "errfalse,nfalse,sfalse,btrue,ntrue" {
+		t.Errorf("unexpected walk %v", keys)
+	}
+}
+
+func TestRecordCodec(t *testing.T) {
+	record := types.NewRecord()
+	record.Seq = 7
+	record.Level = types.ERROR
+	record.LevelName = "error"
+	record.Channel = "app"
+	record.Datetime = time.Date(2020, 1, 1, 12, 0, 0, 5, time.UTC)
+	record.Message = "failed"
+	record.Context = types.RecordContext{"n": 1}
+	record.Extra = types.RecordExtra{"pid": 2}
+
+	codecs := []struct {
+		encode func(*types.Record) ([]byte, error)
+		decode func([]byte, *types.Record) error
+	}{
+		{types.EncodeJSON, types.DecodeJSON},
+		{types.EncodeBinary, types.DecodeBinary},
+	}
+	for _, c := range codecs {
+		data, err := c.encode(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := types.NewRecord()
+		if err := c.decode(data, got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Seq != 7 || got.Level != types.ERROR || got.Channel != "app" || got.Message != "failed" ||
+			!got.Datetime.Equal(record.Datetime) || got.Context["n"] != float64(1) || got.Extra["pid"] != float64(2) {
+			t.Errorf("unexpected decoded record %+v", got)
+		}
+	}
+	if err := types.DecodeJSON([]byte(`{"v":99}`), types.NewRecord()); err != types.ErrSchemaVersion {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRing(t *testing.T) {
+	ring := handler.NewRing(2, handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("app")
+	logger.PushHandler(ring)
+	logger.Info("a")
+	logger.Info("b")
+	logger.Info("c")
+
+	snapshot := ring.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Message != "b" || snapshot[1].Message != "c" {
+		t.Errorf("unexpected snapshot %v", snapshot)
+	}
+	w := httptest.NewRecorder()
+	ring.ServeHTTP(w, httptest.NewRequest("GET", "/?n=1", nil))
+	if w.Body.String() != "c\n" {
+		t.Errorf("unexpected response %q", w.Body.String())
+	}
+}
+
+func TestCrashDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ring := handler.NewRing(10, handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("app")
+	logger.PushHandler(ring)
+	SetCrashDump(ring, dir)
+	defer SetCrashDump(nil, "")
+
+	logger.Info("before")
+	func() {
+		defer RecoverAndLog(logger)
+		panic("boom")
+	}()
+	files, _ := filepath.Glob(filepath.Join(dir, "crash-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("unexpected crash files %v", files)
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	if !strings.HasPrefix(string(data), "before\n\npanic: boom\n") {
+		t.Errorf("unexpected crash dump %q", data)
+	}
+
+	// a dump failing to be written is reported
+	var reported error
+	logger.SetErrorHandler(func(err error) { reported = err })
+	SetCrashDump(ring, filepath.Join(files[0], "dumps"))
+	func() {
+		defer RecoverAndLog(logger)
+		panic("boom")
+	}()
+	if reported == nil {
+		t.Error("expected the crash dump failure to be reported")
+	}
+}
+
+func TestLogGoroutines(t *testing.T) {
+	ring := handler.NewRing(1)
+	logger := NewLogger("app")
+	logger.PushHandler(ring)
+	LogGoroutines(logger, "dump")
+	record := ring.Snapshot()[0]
+	stack, _ := record.GetString("stack")
+	if n, _ := record.GetInt("goroutines"); n < 1 || !strings.Contains(stack, "TestLogGoroutines") {
+		t.Errorf("unexpected dump %v", record.Context)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(&resultHandler{result: types.Result{Err: errors.New("broken")}})
+	logger.SetMirror(handler.NewStreamWith(&out, handler.WithLevel(types.CRITICAL), handler.WithFormatter(formatter.NewLine("%Message%\n", ""))))
+	child := logger.Child("db")
+	child.Info("ignored")
+	child.Critical("fatal")
+	if out.String() != "fatal\n" {
+		t.Errorf("unexpected mirrored records %q", out.String())
+	}
+}
+
+func TestTenant(t *testing.T) {
+	clock := types.NewManualClock(time.Now())
+	outs := make(map[string]*bytes.Buffer)
+	tenants := handler.NewTenant(func(tenant string) (types.IHandler, error) {
+		outs[tenant] = new(bytes.Buffer)
+		return handler.NewStreamWith(outs[tenant], handler.WithFormatter(formatter.NewLine("%Message%\n", ""))), nil
+	}, time.Minute, nil, handler.WithClock(clock))
+	logger := NewLogger("app")
+	logger.PushHandler(tenants)
+
+	logger.Tenant("acme").Info("a")
+	logger.Tenant("globex").Info("b")
+	logger.Info("no tenant")
+	clock.Add(time.Minute)
+	logger.Tenant("acme").Info("c")
+	if outs["acme"].String() != "a\nc\n" || outs["globex"].String() != "b\n" {
+		t.Errorf("unexpected tenant records %q %q", outs["acme"].String(), outs["globex"].String())
+	}
+	if open := tenants.Tenants(); len(open) != 1 || open[0] != "acme" {
+		t.Errorf("unexpected open tenants %v", open)
+	}
+	tenants.Close()
+}
+
+func TestFieldLists(t *testing.T) {
+	var full, siem bytes.Buffer
+	f := formatter.NewLine("%Context%\n", "")
+	stable := handler.NewStreamWith(&siem, handler.WithFormatter(f))
+	stable.PushProcessor(processor.Fields([]string{"user", "http.*"}, []string{"http.body"}))
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&full, handler.WithFormatter(f)))
+	logger.PushHandler(stable)
+	logger.AddRecordFields(nil, types.INFO, "x", types.RecordContext{"user": 1, "http.status": 200, "http.body": "...", "debug": true})
+	if siem.String() != `{"http.status":200,"user":1}`+"\n" || !strings.Contains(full.String(), "debug") {
+		t.Errorf("unexpected fields %q %q", siem.String(), full.String())
+	}
+}
+
+func TestRotatingFileChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+	logger := NewLogger("test")
+	logger.SetClock(clock)
+	r := handler.NewRotatingFileWith(filepath.Join(dir, "app.log"), 0,
+		handler.WithClock(clock), handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	manifest := filepath.Join(dir, "MANIFEST")
+	r.SetChecksum(manifest)
+	rotated := make(chan string, 1)
+	r.OnRotate(func(path string) { rotated <- path })
+	logger.PushHandler(r)
+	logger.Info("first day")
+	clock.Add(24 * time.Hour)
+	logger.Info("second day")
+	r.Close()
+
+	path := <-rotated
+	if filepath.Base(path) != "app-2020-01-01.log" {
+		t.Errorf("unexpected rotated file %s", path)
+	}
+	sum := sha256.Sum256([]byte("first day\n"))
+	line := hex.EncodeToString(sum[:]) + "  app-2020-01-01.log\n"
+	sidecar, _ := ioutil.ReadFile(path + ".sha256")
+	m, _ := ioutil.ReadFile(manifest)
+	if string(sidecar) != line || string(m) != line {
+		t.Errorf("unexpected checksums %q %q", sidecar, m)
+	}
+}
+
+func TestRotatingFileMemFS(t *testing.T) {
+	fs := handler.NewMemFS()
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+	logger := NewLogger("test")
+	logger.SetClock(clock)
+	r := handler.NewRotatingFileWith("/logs/app.log", 2, handler.WithClock(clock), handler.WithFS(fs),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	rotated := make(chan string, 3)
+	r.OnRotate(func(path string) { rotated <- path })
+	logger.PushHandler(r)
+	for _, msg := range []string{"day 1", "day 2", "day 3"} {
+		logger.Info(msg)
+		clock.Add(24 * time.Hour)
+	}
+	logger.Info("day 4")
+	r.Close()
+	for i := 0; i < 3; i++ {
+		<-rotated
+	}
+	// old files are removed after the rotation callbacks
+	var files []string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if files, _ = fs.Glob("/logs/app-*.log"); len(files) == 2 {
+			break
+		}
+	}
+	if len(files) != 2 || files[0] != "/logs/app-2020-01-03.log" {
+		t.Fatalf("unexpected files %v", files)
+	}
+	if b, _ := fs.ReadFile("/logs/app-2020-01-04.log"); string(b) != "day 4\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestRotatingFilePrune(t *testing.T) {
+	fs := handler.NewMemFS()
+	for _, name := range []string{"app-2020-01-03.log", "app-2020-01-01.log", "app-2020-01-01.log.sha256",
+		"app-2020-01-02.log", "app-backup.log", "app-2020-01-04.log"} {
+		f, _ := fs.OpenFile("/logs/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	clock := types.NewManualClock(time.Date(2020, 1, 4, 12, 0, 0, 0, time.Local))
+	r := handler.NewRotatingFileWith("/logs/app.log", 2, handler.WithClock(clock), handler.WithFS(fs))
+	candidates, err := r.PruneCandidates()
+	if err != nil || !reflect.DeepEqual(candidates, []string{"/logs/app-2020-01-01.log", "/logs/app-2020-01-02.log"}) {
+		t.Fatalf("unexpected candidates %v %v", candidates, err)
+	}
+	if files, _ := fs.Glob("/logs/*"); len(files) != 6 {
+		t.Fatalf("dry run removed files %v", files)
+	}
+	removed, err := r.PruneNow()
+	if err != nil || !reflect.DeepEqual(removed, candidates) {
+		t.Fatalf("unexpected removed files %v %v", removed, err)
+	}
+	files, _ := fs.Glob("/logs/*")
+	if !reflect.DeepEqual(files, []string{"/logs/app-2020-01-03.log", "/logs/app-2020-01-04.log", "/logs/app-backup.log"}) {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestRotatingFileTokens(t *testing.T) {
+	fs := handler.NewMemFS()
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+	r := handler.NewRotatingFileWith("/logs/app.log", 2, handler.WithClock(clock), handler.WithFS(fs),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	if err := r.SetFilenameFormat("{filename}-{hostname}-{pid}-{instance}-{date}", handler.FilePerDay); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetFilenameToken("instance", "a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"date", "", "{x}"} {
+		if r.SetFilenameToken(name, "b") == nil {
+			t.Errorf("expected token %q to be rejected", name)
+		}
+	}
+	if r.SetFilenameToken("instance", "../b") == nil {
+		t.Error("expected a path to be rejected")
+	}
+	host, _ := os.Hostname()
+	want := fmt.Sprintf("/logs/app-%s-%d-a-2020-01-01.log", host, os.Getpid())
+	if r.Path != want {
+		t.Fatalf("expected %s, got %s", want, r.Path)
+	}
+	f, _ := fs.OpenFile(fmt.Sprintf("/logs/app-%s-%d-b-2019-12-31.log", host, os.Getpid()), os.O_CREATE|os.O_WRONLY, 0644)
+	f.Close()
+	for i := 0; i < 2; i++ {
+		f, _ = fs.OpenFile(fmt.Sprintf("/logs/app-%s-%d-a-2019-12-%d.log", host, os.Getpid(), 29+i), os.O_CREATE|os.O_WRONLY, 0644)
+		f.Close()
+	}
+	candidates, err := r.PruneCandidates()
+	if err != nil || len(candidates) != 1 || candidates[0] != fmt.Sprintf("/logs/app-%s-%d-a-2019-12-29.log", host, os.Getpid()) {
+		t.Errorf("unexpected candidates %v %v", candidates, err)
+	}
+}
+
+func TestRotatingFileLocation(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*3600)
+	for _, test := range []struct {
+		loc   *time.Location
+		files []string
+	}{
+		{time.UTC, []string{"/logs/app-2020-01-01.log", "/logs/app-2020-01-02.log"}},
+		{zone, []string{"/logs/app-2020-01-01.log", "/logs/app-2020-01-02.log", "/logs/app-2020-01-03.log"}},
+	} {
+		fs := handler.NewMemFS()
+		clock := types.NewManualClock(time.Date(2020, 1, 1, 23, 30, 0, 0, zone))
+		logger := NewLogger("test")
+		logger.SetClock(clock)
+		r := handler.NewRotatingFileWith("/logs/app.log", 0, handler.WithClock(clock), handler.WithFS(fs),
+			handler.WithFormatter(formatter.NewLine("%Datetime%\n", time.RFC3339)))
+		r.SetLocation(test.loc)
+		logger.PushHandler(r)
+		// 21:30, 22:30, 00:30 and 22:30 UTC
+		for _, d := range []time.Duration{0, time.Hour, 2 * time.Hour, 22 * time.Hour} {
+			clock.Add(d)
+			logger.Info("tick")
+		}
+		r.Close()
+		files, _ := fs.Glob("/logs/app-*.log")
+		if !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%s: unexpected files %v", test.loc, files)
+		}
+		// every record is in the file of its day in the location
+		for _, file := range files {
+			b, _ := fs.ReadFile(file)
+			for _, line := range strings.Fields(string(b)) {
+				at, _ := time.Parse(time.RFC3339, line)
+				if want := "/logs/app-" + at.In(test.loc).Format(handler.FilePerDay) + ".log"; want != file {
+					t.Errorf("%s: record %s in %s", test.loc, line, file)
+				}
+			}
+		}
+	}
+}
+
+func TestRotatingFileRecovery(t *testing.T) {
+	fs := handler.NewMemFS()
+	for name, content := range map[string]string{
+		"app-2019-12-30.log":        "day 0\n",
+		"app-2019-12-30.log.sha256": "sum\n",
+		"app-2019-12-31.log":        "day 1\n",
+		"app-2020-01-01.log":        "day 2\n",
+	} {
+		f, _ := fs.OpenFile("/logs/"+name, os.O_CREATE|os.O_WRONLY, 0644)
+		f.Write([]byte(content))
+		f.Close()
+	}
+	newHandler := func(clock *types.ManualClock) (*handler.RotatingFile, chan string) {
+		r := handler.NewRotatingFileWith("/logs/app.log", 2, handler.WithClock(clock), handler.WithFS(fs),
+			handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+		r.SetChecksum("")
+		rotated := make(chan string, 3)
+		r.OnRotate(func(path string) { rotated <- path })
+		return r, rotated
+	}
+	waitFiles := func(want []string) {
+		var files []string
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if files, _ = fs.Glob("/logs/app-*.log"); reflect.DeepEqual(files, want) {
+				return
+			}
+		}
+		t.Fatalf("unexpected files %v", files)
+	}
+
+	// the previous run stopped before midnight without rotating
+	clock := types.NewManualClock(time.Date(2020, 1, 2, 0, 0, 1, 0, time.Local))
+	r, rotated := newHandler(clock)
+	r.Handle(&types.Record{Level: types.INFO, Message: "day 3", Datetime: clock.Now(), Formatted: new(bytes.Buffer)})
+	for _, want := range []string{"/logs/app-2019-12-31.log", "/logs/app-2020-01-01.log"} {
+		if path := <-rotated; path != want {
+			t.Errorf("expected %s to be recovered, got %s", want, path)
+		}
+	}
+	waitFiles([]string{"/logs/app-2020-01-01.log", "/logs/app-2020-01-02.log"})
+	if _, err := fs.Stat("/logs/app-2020-01-01.log.sha256"); err != nil {
+		t.Error(err)
+	}
+	r.Close()
+
+	// a restart the same day appends to today's file and recovers nothing
+	r, rotated = newHandler(clock)
+	r.Handle(&types.Record{Level: types.INFO, Message: "day 3 again", Datetime: clock.Now(), Formatted: new(bytes.Buffer)})
+	r.Close()
+	if b, _ := fs.ReadFile("/logs/app-2020-01-02.log"); string(b) != "day 3\nday 3 again\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+	select {
+	case path := <-rotated:
+		t.Errorf("unexpected recovery of %s", path)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+type countingWriter struct {
+	io.Writer
+	writes *int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.writes, 1)
+	return w.Writer.Write(p)
+}
+
+func TestPreallocFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog-prealloc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	open := func() (*Logger, *handler.PreallocFile) {
+		pf := handler.NewPreallocFileWith(path, 64*1024, handler.WithBufferSize(4096),
+			handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+		logger := NewLogger("app")
+		logger.PushHandler(pf)
+		return logger, pf
+	}
+
+	logger, pf := open()
+	for i := 0; i < 1000; i++ {
+		logger.Info(fmt.Sprintf("first %d", i))
+	}
+	if fi, _ := os.Stat(path); fi.Size() != 64*1024 {
+		t.Errorf("expected the file to be preallocated, got %d bytes", fi.Size())
+	}
+	// crashed: flushed but not closed, the file ends with the preallocated zeros
+	if err := pf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, pf = open()
+	logger.Info("second")
+	if err := pf.CloseErr(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.Split(string(b), "\n")
+	if bytes.IndexByte(b, 0) >= 0 || len(lines) != 1002 || lines[999] != "first 999" || lines[1000] != "second" {
+		t.Errorf("unexpected content of %d bytes, %d lines, ending %q", len(b), len(lines), lines[len(lines)-3:])
+	}
+}
+
+func TestFileCoalescing(t *testing.T) {
+	fs := handler.NewMemFS()
+	var writes int64
+	f := handler.NewFileWith("/logs/app.log", handler.WithFS(fs), handler.WithCoalescing(),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")),
+		handler.WithWrapper(func(w io.Writer) (io.Writer, error) { return countingWriter{w, &writes}, nil }))
+	logger := NewLogger("app")
+	logger.PushHandler(f)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				logger.Info(fmt.Sprintf("g%d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	f.Close()
+	b, _ := fs.ReadFile("/logs/app.log")
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 1600 {
+		t.Fatalf("expected 1600 records, got %d", len(lines))
+	}
+	// the records of each goroutine are written in order
+	next := make(map[int]int)
+	for _, line := range lines {
+		var g, i int
+		if _, err := fmt.Sscanf(line, "g%d-%d", &g, &i); err != nil {
+			t.Fatalf("garbled record %q", line)
+		}
+		if i != next[g] {
+			t.Fatalf("record %q out of order", line)
+		}
+		next[g]++
+	}
+	if n := atomic.LoadInt64(&writes); n == 0 || n > 1600 {
+		t.Errorf("unexpected writes %d", n)
+	}
+}
+
+func TestHandlerStats(t *testing.T) {
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	var buf bytes.Buffer
+	s := handler.NewStreamWith(&buf, handler.WithClock(clock), handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("test")
+	logger.PushHandler(s)
+	logger.Info("hello")
+	logger.Info("world")
+	stats := s.HandlerStats()
+	if stats.Handled != 2 || stats.Bytes != 12 || stats.Errors != 0 || !stats.LastErrorTime.IsZero() {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	failing := handler.NewStreamWith(failingWriter{}, handler.WithClock(clock))
+	logger.SetHandlers([]types.IHandler{failing})
+	logger.Info("lost")
+	stats = failing.HandlerStats()
+	if stats.Handled != 0 || stats.Errors != 1 || !stats.LastErrorTime.Equal(clock.Now()) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	var _ types.StatsReporter = handler.NewBuffer(s, 10, types.DEBUG, true)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestFormatterFraming(t *testing.T) {
+	j := formatter.NewJSON([]string{"Message"}, true)
+	records := []*types.Record{{Message: "a"}, {Message: "b"}}
+	for _, record := range records {
+		record.Formatted = new(bytes.Buffer)
+		j.Format(record)
+	}
+	tests := []struct {
+		framing     types.Framing
+		body        string
+		contentType string
+	}{
+		{types.FramingLines, "{\"Message\":\"a\"}\n{\"Message\":\"b\"}\n", "application/x-ndjson"},
+		{types.FramingArray, "[{\"Message\":\"a\"},{\"Message\":\"b\"}]", "application/json"},
+		{types.FramingBulk, "{\"index\":{}}\n{\"Message\":\"a\"}\n{\"index\":{}}\n{\"Message\":\"b\"}\n", "application/x-ndjson"},
+	}
+	for _, test := range tests {
+		j.SetFraming(test.framing)
+		body, contentType := formatter.Frame(j, records)
+		if string(body) != test.body || contentType != test.contentType {
+			t.Errorf("framing %d: unexpected batch %q %s", test.framing, body, contentType)
+		}
+	}
+	if formatter.ContentType(formatter.NewLine("", "")) != formatter.DefaultContentType {
+		t.Error("unexpected line content type")
+	}
+}
+
+func TestTee(t *testing.T) {
+	var console, file bytes.Buffer
+	calls := 0
+	tee := handler.NewTee(types.INFO, true).
+		Add(formatter.NewLine("%LevelName% %Message%\n", ""), &console).
+		Add(formatter.NewJSON([]string{"Message", "Extra"}, true), &file)
+	tee.PushProcessor(func(record *types.Record, _ ...interface{}) {
+		calls++
+		record.Extra["n"] = calls
+	})
+	logger := NewLogger("test")
+	logger.PushHandler(tee)
+	logger.Debug("skipped")
+	logger.Info("hello")
+	if console.String() != "info hello\n" || file.String() != "{\"Extra\":\"{\\\"n\\\":1}\",\"Message\":\"hello\"}\n" {
+		t.Errorf("unexpected outputs %q %q", console.String(), file.String())
+	}
+	if calls != 1 {
+		t.Errorf("processors ran %d times", calls)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var stdout, stderr, notices bytes.Buffer
+	c := handler.NewConsoleWith(handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	c.Stdout, c.Stderr = &stdout, &stderr
+	c.SetWriter(types.NOTICE, &notices)
+	logger := NewLogger("test")
+	logger.PushHandler(c)
+	logger.Info("a")
+	logger.Notice("b")
+	logger.Warning("c")
+	logger.Error("d")
+	if stdout.String() != "a\n" || notices.String() != "b\n" || stderr.String() != "c\nd\n" {
+		t.Errorf("unexpected streams %q %q %q", stdout.String(), notices.String(), stderr.String())
+	}
+	stdout.Reset()
+	stderr.Reset()
+	c.SetStderrLevel(types.ERROR)
+	logger.Warning("c")
+	logger.Error("d")
+	if stdout.String() != "c\n" || stderr.String() != "d\n" {
+		t.Errorf("unexpected streams %q %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestPresets(t *testing.T) {
+	logger := NewDevelopment()
+	c := logger.GetHandlers()[0].(*handler.Console)
+	var stdout, stderr bytes.Buffer
+	c.Stdout, c.Stderr = &stdout, &stderr
+	logger.Debug("multi\nline")
+	logger.Warning("careful")
+	if !strings.Contains(stdout.String(), "\x1b[90mdebug\x1b[0m multi\n\tline") ||
+		!strings.Contains(stdout.String(), `"caller":"logger_test.go:`) {
+		t.Errorf("unexpected development output %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "\x1b[33mwarning\x1b[0m careful") {
+		t.Errorf("unexpected development errors %q", stderr.String())
+	}
+
+	logger = NewProduction()
+	if _, ok := logger.GetHandlers()[0].(*handler.Sampler); !ok {
+		t.Errorf("expected a sampled production handler, got %T", logger.GetHandlers()[0])
+	}
+}
+
+func TestHandlerChannels(t *testing.T) {
+	var buf bytes.Buffer
+	s := handler.NewStreamWith(&buf, handler.WithChannels("db.*", "http"),
+		handler.WithFormatter(formatter.NewLine("%Channel% %Message%\n", "")))
+	for _, channel := range []string{"db.query", "http", "httpd", "db"} {
+		logger := NewLogger(channel)
+		logger.PushHandler(s)
+		logger.Info("hello")
+	}
+	if buf.String() != "db.query hello\nhttp hello\n" {
+		t.Errorf("unexpected records %q", buf.String())
+	}
+}
+
+// countingStringer counts its renderings.
+type countingStringer struct{ n *int }
+
+func (s countingStringer) String() string {
+	*s.n++
+	return "value"
+}
+
+func TestTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger("test")
+	logger.PushHandler(handler.NewStreamWith(&buf, handler.WithLevel(types.INFO),
+		handler.WithFormatter(formatter.NewJSON([]string{"Message", "Template"}, true))))
+	renders := 0
+	logger.Debugf("skipped %v", countingStringer{&renders})
+	if renders != 0 {
+		t.Error("unhandled record rendered")
+	}
+	var record *types.Record
+	logger.PushProcessor(func(r *types.Record, _ ...interface{}) {
+		record = r.Clone()
+	})
+	logger.Infof("user %s logged in %d times", "bob", 3)
+	if buf.String() != "{\"Message\":\"user bob logged in 3 times\",\"Template\":\"user %s logged in %d times\"}\n" {
+		t.Errorf("unexpected record %q", buf.String())
+	}
+	for _, codec := range []struct {
+		encode func(*types.Record) ([]byte, error)
+		decode func([]byte, *types.Record) error
+	}{{types.EncodeJSON, types.DecodeJSON}, {types.EncodeBinary, types.DecodeBinary}} {
+		data, err := codec.encode(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := types.NewRecord()
+		if err := codec.decode(data, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Template != record.Template || !reflect.DeepEqual(decoded.Args, []interface{}{"bob", float64(3)}) {
+			t.Errorf("unexpected decoded template %q %v", decoded.Template, decoded.Args)
+		}
+	}
+	// the records of a template share their fingerprint
+	first := record
+	logger.Infof("user %s logged in %d times", "ann", 1)
+	if handler.Fingerprint(record) != handler.Fingerprint(first) {
+		t.Error("expected the records of a template to share their fingerprint")
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	var buf bytes.Buffer
+	var alerts []handler.Alert
+	a := handler.NewAlerts(func(alert handler.Alert) { alerts = append(alerts, alert) },
+		handler.NewStreamWith(&buf, handler.WithFormatter(formatter.NewLine("%Message% %Context%\n", ""))),
+		handler.WithClock(clock))
+	a.AddRule(handler.AlertRule{Name: "payments", MinLevel: types.ERROR, Channel: "payments", Threshold: 3, Window: time.Minute})
+	logger := NewLogger("payments")
+	logger.SetClock(clock)
+	logger.PushHandler(a)
+	for i := 0; i < 2; i++ {
+		logger.Error("declined")
+		clock.Add(20 * time.Second)
+	}
+	logger.Warning("slow")
+	clock.Add(30 * time.Second) // the first error leaves the window
+	logger.Error("declined")
+	if len(alerts) != 0 {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+	logger.Error("declined")
+	logger.Error("declined") // cooling down
+	if len(alerts) != 1 || alerts[0].Rule != "payments" || alerts[0].Count != 3 {
+		t.Fatalf("unexpected alerts %+v", alerts)
+	}
+	if !strings.HasPrefix(buf.String(), "alert payments: 3 records since 2020-01-01T12:00:20Z, last: declined") {
+		t.Errorf("unexpected alert record %q", buf.String())
+	}
+
+	// once cooled down, the alert covers the last records only
+	clock.Add(time.Minute)
+	for i := 0; i < 4; i++ {
+		logger.Error("declined")
+		clock.Add(time.Second)
+	}
+	if len(alerts) != 2 || alerts[1].Count != 3 || !alerts[1].First.Equal(time.Date(2020, 1, 1, 12, 2, 10, 0, time.UTC)) {
+		t.Errorf("unexpected alerts %+v", alerts)
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	path := filepath.Join(dir, "app.log")
+	f := handler.NewFileWith(path, handler.WithClock(clock), handler.WithFlushInterval(time.Second),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	defer f.Close()
+	logger := NewLogger("test")
+	logger.PushHandler(f)
+	logger.Info("hello")
+	if b, _ := ioutil.ReadFile(path); len(b) != 0 {
+		t.Fatalf("expected a buffered record, got %q", b)
+	}
+	clock.Add(time.Second)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if b, _ := ioutil.ReadFile(path); string(b) == "hello\n" {
+			return
+		}
+	}
+	t.Error("the record was not flushed")
+}
+
+// tickerClock counts the running tickers of a manual clock.
+type tickerClock struct {
+	*types.ManualClock
+	running int32
+}
+
+func (c *tickerClock) NewTicker(d time.Duration) types.Ticker {
+	atomic.AddInt32(&c.running, 1)
+	return &countedTicker{c.ManualClock.NewTicker(d), c}
+}
+
+type countedTicker struct {
+	types.Ticker
+	clock *tickerClock
+}
+
+func (t *countedTicker) Stop() {
+	t.Ticker.Stop()
+	atomic.AddInt32(&t.clock.running, -1)
+}
+
+func TestFlushIntervalStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := &tickerClock{ManualClock: types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))}
+	waitRunning := func(want int32) {
+		for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&clock.running) != want; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d running tickers, got %d", want, atomic.LoadInt32(&clock.running))
+			}
+		}
+	}
+	f := handler.NewFileWith(filepath.Join(dir, "app.log"), handler.WithClock(clock), handler.WithFlushInterval(time.Second),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	logger := NewLogger("test")
+	logger.PushHandler(f)
+	waitRunning(0)
+	logger.Info("opened")
+	waitRunning(1)
+	f.Close()
+	waitRunning(0)
+	// a write after Close reopens the file and flushes it again
+	logger.Info("reopened")
+	waitRunning(1)
+	f.Close()
+	waitRunning(0)
+}
+
+type batchHandler struct {
+	sync.Mutex
+	batches [][]string
+}
+
+func (h *batchHandler) IsHandling(record *types.Record) bool { return true }
+func (h *batchHandler) Handle(record *types.Record) bool {
+	h.HandleBatch([]*types.Record{record})
+	return false
+}
+func (h *batchHandler) HandleBatch(records []*types.Record) {
+	messages := make([]string, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, record.Message)
+	}
+	h.Lock()
+	h.batches = append(h.batches, messages)
+	h.Unlock()
+}
+func (h *batchHandler) Close() {}
+func (h *batchHandler) len() int {
+	h.Lock()
+	defer h.Unlock()
+	return len(h.batches)
+}
+
+func TestBatching(t *testing.T) {
+	inner := &batchHandler{}
+	buf := handler.NewBufferWith(inner, handler.WithBatching(handler.Batching{MaxRecords: 2}))
+	logger := NewLogger("test")
+	logger.PushHandler(buf)
+	logger.Info("a")
+	logger.Info("b")
+	logger.Info("c")
+	buf.Close()
+	if !reflect.DeepEqual(inner.batches, [][]string{{"a", "b"}, {"c"}}) {
+		t.Errorf("unexpected batches %v", inner.batches)
+	}
+
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	inner = &batchHandler{}
+	buf = handler.NewBufferWith(inner, handler.WithClock(clock),
+		handler.WithBatching(handler.Batching{MaxRecords: 10, MaxLinger: time.Second}))
+	defer buf.Close()
+	logger = NewLogger("test")
+	logger.PushHandler(buf)
+	logger.Info("a")
+	for deadline := time.Now().Add(time.Second); inner.len() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the batch did not linger out")
+		}
+		clock.Add(time.Second)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := handler.Retry{MaxAttempts: 3, Base: 100 * time.Millisecond, Max: time.Second}
+	var backoffs []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		backoffs = append(backoffs, r.Backoff(attempt))
+	}
+	ms := time.Millisecond
+	if !reflect.DeepEqual(backoffs, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, time.Second, time.Second}) {
+		t.Errorf("unexpected backoffs %v", backoffs)
+	}
+	r.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := r.Backoff(2); d < 100*ms || d > 200*ms {
+			t.Fatalf("unexpected jittered backoff %v", d)
+		}
+	}
+
+	r = handler.Retry{MaxAttempts: 3}
+	calls := 0
+	err := r.Do(types.SystemClock, func() error {
+		calls++
+		return handler.Retryable(errors.New("unavailable"))
+	})
+	if calls != 3 || err == nil || err.Error() != "unavailable" {
+		t.Errorf("expected 3 attempts, got %d: %v", calls, err)
+	}
+	calls = 0
+	r.Do(types.SystemClock, func() error {
+		calls++
+		return errors.New("bad request")
+	})
+	if calls != 1 {
+		t.Errorf("expected no retry of a permanent error, got %d attempts", calls)
+	}
+	if !handler.IsRetryable(&net.OpError{Op: "dial", Err: errors.New("refused")}) {
+		t.Error("expected network errors to be retryable")
+	}
+
+	dir, err := ioutil.TempDir("", "llog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spool, err := handler.NewSpool(&flakySender{}, filepath.Join(dir, "queue"), time.Hour,
+		handler.WithRetry(handler.Retry{Base: time.Millisecond}),
+		handler.WithFormatter(formatter.NewLine("%Message%\n", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadLetter := filepath.Join(dir, "dead.log")
+	spool.SetDeadLetter(0, deadLetter)
+	logger := NewLogger("app")
+	logger.PushHandler(spool)
+	logger.Info("rejected")
+	for deadline := time.Now().Add(time.Second); spool.Health().Backlog > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	spool.Close()
+	if data, _ := ioutil.ReadFile(deadLetter); string(data) != "rejected\n" {
+		t.Errorf("expected the permanent failure to be dead lettered, got %q", data)
+	}
+}
+
+func TestNetEndpoints(t *testing.T) {
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := down.Addr().String()
+	down.Close()
+	got := make(chan string, 4)
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		addr := ln.Addr().String()
+		addrs = append(addrs, addr)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				conn.Close()
+				got <- addr + " " + line
+			}
+		}()
+	}
+
+	n := handler.NewNetWith("tcp", "", handler.WithEndpoints(handler.SelectFailover, downAddr, addrs[0]))
+	if err := n.Send([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-got; line != addrs[0]+" a\n" {
+		t.Errorf("expected a failover, got %q", line)
+	}
+
+	n = handler.NewNetWith("tcp", "", handler.WithEndpoints(handler.SelectRoundRobin, addrs[0], downAddr, addrs[1]))
+	for i, m := range []string{"b\n", "c\n", "d\n"} {
+		if err := n.Send([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+		if line, want := <-got, addrs[i%2]+" "+m; line != want {
+			t.Errorf("expected %q, got %q", want, line)
+		}
+	}
+}
+
+func TestNetEndpointsConcurrent(t *testing.T) {
+	var counts [2]int32
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		addrs = append(addrs, ln.Addr().String())
+		count := &counts[i]
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(count, 1)
+				conn.Close()
+			}
+		}()
+	}
+
+	n := handler.NewNetWith("tcp", "", handler.WithEndpoints(handler.SelectRoundRobin, addrs...))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				n.Send([]byte("a\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&counts[0])+atomic.LoadInt32(&counts[1]) < 40 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if a, b := atomic.LoadInt32(&counts[0]), atomic.LoadInt32(&counts[1]); a != 20 || b != 20 {
+		t.Errorf("expected the connections spread evenly, got %d and %d", a, b)
+	}
+}
+
+func TestNetIdleTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go ioutil.ReadAll(conn)
+		}
+	}()
+
+	clock := types.NewManualClock(time.Now())
+	n := handler.NewNetWith("tcp", ln.Addr().String(), handler.WithPersistent(true), handler.WithClock(clock),
+		handler.WithKeepAlive(30*time.Second), handler.WithIdleTimeout(time.Minute))
+	defer n.Close()
+	n.Send([]byte("a\n"))
+	clock.Add(30 * time.Second)
+	n.Send([]byte("b\n"))
+	clock.Add(time.Minute)
+	if err := n.Send([]byte("c\n")); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&accepted) < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&accepted); got != 2 {
+		t.Errorf("expected a reconnection after the idle timeout, got %d connections", got)
+	}
+}
+
+func TestNetConcurrent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go ioutil.ReadAll(conn)
+		}
+	}()
+
+	clock := types.NewManualClock(time.Now())
+	n := handler.NewNetWith("tcp", ln.Addr().String(), handler.WithPersistent(true), handler.WithClock(clock),
+		handler.WithIdleTimeout(time.Second))
+	defer n.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := n.Send([]byte("a\n")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		clock.Add(time.Second)
+		if i%5 == 0 {
+			n.CloseErr()
+		}
+	}
+	wg.Wait()
+}
+
+func TestNetUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collector.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("unix sockets not supported: ", err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		got <- line
+	}()
+
+	n := handler.NewNetWith("tcp", "unix://"+path)
+	if err := n.Send([]byte("local\n")); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-got; line != "local\n" {
+		t.Errorf("unexpected line %q", line)
+	}
+	if network, addr := handler.SplitAddress("udp", "127.0.0.1:514"); network != "udp" || addr != "127.0.0.1:514" {
+		t.Errorf("unexpected split %s %s", network, addr)
+	}
+}
+
+func TestNetBatch(t *testing.T) {
+	newRecords := func() []*types.Record {
+		var records []*types.Record
+		for _, msg := range []string{"a", "b", "c"} {
+			records = append(records, &types.Record{Level: types.INFO, Message: msg, Formatted: new(bytes.Buffer)})
+		}
+		return records
+	}
+	f := handler.WithFormatter(formatter.NewLine("%Message%\n", ""))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		got <- string(b)
+	}()
+	n := handler.NewNetWith("tcp", ln.Addr().String(), f)
+	n.HandleBatch(newRecords())
+	if stats := n.HandlerStats(); stats.Handled != 3 || stats.Errors != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if b := <-got; b != "a\nb\nc\n" {
+		t.Errorf("unexpected stream %q", b)
+	}
+
+	// a datagram per record
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	u := handler.NewNetWith("udp", pc.LocalAddr().String(), f)
+	u.HandleBatch(newRecords())
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	for _, want := range []string{"a\n", "b\n", "c\n"} {
+		k, _, err := pc.ReadFrom(buf)
+		if err != nil || string(buf[:k]) != want {
+			t.Fatalf("expected datagram %q, got %q %v", want, buf[:k], err)
+		}
+	}
+}
+
+type account struct {
+	ID       int
+	Name     string
+	Password string
+}
+
+func TestRegisterType(t *testing.T) {
+	formatter.RegisterType(account{}, func(v interface{}) interface{} {
+		a := v.(account)
+		return map[string]interface{}{"id": a.ID, "name": a.Name}
+	})
+	defer formatter.RegisterType(account{}, nil)
+
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Context%\n", ""))))
+	logger.AddRecordFields(nil, types.INFO, "login", types.RecordContext{
+		"user":   account{ID: 1, Name: "ann", Password: "secret"},
+		"admins": []interface{}{&account{ID: 2, Name: "bob", Password: "secret"}},
+	})
+	if out.String() != `{"admins":[{"id":2,"name":"bob"}],"user":{"id":1,"name":"ann"}}`+"\n" {
+		t.Errorf("unexpected context %s", out.String())
+	}
+
+	// the record encodings render the registered types as well
+	record := types.NewRecord()
+	record.Context = types.RecordContext{"user": account{ID: 1, Name: "ann", Password: "secret"}}
+	for _, encode := range []func(*types.Record) ([]byte, error){types.EncodeJSON, types.EncodeBinary} {
+		if data, err := encode(record); err != nil || bytes.Contains(data, []byte("secret")) {
+			t.Errorf("unexpected encoding %q %v", data, err)
+		}
+	}
+}
+
+type token string
+
+func (t token) LogValue() interface{} {
+	if len(t) > 4 {
+		return string(t[:4]) + "..."
+	}
+	return string(t)
+}
+
+func TestLogValuer(t *testing.T) {
+	var out bytes.Buffer
+	f := formatter.NewLogfmt("")
+	f.SetSortKeys(true)
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(f)))
+	logger.AddRecordFields(nil, types.INFO, "auth", types.RecordContext{
+		"token":  token("abcdefgh"),
+		"nested": map[string]interface{}{"token": token("ab")},
+	})
+	if !strings.HasSuffix(out.String(), ` nested="{\"token\":\"ab\"}" token=abcd...`+"\n") {
+		t.Errorf("unexpected record %q", out.String())
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	var out bytes.Buffer
+	f := formatter.NewLogfmt("")
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(f)))
+	ctx := types.RecordContext{"d": 4, "b": 2, "a": 1, "c": 3, "e": 5}
+	logger.AddRecordFields(nil, types.INFO, "unsorted", ctx)
+	for _, want := range []string{" a=1", " b=2", " c=3", " d=4", " e=5"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %s in %q", want, out.String())
+		}
+	}
+	f.SetSortKeys(true)
+	for i := 0; i < 5; i++ {
+		out.Reset()
+		logger.AddRecordFields(nil, types.INFO, "sorted", ctx)
+		if !strings.HasSuffix(out.String(), " a=1 b=2 c=3 d=4 e=5\n") {
+			t.Fatalf("unexpected record %q", out.String())
+		}
+	}
+}
+
+func TestJSONEscaping(t *testing.T) {
+	msg := "<b>café</b> \\u2028 \u2028 😀"
+	tests := []struct {
+		set  func(f *formatter.JSON)
+		want string
+	}{
+		{func(f *formatter.JSON) {}, `{"Message":"\u003cb\u003ecafé\u003c/b\u003e \\u2028 \u2028 😀"}`},
+		{func(f *formatter.JSON) { f.SetEscapeHTML(false) }, `{"Message":"<b>café</b> \\u2028 \u2028 😀"}`},
+		{func(f *formatter.JSON) { f.SetEscapeLineTerminators(false) }, `{"Message":"\u003cb\u003ecafé\u003c/b\u003e \\u2028 ` + "\u2028" + ` 😀"}`},
+		{func(f *formatter.JSON) { f.SetEscapeNonASCII(true) }, `{"Message":"\u003cb\u003ecaf\u00e9\u003c/b\u003e \\u2028 \u2028 \ud83d\ude00"}`},
+	}
+	for i, test := range tests {
+		var out bytes.Buffer
+		f := formatter.NewJSON([]string{"Message"}, false)
+		test.set(f)
+		logger := NewLogger("app")
+		logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(f)))
+		logger.Info(msg)
+		if out.String() != test.want {
+			t.Errorf("%d: expected %s, got %s", i, test.want, out.String())
+		}
+		var v map[string]string
+		if err := json.Unmarshal(out.Bytes(), &v); err != nil || v["Message"] != msg {
+			t.Errorf("%d: unexpected decoded message %q %v", i, v["Message"], err)
+		}
+	}
+}
+
+// codeError an error marshaling to JSON itself.
+type codeError struct {
+	code int
+}
+
+func (e *codeError) Error() string { return fmt.Sprintf("code %d", e.code) }
+func (e *codeError) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"code":%d}`, e.code)), nil
+}
+
+func TestNormalizerFastPaths(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Context%\n", ""))))
+	logger.AddRecordFields(nil, types.INFO, "request", types.RecordContext{
+		"err":  errors.New("timeout"),
+		"at":   time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+		"ip":   net.ParseIP("10.0.0.1"),
+		"raw":  json.RawMessage(`{"a":1}`),
+		"url":  &url.URL{Scheme: "https", Host: "example.com"},
+		"took": map[string]interface{}{"db": 1500 * time.Millisecond},
+		"code": &codeError{42},
+	})
+	want := `{"at":"2020-01-01T12:00:00Z","code":{"code":42},"err":"timeout","ip":"10.0.0.1","raw":{"a":1},"took":{"db":1500000000},"url":"https://example.com"}` + "\n"
+	if out.String() != want {
+		t.Errorf("unexpected context %s", out.String())
+	}
+}
+
+func TestNormalizerLimits(t *testing.T) {
+	type node struct {
+		Name  string `json:"name"`
+		Child *node  `json:"child,omitempty"`
+	}
+	var out bytes.Buffer
+	nested := formatter.NewLine("%Context%\n", "")
+	nested.SetLimits(formatter.Limits{MaxDepth: 2, MaxElements: 2})
+	sized := formatter.NewLine("%Context%\n", "")
+	sized.SetLimits(formatter.Limits{MaxBytes: 30})
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(nested)))
+	logger.AddRecordFields(nil, types.INFO, "nested", types.RecordContext{
+		"ids":  []interface{}{1, 2, 3},
+		"set":  map[string]interface{}{"a": 1, "b": 2, "c": 3},
+		"tree": &node{Name: "a", Child: &node{Name: "b", Child: &node{Name: "c"}}},
+	})
+	logger = NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(sized)))
+	logger.AddRecordFields(nil, types.INFO, "sized", types.RecordContext{
+		"body": strings.Repeat("x", 40),
+		"list": []string{strings.Repeat("a", 20), strings.Repeat("b", 20)},
+	})
+	want := `{"ids":[1,2,"[truncated]"],"set":{"[truncated]":1,"a":1,"b":2},` +
+		`"tree":{"child":{"child":"[truncated]","name":"b"},"name":"a"}}` + "\n" +
+		`{"body":"` + strings.Repeat("x", 30) + `[truncated]",` +
+		`"list":"[\"aaaaaaaaaaaaaaaaaaaa\",\"bbbbb[truncated]"}` + "\n"
+	if out.String() != want {
+		t.Errorf("unexpected context\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+type panicHandler struct{}
+
+func (panicHandler) IsHandling(record *types.Record) bool { return true }
+func (panicHandler) Handle(record *types.Record) bool {
+	panic("bug")
+}
+func (panicHandler) HandleBatch(records []*types.Record) {}
+func (panicHandler) Close()                              {}
+
+func TestHandlerPanic(t *testing.T) {
+	var internalOut, out bytes.Buffer
+	internal := NewLogger("llog")
+	internal.PushHandler(handler.NewStreamWith(&internalOut, handler.WithFormatter(formatter.NewLine("%LevelName%: %Message%\n", ""))))
+	SetInternalLogger(internal)
+	defer SetInternalLogger(nil)
+
+	logger := NewLogger("app")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Message%\n", ""))))
+	logger.PushHandler(panicHandler{})
+	if _, err := logger.AddRecord(types.INFO, "survived"); err == nil || !strings.Contains(err.Error(), "panicked: bug") {
+		t.Errorf("expected the panic as error, got %v", err)
+	}
+	if out.String() != "survived\n" {
+		t.Errorf("expected the next handler to get the record, got %q", out.String())
+	}
+	if internalOut.String() != "critical: handler panicked\n" {
+		t.Errorf("unexpected internal records %q", internalOut.String())
+	}
+}
+
+func TestNetWriteBudget(t *testing.T) {
+	var fallback bytes.Buffer
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	n := handler.NewNetWith("tcp", "127.0.0.1:1", handler.WithClock(clock), handler.WithFormatter(formatter.NewLine("%Message%\n", "")),
+		handler.WithWriteBudget(time.Second, handler.NewStreamWith(&fallback, handler.WithFormatter(formatter.NewLine("%Message%\n", "")))))
+	record := types.NewRecord()
+	record.Level = types.INFO
+	record.Message = "stale"
+	record.Datetime = clock.Now().Add(-2 * time.Second)
+	n.Handle(record)
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	record = types.NewRecord()
+	record.Level = types.INFO
+	record.Message = "cancelled"
+	record.Datetime = clock.Now()
+	record.Ctx = ctx
+	n.Handle(record)
+	if fallback.String() != "stale\ncancelled\n" || n.Stale() != 2 {
+		t.Errorf("expected the stale records in the fallback, got %q and %d stale", fallback.String(), n.Stale())
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	inner := &batchHandler{}
+	buf := handler.NewBufferWith(inner, handler.WithClock(clock), handler.WithBufferSize(10), handler.WithMaxAge(time.Minute))
+	for _, age := range []time.Duration{time.Hour, time.Second} {
+		record := types.NewRecord()
+		record.Level = types.INFO
+		record.Message = age.String()
+		record.Datetime = clock.Now().Add(-age)
+		buf.Handle(record)
+	}
+	buf.Close()
+	if !reflect.DeepEqual(inner.batches, [][]string{{"1s"}}) || buf.Stats().DroppedStale != 1 {
+		t.Errorf("expected the old record dropped, got %v and %+v", inner.batches, buf.Stats())
+	}
+
+	dir, err := ioutil.TempDir("", "llog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	queue, err := handler.NewDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.PushTime([]byte("old\n"), time.Now().Add(-time.Hour))
+	queue.Push([]byte("new\n"))
+	sender := &flakySender{up: true}
+	spool := handler.NewSpoolQueue(sender, queue, time.Hour, handler.WithMaxAge(time.Minute))
+	for deadline := time.Now().Add(time.Second); len(sender.Sent()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	spool.Close()
+	if spool.Stale() != 1 || strings.Join(sender.Sent(), "") != "new\n" {
+		t.Errorf("expected the old record dropped, got %d stale and %q sent", spool.Stale(), sender.Sent())
+	}
+}
+
+type gateWriter struct {
+	gate chan struct{}
+	out  bytes.Buffer
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	return w.out.Write(p)
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	w := &gateWriter{gate: make(chan struct{})}
+	buf := handler.NewBufferWith(handler.NewStreamWith(w, handler.WithFormatter(formatter.NewLine("%Message%\n", ""))),
+		handler.WithBufferSize(4), handler.WithAdaptiveSampling(handler.Adaptive{HighWater: 0.5}))
+	logger := NewLogger("app")
+	logger.PushHandler(buf)
+	logger.Info("first")
+	// the first record blocks the handler
+	for deadline := time.Now().Add(time.Second); buf.Len() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	logger.Info("a")
+	logger.Info("b")
+	logger.Warning("kept")
+	logger.Info("dropped")
+	logger.Debug("dropped")
+	if buf.Pressure() < 2 || buf.Stats().Sampled != 2 {
+		t.Errorf("expected the pressure raised, got %d and %+v", buf.Pressure(), buf.Stats())
+	}
+	close(w.gate)
+	for deadline := time.Now().Add(time.Second); buf.Len() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for buf.Pressure() > 0 {
+		logger.Info("recovered")
+	}
+	logger.Info("healthy")
+	buf.Close()
+	if out := w.out.String(); !strings.HasPrefix(out, "first\na\nb\nkept\n") ||
+		!strings.HasSuffix(out, "healthy\n") || strings.Contains(out, "dropped") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package llog
+
+import (
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileSharingViolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "llog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clock := types.NewManualClock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local))
+	logger := NewLogger("test")
+	logger.SetClock(clock)
+	r := handler.NewRotatingFileWith(filepath.Join(dir, "app.log"), 1, handler.WithClock(clock))
+	rotated := make(chan string, 1)
+	r.OnRotate(func(path string) { rotated <- path })
+	logger.PushHandler(r)
+	logger.Info("first day")
+	r.Close()
+
+	// another process reading the first file without sharing it
+	old := filepath.Join(dir, "app-2020-01-01.log")
+	name, _ := syscall.UTF16PtrFromString(old)
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ, 0, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, func() { syscall.CloseHandle(h) })
+
+	clock.Add(24 * time.Hour)
+	logger.Info("second day")
+	clock.Add(24 * time.Hour)
+	logger.Info("third day")
+	<-rotated
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(old); os.IsNotExist(err) {
+			r.Close()
+			return
+		}
+	}
+	r.Close()
+	t.Error("the file held open was not removed")
+}
@@ -0,0 +1,78 @@
+package llog
+
+// Merge policies of colliding record fields, see SetMergePolicy.
+const (
+	// MergeOverride the later field replaces the earlier one.
+	MergeOverride = iota
+	// MergeKeepFirst the earlier field is kept, the later one dropped.
+	MergeKeepFirst
+	// MergePrefix both are kept, the later one under the merge prefix followed by its key.
+	MergePrefix
+)
+
+// DefaultMergePrefix the default prefix of the fields renamed by MergePrefix.
+const DefaultMergePrefix = "dup."
+
+// SetMergePolicy Set how colliding fields are merged, from the earliest to the
+// latest: the fields bound by With, the fields of the call, and the extra
+// fields of the processors. An extra field colliding with a context field is
+// the later one: MergeOverride drops the context field, MergeKeepFirst drops
+// the extra field, MergePrefix renames the extra field.
+// Defaults to MergeOverride, child loggers inherit the policy.
+// prefix: The prefix of MergePrefix, DefaultMergePrefix if empty
+func (l *Logger) SetMergePolicy(policy int, prefix string) {
+	if prefix == "" {
+		prefix = DefaultMergePrefix
+	}
+	l.mu.Lock()
+	l.merge = policy
+	l.mergePrefix = prefix
+	l.mu.Unlock()
+}
+
+// GetMergePolicy Get the merge policy and prefix.
+func (l *Logger) GetMergePolicy() (int, string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.mergePrefix == "" {
+		return l.merge, DefaultMergePrefix
+	}
+	return l.merge, l.mergePrefix
+}
+
+// mergeFields merges src into dst by the policy.
+func mergeFields(dst, src map[string]interface{}, policy int, prefix string) {
+	for k, v := range src {
+		if _, ok := dst[k]; ok {
+			switch policy {
+			case MergeKeepFirst:
+				continue
+			case MergePrefix:
+				dst[prefix+k] = v
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// mergeExtra resolves the extra fields colliding with context fields by the policy.
+func mergeExtra(context, extra map[string]interface{}, policy int, prefix string) {
+	if len(context) == 0 {
+		return
+	}
+	for k, v := range extra {
+		if _, ok := context[k]; !ok {
+			continue
+		}
+		switch policy {
+		case MergeKeepFirst:
+			delete(extra, k)
+		case MergePrefix:
+			delete(extra, k)
+			extra[prefix+k] = v
+		default:
+			delete(context, k)
+		}
+	}
+}
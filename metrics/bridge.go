@@ -0,0 +1,279 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule declares a metric derived from the records matching it: a counter of
+// the records, or a histogram of a numeric field if Buckets is set.
+type Rule struct {
+	Name string
+	Help string
+	// Channel pattern in the path.Match syntax, empty matches all channels.
+	Channel string
+	// MinLevel the minimum level of the matching records.
+	MinLevel int
+	// Field the context or extra field records must have, the observed
+	// value of histograms. Durations are observed in seconds.
+	Field string
+	// Labels the fields labeling the series of the metric.
+	Labels []string
+	// Buckets the upper bounds of the histogram.
+	Buckets []float64
+	// Exemplars the fields kept from the last record of each series, such as "trace_id".
+	Exemplars []string
+}
+
+// Bridge handler maintains metrics derived from the records by rules, turning
+// structured logs into metrics without a separate pipeline. The metrics are
+// written by WriteTo, included by the collectors they are added to, and passed
+// to the metrics hook if it implements types.DerivedMetricsHook.
+type Bridge struct {
+	handler.Handler
+
+	mu    sync.Mutex
+	rules []*bridgeRule
+}
+
+type bridgeRule struct {
+	Rule
+	series map[string]*series
+}
+
+// series of a derived metric.
+type series struct {
+	labels   []string
+	value    float64
+	counts   []uint64 // per bucket, not cumulative
+	sum      float64
+	count    uint64
+	exemplar map[string]string
+}
+
+// NewBridge New log-to-metric bridge handler
+func NewBridge() *Bridge {
+	b := &Bridge{}
+	b.SetLevel(types.DEBUG)
+	b.SetBubble(true)
+	return b
+}
+
+// AddRule Adds a derived metric.
+func (b *Bridge) AddRule(rule Rule) error {
+	if rule.Name == "" {
+		return errors.New("rule name is missing")
+	}
+	if rule.Buckets != nil && rule.Field == "" {
+		return errors.New("histogram rule " + rule.Name + " requires a field")
+	}
+	if _, err := path.Match(rule.Channel, ""); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.rules = append(b.rules, &bridgeRule{Rule: rule, series: make(map[string]*series)})
+	b.mu.Unlock()
+	return nil
+}
+
+// Handle Updates the metrics of the rules matching the record.
+func (b *Bridge) Handle(record *types.Record) bool {
+	if !b.IsHandling(record) {
+		return false
+	}
+	b.mu.Lock()
+	for _, r := range b.rules {
+		b.observe(r, record)
+	}
+	b.mu.Unlock()
+	return false == b.GetBubble()
+}
+
+// HandleBatch Handles a set of records.
+func (b *Bridge) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		b.Handle(record)
+	}
+}
+
+// Close nothing to close, the metrics are kept.
+func (b *Bridge) Close() {}
+
+// observe a record matching the rule, the lock being held.
+func (b *Bridge) observe(r *bridgeRule, record *types.Record) {
+	if record.Level < r.MinLevel {
+		return
+	}
+	if r.Channel != "" {
+		if ok, _ := path.Match(r.Channel, record.Channel); !ok {
+			return
+		}
+	}
+	value := 1.0
+	if r.Field != "" {
+		v, ok := record.Get(r.Field)
+		if !ok {
+			return
+		}
+		if r.Buckets != nil {
+			switch d := v.(type) {
+			case time.Duration:
+				value = d.Seconds()
+			case types.Duration:
+				value = time.Duration(d).Seconds()
+			default:
+				if value, ok = record.GetFloat(r.Field); !ok {
+					return
+				}
+			}
+		}
+	}
+
+	labels := make([]string, len(r.Labels))
+	for i, l := range r.Labels {
+		if v, ok := record.Get(l); ok {
+			labels[i] = fmt.Sprint(v)
+		}
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{labels: labels, counts: make([]uint64, len(r.Buckets))}
+		r.series[key] = s
+	}
+	if r.Buckets == nil {
+		s.value += value
+	} else {
+		for i, le := range r.Buckets {
+			if value <= le {
+				s.counts[i]++
+				break
+			}
+		}
+		s.sum += value
+		s.count++
+	}
+	var exemplar map[string]string
+	for _, f := range r.Exemplars {
+		if v, ok := record.Get(f); ok {
+			if exemplar == nil {
+				exemplar = make(map[string]string, len(r.Exemplars))
+			}
+			exemplar[f] = fmt.Sprint(v)
+		}
+	}
+	if exemplar != nil {
+		s.exemplar = exemplar
+	}
+
+	if hook, ok := types.Metrics().(types.DerivedMetricsHook); ok {
+		m := make(map[string]string, len(r.Labels))
+		for i, l := range r.Labels {
+			m[l] = labels[i]
+		}
+		hook.Derived(r.Name, m, value, exemplar)
+	}
+}
+
+// Value Gets the value of a counter series, or the count of a histogram
+// series, by its label values in the order of the rule labels.
+func (b *Bridge) Value(name string, labels ...string) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.rules {
+		if r.Name != name {
+			continue
+		}
+		if s, ok := r.series[strings.Join(labels, "\xff")]; ok {
+			if r.Buckets != nil {
+				return float64(s.count)
+			}
+			return s.value
+		}
+	}
+	return 0
+}
+
+// Exemplar Gets the exemplar of a series by its label values, nil if none.
+func (b *Bridge) Exemplar(name string, labels ...string) map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.rules {
+		if r.Name != name {
+			continue
+		}
+		if s, ok := r.series[strings.Join(labels, "\xff")]; ok {
+			return s.exemplar
+		}
+	}
+	return nil
+}
+
+// WriteTo Writes the metrics in the Prometheus text exposition format.
+func (b *Bridge) WriteTo(w io.Writer) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, r := range b.rules {
+		keys := make([]string, 0, len(r.series))
+		for k := range r.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if r.Buckets == nil {
+			header(&buf, r.Name, "counter", r.Help)
+			for _, k := range keys {
+				s := r.series[k]
+				fmt.Fprintf(&buf, "%s%s %g\n", r.Name, labelSet(r.Labels, s.labels, ""), s.value)
+			}
+			continue
+		}
+		header(&buf, r.Name, "histogram", r.Help)
+		for _, k := range keys {
+			s := r.series[k]
+			var cumulative uint64
+			for i, le := range r.Buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(&buf, "%s_bucket%s %d\n", r.Name, labelSet(r.Labels, s.labels, fmt.Sprintf("%g", le)), cumulative)
+			}
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", r.Name, labelSet(r.Labels, s.labels, "+Inf"), s.count)
+			fmt.Fprintf(&buf, "%s_sum%s %g\n", r.Name, labelSet(r.Labels, s.labels, ""), s.sum)
+			fmt.Fprintf(&buf, "%s_count%s %d\n", r.Name, labelSet(r.Labels, s.labels, ""), s.count)
+		}
+	}
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// labelSet renders the labels of a series, with the le label of histogram buckets if not empty.
+func labelSet(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, values[i])
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=%q", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
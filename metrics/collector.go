@@ -0,0 +1,207 @@
+// Package metrics collects the logging activity and exposes it in the
+// Prometheus text exposition format.
+//
+//	c := metrics.NewCollector()
+//	c.Register()
+//	http.Handle("/metrics", c)
+//
+// Applications using the Prometheus client library can instead implement
+// types.MetricsHook with their own collectors and set it by types.SetMetricsHook.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/syyongx/llog/types"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets the upper bounds in seconds of the handler latency histogram.
+var DefaultBuckets = []float64{0.00001, 0.0001, 0.001, 0.01, 0.1, 1}
+
+// Collector counts the logging activity, it implements types.MetricsHook and http.Handler.
+type Collector struct {
+	mu       sync.Mutex
+	buckets  []float64
+	records  map[[2]string]uint64
+	errors   map[string]uint64
+	dropped  map[string]uint64
+	rotated  map[string]uint64
+	latency  map[string]*histogram
+	lastErrs map[string]string
+	bridges  []*Bridge
+}
+
+// histogram of handler latencies.
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewCollector New collector
+func NewCollector() *Collector {
+	return &Collector{
+		buckets:  DefaultBuckets,
+		records:  make(map[[2]string]uint64),
+		errors:   make(map[string]uint64),
+		dropped:  make(map[string]uint64),
+		rotated:  make(map[string]uint64),
+		latency:  make(map[string]*histogram),
+		lastErrs: make(map[string]string),
+	}
+}
+
+// Register Set the collector as the metrics hook.
+func (c *Collector) Register() {
+	types.SetMetricsHook(c)
+}
+
+// RecordLogged A record was dispatched by a logger.
+func (c *Collector) RecordLogged(channel, level string) {
+	c.mu.Lock()
+	c.records[[2]string{channel, level}]++
+	c.mu.Unlock()
+}
+
+// HandlerError A handler failed to format or write a record.
+func (c *Collector) HandlerError(handler string, err error) {
+	c.mu.Lock()
+	c.errors[handler]++
+	c.lastErrs[handler] = err.Error()
+	c.mu.Unlock()
+}
+
+// RecordDropped A handler dropped a record.
+func (c *Collector) RecordDropped(handler string) {
+	c.mu.Lock()
+	c.dropped[handler]++
+	c.mu.Unlock()
+}
+
+// Rotated A handler rotated its file.
+func (c *Collector) Rotated(handler string) {
+	c.mu.Lock()
+	c.rotated[handler]++
+	c.mu.Unlock()
+}
+
+// HandlerLatency A handler took d to handle a record.
+func (c *Collector) HandlerLatency(handler string, d time.Duration) {
+	s := d.Seconds()
+	c.mu.Lock()
+	h, ok := c.latency[handler]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.latency[handler] = h
+	}
+	for i, le := range c.buckets {
+		if s <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += s
+	h.count++
+	c.mu.Unlock()
+}
+
+// AddBridge Includes the metrics derived by a bridge in the output.
+func (c *Collector) AddBridge(b *Bridge) {
+	c.mu.Lock()
+	c.bridges = append(c.bridges, b)
+	c.mu.Unlock()
+}
+
+// Errors Get the number of records a handler failed to format or write.
+func (c *Collector) Errors(handler string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.errors[handler]
+}
+
+// LastError Get the last error of a handler.
+func (c *Collector) LastError(handler string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastErrs[handler]
+}
+
+// ServeHTTP Writes the metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WriteTo(w)
+}
+
+// WriteTo Writes the metrics in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b bytes.Buffer
+	header(&b, "llog_records_total", "counter", "Records logged by channel and level.")
+	keys := make([][2]string, 0, len(c.records))
+	for k := range c.records {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(&b, "llog_records_total{channel=%q,level=%q} %d\n", k[0], k[1], c.records[k])
+	}
+	counter(&b, "llog_handler_errors_total", "Records a handler failed to format or write.", c.errors)
+	counter(&b, "llog_dropped_records_total", "Records dropped by a handler.", c.dropped)
+	counter(&b, "llog_rotations_total", "File rotations of a handler.", c.rotated)
+
+	header(&b, "llog_handler_duration_seconds", "histogram", "Time taken by a handler to handle a record.")
+	for _, name := range sortedKeys(c.latency) {
+		h := c.latency[name]
+		var cumulative uint64
+		for i, le := range c.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "llog_handler_duration_seconds_bucket{handler=%q,le=\"%g\"} %d\n", name, le, cumulative)
+		}
+		fmt.Fprintf(&b, "llog_handler_duration_seconds_bucket{handler=%q,le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(&b, "llog_handler_duration_seconds_sum{handler=%q} %g\n", name, h.sum)
+		fmt.Fprintf(&b, "llog_handler_duration_seconds_count{handler=%q} %d\n", name, h.count)
+	}
+	for _, bridge := range c.bridges {
+		bridge.WriteTo(&b)
+	}
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// header writes the HELP and TYPE lines of a metric.
+func header(b *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// counter writes a counter labeled by handler.
+func counter(b *bytes.Buffer, name, help string, values map[string]uint64) {
+	header(b, name, "counter", help)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s{handler=%q} %d\n", name, k, values[k])
+	}
+}
+
+// sortedKeys of the latency histograms.
+func sortedKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
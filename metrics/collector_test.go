@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/syyongx/llog/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	c.RecordLogged("app", "warning")
+	c.RecordLogged("app", "warning")
+	c.HandlerError("*handler.File", errors.New("disk full"))
+	c.HandlerLatency("*handler.File", 5*time.Millisecond)
+
+	var b strings.Builder
+	c.WriteTo(&b)
+	out := b.String()
+	for _, want := range []string{
+		`llog_records_total{channel="app",level="warning"} 2`,
+		`llog_handler_errors_total{handler="*handler.File"} 1`,
+		`llog_handler_duration_seconds_bucket{handler="*handler.File",le="0.001"} 0`,
+		`llog_handler_duration_seconds_bucket{handler="*handler.File",le="0.01"} 1`,
+		`llog_handler_duration_seconds_count{handler="*handler.File"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	b := NewBridge()
+	b.AddRule(Rule{Name: "payment_errors_total", Channel: "payments*", MinLevel: types.ERROR,
+		Labels: []string{"provider"}, Exemplars: []string{"trace_id"}})
+	b.AddRule(Rule{Name: "request_seconds", Field: "duration", Buckets: []float64{0.1, 1}})
+	if err := b.AddRule(Rule{Name: "invalid", Buckets: []float64{1}}); err == nil {
+		t.Error("expected an error for a histogram without field")
+	}
+	records := []*types.Record{
+		{Level: types.ERROR, Channel: "payments", Context: types.RecordContext{"provider": "visa", "trace_id": "a"}},
+		{Level: types.ERROR, Channel: "payments.refunds", Context: types.RecordContext{"provider": "visa", "trace_id": "b"}},
+		{Level: types.INFO, Channel: "payments", Context: types.RecordContext{"provider": "visa"}},
+		{Level: types.ERROR, Channel: "http", Context: types.RecordContext{"duration": 500 * time.Millisecond}},
+	}
+	for _, record := range records {
+		b.Handle(record)
+	}
+	if v := b.Value("payment_errors_total", "visa"); v != 2 {
+		t.Errorf("expected 2 payment errors, got %g", v)
+	}
+	if e := b.Exemplar("payment_errors_total", "visa"); e["trace_id"] != "b" {
+		t.Errorf("unexpected exemplar %v", e)
+	}
+
+	c := NewCollector()
+	c.AddBridge(b)
+	var out strings.Builder
+	c.WriteTo(&out)
+	for _, want := range []string{
+		`payment_errors_total{provider="visa"} 2`,
+		`request_seconds_bucket{le="0.1"} 0`,
+		`request_seconds_bucket{le="1"} 1`,
+		`request_seconds_sum 0.5`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %s in\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"os"
+)
+
+// MirrorStderr Writes the records at or above level to stderr as well,
+// whatever the handlers do with them, so that fatal conditions are seen
+// even when the handlers are broken. Child loggers inherit the mirror.
+// level: 0 disables the mirror
+func (l *Logger) MirrorStderr(level int) {
+	if level <= 0 {
+		l.SetMirror(nil)
+		return
+	}
+	l.SetMirror(handler.NewStream(os.Stderr, level, true))
+}
+
+// SetMirror Set the handler receiving the records it handles besides the
+// handler stack, nil removes it.
+func (l *Logger) SetMirror(h types.IHandler) {
+	l.mu.Lock()
+	l.mirror = h
+	l.mu.Unlock()
+}
+
+// GetMirror Get the mirror handler, nil if none.
+func (l *Logger) GetMirror() types.IHandler {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.mirror
+}
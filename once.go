@@ -0,0 +1,83 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/types"
+	"sync"
+)
+
+// occurrences counts the records logged by LogEvery by level and key. Child
+// loggers share the counters of their parent, so the keys hold across
+// request-scoped loggers.
+type occurrences struct {
+	mu     sync.Mutex
+	counts map[occurrenceKey]uint64
+}
+
+type occurrenceKey struct {
+	level int
+	key   string
+}
+
+// next counts an occurrence of the key at level, returning the count.
+func (o *occurrences) next(level int, key string) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.counts == nil {
+		o.counts = make(map[occurrenceKey]uint64)
+	}
+	k := occurrenceKey{level, key}
+	o.counts[k]++
+	return o.counts[k]
+}
+
+// LogEvery Logs the first occurrence of the key at level, then one in n, with
+// the number of occurrences so far under the "occurrences" field, to tame
+// repeated messages in tight loops. n of 0 logs the first occurrence only.
+// The occurrences below the level of the logger are not counted.
+// Keys are never forgotten, so they should be constants such as call sites.
+func (l *Logger) LogEvery(level int, key string, n int, message interface{}) {
+	if level < l.GetLevel() {
+		return
+	}
+	count := l.getOccurrences().next(level, key)
+	if count != 1 && (n <= 0 || (count-1)%uint64(n) != 0) {
+		return
+	}
+	var fields types.RecordContext
+	if count > 1 {
+		fields = types.RecordContext{"occurrences": count}
+	}
+	l.AddRecordFields(nil, level, l.String(message), fields)
+}
+
+// getOccurrences Gets the counters of LogEvery, created on first use by the
+// loggers not created by NewLogger.
+func (l *Logger) getOccurrences() *occurrences {
+	l.mu.RLock()
+	o := l.occurrences
+	l.mu.RUnlock()
+	if o != nil {
+		return o
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.occurrences == nil {
+		l.occurrences = &occurrences{}
+	}
+	return l.occurrences
+}
+
+// InfoOnce Logs at the INFO level the first occurrence of the key only.
+func (l *Logger) InfoOnce(key string, message interface{}) {
+	l.LogEvery(types.INFO, key, 0, message)
+}
+
+// WarningOnce Logs at the WARNING level the first occurrence of the key only.
+func (l *Logger) WarningOnce(key string, message interface{}) {
+	l.LogEvery(types.WARNING, key, 0, message)
+}
+
+// ErrorEvery Logs at the ERROR level the first occurrence of the key, then one in n.
+func (l *Logger) ErrorEvery(key string, n int, message interface{}) {
+	l.LogEvery(types.ERROR, key, n, message)
+}
@@ -0,0 +1,422 @@
+package otel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Exporter handler sends records as OpenTelemetry log records to an OTLP/HTTP
+// endpoint using the JSON encoding, such as http://localhost:4318/v1/logs.
+//
+// Records are sent one request each unless batching is enabled by SetBatch.
+// Requests are sent by a background goroutine, so the logging goroutines
+// don't wait for the endpoint, only for a free slot of the send queue when
+// it is full. Failed requests are retried by the Retry policy when the error
+// is temporary: network errors and the 429, 502, 503 and 504 status codes.
+// OTLP/gRPC is not supported as it requires the protobuf and gRPC modules.
+type Exporter struct {
+	handler.Handler
+	handler.Processable
+	sync.Mutex
+
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+	Retry    handler.Retry
+
+	resource  []KeyValue
+	batching  handler.Batching
+	gzipLevel int // 0 means no compression
+	pending   []pending
+	size      int // message bytes of the pending records
+	stats     types.HandlerStats
+
+	// the sender, the lock is held while queueing so batches keep their order
+	queueMu sync.Mutex
+	queue   chan outgoing
+	linger  chan time.Duration
+	stopped chan struct{}
+	closed  bool
+}
+
+// pending a converted record waiting for its batch.
+type pending struct {
+	channel string
+	record  LogRecord
+}
+
+// outgoing a batch waiting for the sender, sent receiving the result if set.
+type outgoing struct {
+	batch []pending
+	sent  chan error
+}
+
+// exportQueueSize the number of batches waiting for the sender.
+const exportQueueSize = 16
+
+// NewExporter New OTLP exporter handler
+// The service.name resource attribute defaults to the program name.
+func NewExporter(endpoint string, level int, bubble bool) *Exporter {
+	e := &Exporter{
+		Endpoint: endpoint,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Retry: handler.Retry{
+			MaxAttempts: 4,
+			Base:        500 * time.Millisecond,
+			Max:         30 * time.Second,
+			Jitter:      0.2,
+		},
+	}
+	e.SetLevel(level)
+	e.SetBubble(bubble)
+	e.SetResource(map[string]interface{}{
+		"service.name": filepath.Base(os.Args[0]),
+	})
+	return e
+}
+
+// SetResource Set the resource attributes describing the entity producing the logs.
+func (e *Exporter) SetResource(attrs map[string]interface{}) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resource := make([]KeyValue, 0, len(keys))
+	for _, k := range keys {
+		resource = append(resource, KeyValue{Key: k, Value: Value(attrs[k])})
+	}
+	e.Lock()
+	e.resource = resource
+	e.Unlock()
+}
+
+// SetCompression Compresses the request bodies with the algorithm at the level,
+// such as gzip.BestSpeed, 0 for the default level.
+// OTLP/HTTP only defines "gzip", "" disables the compression.
+func (e *Exporter) SetCompression(algorithm string, level int) error {
+	switch algorithm {
+	case "":
+		level = 0
+	case "gzip":
+		if level == gzip.NoCompression {
+			level = gzip.DefaultCompression
+		}
+		if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unsupported compression " + algorithm)
+	}
+	e.Lock()
+	e.gzipLevel = level
+	e.Unlock()
+	return nil
+}
+
+// SetBatch Sends records in batches of size, pending records are also sent
+// every interval. A size of 1 or less sends every record on its own.
+func (e *Exporter) SetBatch(size int, interval time.Duration) {
+	if size <= 1 {
+		size = 1
+	}
+	e.SetBatching(handler.Batching{MaxRecords: size, MaxLinger: interval})
+}
+
+// SetBatching Sends records in batches, pending records are sent every MaxLinger.
+func (e *Exporter) SetBatching(batching handler.Batching) {
+	e.Lock()
+	e.batching = batching
+	e.Unlock()
+	e.queueMu.Lock()
+	defer e.queueMu.Unlock()
+	if batching.Enabled() && batching.MaxLinger > 0 && e.start() {
+		// the sender takes the interval of its flush ticker
+		select {
+		case <-e.linger:
+		default:
+		}
+		e.linger <- batching.MaxLinger
+	}
+}
+
+// Handle a record.
+func (e *Exporter) Handle(record *types.Record) bool {
+	if !e.IsHandling(record) {
+		return false
+	}
+	e.ProcessRecord(record)
+	e.add(record)
+
+	return false == e.GetBubble()
+}
+
+// HandleBatch Handles a set of records.
+func (e *Exporter) HandleBatch(records []*types.Record) {
+	for _, record := range records {
+		if e.IsHandling(record) {
+			e.ProcessRecord(record)
+			e.add(record)
+		}
+	}
+}
+
+// Flush Sends the pending records, waiting for the batches queued before.
+func (e *Exporter) Flush() error {
+	sent := make(chan error, 1)
+	e.enqueue(sent)
+	return <-sent
+}
+
+// Close Sends the pending records and stops the sender.
+func (e *Exporter) Close() {
+	e.Flush()
+	e.queueMu.Lock()
+	e.closed = true
+	queue, stopped := e.queue, e.stopped
+	e.queue = nil
+	e.queueMu.Unlock()
+	if queue != nil {
+		close(queue)
+		<-stopped
+	}
+}
+
+// Export Sends records to the endpoint, bypassing the batch.
+func (e *Exporter) Export(records []*types.Record) error {
+	e.Lock()
+	resource := e.resource
+	e.Unlock()
+	return e.send(NewLogsData(resource, records))
+}
+
+// HandlerStats Gets the counters of the records sent, and of the pending ones.
+func (e *Exporter) HandlerStats() types.HandlerStats {
+	e.Lock()
+	defer e.Unlock()
+	stats := e.stats
+	stats.QueueDepth = len(e.pending)
+	return stats
+}
+
+// add a record to the batch. The record is converted right away as records
+// are reused once handled.
+func (e *Exporter) add(record *types.Record) {
+	p := pending{channel: record.Channel, record: NewLogRecord(record)}
+	e.Lock()
+	e.pending = append(e.pending, p)
+	e.size += len(record.Message)
+	full := !e.batching.Enabled() || e.batching.Full(len(e.pending), e.size)
+	e.Unlock()
+	if full {
+		e.enqueue(nil)
+	}
+}
+
+// enqueue Passes the pending records to the sender, reporting the result to
+// sent if set. Once closed, they are sent right away.
+func (e *Exporter) enqueue(sent chan error) {
+	e.queueMu.Lock()
+	defer e.queueMu.Unlock()
+	e.Lock()
+	batch := e.pending
+	e.pending = nil
+	e.size = 0
+	resource := e.resource
+	e.Unlock()
+	if !e.start() {
+		var err error
+		if len(batch) > 0 {
+			err = e.send(newLogsData(resource, batch))
+		}
+		if sent != nil {
+			sent <- err
+		}
+		return
+	}
+	if len(batch) > 0 || sent != nil {
+		e.queue <- outgoing{batch: batch, sent: sent}
+	}
+}
+
+// start Starts the sender unless closed, reporting whether it runs.
+// Called under the queue lock.
+func (e *Exporter) start() bool {
+	if e.closed {
+		return false
+	}
+	if e.queue == nil {
+		e.queue = make(chan outgoing, exportQueueSize)
+		e.linger = make(chan time.Duration, 1)
+		e.stopped = make(chan struct{})
+		go e.run(e.queue, e.linger, e.stopped)
+	}
+	return true
+}
+
+// run Sends the queued batches, and the pending records every MaxLinger.
+func (e *Exporter) run(queue chan outgoing, linger chan time.Duration, stopped chan struct{}) {
+	defer close(stopped)
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	for {
+		select {
+		case o, ok := <-queue:
+			if !ok {
+				return
+			}
+			var err error
+			if len(o.batch) > 0 {
+				e.Lock()
+				resource := e.resource
+				e.Unlock()
+				err = e.send(newLogsData(resource, o.batch))
+			}
+			if o.sent != nil {
+				o.sent <- err
+			}
+		case d := <-linger:
+			if ticker != nil {
+				ticker.Stop()
+			}
+			ticker = time.NewTicker(d)
+			tick = ticker.C
+		case <-tick:
+			e.Lock()
+			batch := e.pending
+			e.pending = nil
+			e.size = 0
+			resource := e.resource
+			e.Unlock()
+			if len(batch) > 0 {
+				e.send(newLogsData(resource, batch))
+			}
+		}
+	}
+}
+
+// send a payload, retrying temporary failures.
+func (e *Exporter) send(data *LogsData) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	e.Lock()
+	level := e.gzipLevel
+	e.Unlock()
+	if level != 0 {
+		if body, err = compress(body, level); err != nil {
+			return err
+		}
+	}
+	err = e.Retry.Do(e.GetClock(), func() error {
+		return e.post(body, level != 0)
+	})
+	e.count(data, len(body), err)
+	return err
+}
+
+// count the records of a payload of n bytes as sent or failed.
+func (e *Exporter) count(data *LogsData, n int, err error) {
+	records := 0
+	for _, rl := range data.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			records += len(sl.LogRecords)
+		}
+	}
+	e.Lock()
+	if err != nil {
+		e.stats.Errors += uint64(records)
+		e.stats.LastErrorTime = time.Now()
+	} else {
+		e.stats.Handled += uint64(records)
+		e.stats.Bytes += uint64(n)
+	}
+	e.Unlock()
+}
+
+// post the body once, marking the failures worth retrying.
+func (e *Exporter) post(body []byte, gzipped bool) error {
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		return handler.Retryable(errors.New("otlp export failed: " + resp.Status))
+	}
+	return errors.New("otlp export failed: " + resp.Status)
+}
+
+// compress gzips the body.
+func compress(body []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewLogsData Groups records by channel into an export payload.
+func NewLogsData(resource []KeyValue, records []*types.Record) *LogsData {
+	batch := make([]pending, 0, len(records))
+	for _, record := range records {
+		batch = append(batch, pending{channel: record.Channel, record: NewLogRecord(record)})
+	}
+	return newLogsData(resource, batch)
+}
+
+// newLogsData groups converted records by channel into an export payload.
+func newLogsData(resource []KeyValue, batch []pending) *LogsData {
+	rl := ResourceLogs{Resource: Resource{Attributes: resource}}
+	scopes := make(map[string]int)
+	for _, p := range batch {
+		i, ok := scopes[p.channel]
+		if !ok {
+			i = len(rl.ScopeLogs)
+			scopes[p.channel] = i
+			rl.ScopeLogs = append(rl.ScopeLogs, ScopeLogs{Scope: Scope{Name: p.channel}})
+		}
+		rl.ScopeLogs[i].LogRecords = append(rl.ScopeLogs[i].LogRecords, p.record)
+	}
+	return &LogsData{ResourceLogs: []ResourceLogs{rl}}
+}
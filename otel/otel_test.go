@@ -0,0 +1,200 @@
+package otel
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Traceparent() != tp {
+		t.Errorf("expected %s, got %s", tp, sc.Traceparent())
+	}
+	if _, err := ParseTraceparent("00-00000000000000000000000000000000-00f067aa0ba902b7-01"); err == nil {
+		t.Error("expected error for zero trace id")
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	record := types.NewRecord()
+	record.Ctx = ContextWithSpan(context.Background(), sc)
+	Processor(record)
+	if record.Extra["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || record.Extra["span_id"] != "00f067aa0ba902b7" {
+		t.Errorf("unexpected extra %v", record.Extra)
+	}
+	lr := NewLogRecord(record)
+	if lr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || len(lr.Attributes) != 0 {
+		t.Errorf("unexpected log record %+v", lr)
+	}
+}
+
+type credentials struct {
+	User     string
+	Password string
+}
+
+func TestValueSerializer(t *testing.T) {
+	formatter.RegisterType(credentials{}, func(v interface{}) interface{} {
+		return map[string]interface{}{"user": v.(credentials).User, "password": "[REDACTED]"}
+	})
+	defer formatter.RegisterType(credentials{}, nil)
+	record := types.NewRecord()
+	record.Context = types.RecordContext{"login": map[string]interface{}{"creds": &credentials{"bob", "secret"}}}
+	lr := NewLogRecord(record)
+	if len(lr.Attributes) != 1 || lr.Attributes[0].Value.StringValue == nil {
+		t.Fatalf("unexpected attributes %+v", lr.Attributes)
+	}
+	if s := *lr.Attributes[0].Value.StringValue; strings.Contains(s, "secret") || !strings.Contains(s, "[REDACTED]") {
+		t.Errorf("expected the password to be redacted, got %s", s)
+	}
+}
+
+// codeError an error marshaling to JSON itself.
+type codeError struct{}
+
+func (codeError) Error() string                { return "code 42" }
+func (codeError) MarshalJSON() ([]byte, error) { return []byte(`{"code":42}`), nil }
+
+func TestValueMarshaler(t *testing.T) {
+	if s := Value(codeError{}).StringValue; s == nil || *s != `{"code":42}` {
+		t.Errorf("expected the JSON of the error, got %v", s)
+	}
+	if s := Value(errors.New("boom")).StringValue; s == nil || *s != "boom" {
+		t.Errorf("expected the error message, got %v", s)
+	}
+}
+
+func TestTemplateAttribute(t *testing.T) {
+	record := types.NewRecord()
+	record.Message = "user bob logged in"
+	record.Template = "user %s logged in"
+	lr := NewLogRecord(record)
+	if len(lr.Attributes) != 1 || lr.Attributes[0].Key != TemplateKey || *lr.Attributes[0].Value.StringValue != record.Template {
+		t.Errorf("unexpected attributes %+v", lr.Attributes)
+	}
+}
+
+func TestEventAttributes(t *testing.T) {
+	record := types.NewRecord()
+	record.Context = types.RecordContext{types.EventKey: &types.Event{Name: "order.deleted", Actor: "bob", Payload: map[string]interface{}{"order": 42}}}
+	got := map[string]string{}
+	for _, kv := range NewLogRecord(record).Attributes {
+		if kv.Value.StringValue != nil {
+			got[kv.Key] = *kv.Value.StringValue
+		} else if kv.Value.IntValue != nil {
+			got[kv.Key] = *kv.Value.IntValue
+		}
+	}
+	if len(got) != 3 || got["event.name"] != "order.deleted" || got["event.actor"] != "bob" || got["order"] != "42" {
+		t.Errorf("unexpected attributes %v", got)
+	}
+}
+
+func TestExporterBatchRetry(t *testing.T) {
+	var requests, failures int32
+	var got LogsData
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			atomic.AddInt32(&failures, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	e := NewExporter(srv.URL, types.DEBUG, true)
+	e.Retry.Base = time.Millisecond
+	e.SetBatch(2, 0)
+	for i := 0; i < 2; i++ {
+		record := types.NewRecord()
+		record.Channel = "app"
+		record.Level = types.WARNING
+		record.Message = "xxx"
+		e.Handle(record)
+	}
+	e.Close()
+	if requests != 2 || failures != 1 {
+		t.Errorf("expected one retried request, got %d requests", requests)
+	}
+	if len(got.ResourceLogs) != 1 || len(got.ResourceLogs[0].ScopeLogs[0].LogRecords) != 2 {
+		t.Errorf("unexpected payload %+v", got)
+	}
+}
+
+func TestExporterBackground(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+	}))
+	defer srv.Close()
+
+	e := NewExporter(srv.URL, types.DEBUG, true)
+	handled := make(chan bool)
+	go func() {
+		record := types.NewRecord()
+		record.Channel = "app"
+		record.Level = types.INFO
+		record.Message = "xxx"
+		handled <- e.Handle(record)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Handle not to wait for the endpoint")
+	}
+	close(release)
+	e.Close()
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected the record to be sent before Close returned, got %d requests", requests)
+	}
+}
+
+func TestExporterCompression(t *testing.T) {
+	var got LogsData
+	var encoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(zr).Decode(&got)
+	}))
+	defer srv.Close()
+
+	e := NewExporter(srv.URL, types.DEBUG, true)
+	if err := e.SetCompression("zstd", 0); err == nil {
+		t.Error("expected an unsupported compression error")
+	}
+	if err := e.SetCompression("gzip", gzip.BestSpeed); err != nil {
+		t.Fatal(err)
+	}
+	record := types.NewRecord()
+	record.Channel = "app"
+	record.Message = "xxx"
+	if err := e.Export([]*types.Record{record}); err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "gzip" || len(got.ResourceLogs) != 1 {
+		t.Errorf("unexpected request %q %+v", encoding, got)
+	}
+}
@@ -0,0 +1,188 @@
+package otel
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/types"
+	"strconv"
+)
+
+// The OTLP logs data model in its JSON encoding.
+// See https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+// LogsData the payload of an OTLP logs export request.
+type LogsData struct {
+	ResourceLogs []ResourceLogs `json:"resourceLogs"`
+}
+
+// ResourceLogs the logs of a resource.
+type ResourceLogs struct {
+	Resource  Resource    `json:"resource"`
+	ScopeLogs []ScopeLogs `json:"scopeLogs"`
+}
+
+// Resource the entity producing the logs, such as a service.
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// ScopeLogs the logs of an instrumentation scope, the channel of the records.
+type ScopeLogs struct {
+	Scope      Scope       `json:"scope"`
+	LogRecords []LogRecord `json:"logRecords"`
+}
+
+// Scope an instrumentation scope.
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// LogRecord an OpenTelemetry log record.
+type LogRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 AnyValue   `json:"body"`
+	Attributes           []KeyValue `json:"attributes,omitempty"`
+	TraceID              string     `json:"traceId,omitempty"`
+	SpanID               string     `json:"spanId,omitempty"`
+	Flags                int        `json:"flags,omitempty"`
+}
+
+// KeyValue an attribute.
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue an attribute or body value.
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// severities maps the llog levels to the OpenTelemetry severity numbers.
+var severities = map[int]int{
+	types.DEBUG:     5,
+	types.INFO:      9,
+	types.NOTICE:    10,
+	types.WARNING:   13,
+	types.ERROR:     17,
+	types.CRITICAL:  18,
+	types.ALERT:     21,
+	types.EMERGENCY: 22,
+}
+
+// Severity Gets the OpenTelemetry severity number of a level.
+func Severity(level int) int {
+	if s, ok := severities[level]; ok {
+		return s
+	}
+	return 0
+}
+
+// TemplateKey the attribute of the message template of the records logged
+// with a format, to group them by template.
+const TemplateKey = "message.template"
+
+// NewLogRecord Converts a record to an OpenTelemetry log record.
+// Context and extra become attributes, as well as the message template if
+// any, the trace and span ids are taken from the record's context or else
+// from the extra set by Processor. The event of the records logged by
+// Logger.Event becomes the event.name, event.actor and event.subject
+// attributes, its payload attributes as the context.
+func NewLogRecord(record *types.Record) LogRecord {
+	lr := LogRecord{
+		TimeUnixNano:   strconv.FormatInt(record.Datetime.UnixNano(), 10),
+		SeverityNumber: Severity(record.Level),
+		SeverityText:   record.LevelName,
+		Body:           Value(record.Message),
+	}
+	lr.ObservedTimeUnixNano = lr.TimeUnixNano
+	if record.Template != "" {
+		lr.Attributes = append(lr.Attributes, KeyValue{Key: TemplateKey, Value: Value(record.Template)})
+	}
+	for k, v := range record.Context {
+		if e, ok := v.(*types.Event); ok && k == types.EventKey {
+			lr.Attributes = appendEvent(lr.Attributes, e)
+			continue
+		}
+		lr.Attributes = append(lr.Attributes, KeyValue{Key: k, Value: Value(v)})
+	}
+	for k, v := range record.Extra {
+		switch k {
+		case "trace_id", "span_id", "traceparent":
+			continue
+		}
+		lr.Attributes = append(lr.Attributes, KeyValue{Key: k, Value: Value(v)})
+	}
+	var sc SpanContext
+	ok := false
+	if record.Ctx != nil {
+		sc, ok = Extractor(record.Ctx)
+	}
+	if tp, is := record.Extra["traceparent"].(string); !ok && is {
+		var err error
+		sc, err = ParseTraceparent(tp)
+		ok = err == nil
+	}
+	if ok {
+		lr.TraceID = sc.TraceIDString()
+		lr.SpanID = sc.SpanIDString()
+		lr.Flags = int(sc.Flags)
+	}
+	return lr
+}
+
+// appendEvent appends the attributes of an event.
+func appendEvent(attrs []KeyValue, e *types.Event) []KeyValue {
+	attrs = append(attrs, KeyValue{Key: "event.name", Value: Value(e.Name)})
+	if e.Actor != "" {
+		attrs = append(attrs, KeyValue{Key: "event.actor", Value: Value(e.Actor)})
+	}
+	if e.Subject != "" {
+		attrs = append(attrs, KeyValue{Key: "event.subject", Value: Value(e.Subject)})
+	}
+	for k, v := range e.Payload {
+		attrs = append(attrs, KeyValue{Key: k, Value: Value(v)})
+	}
+	return attrs
+}
+
+// Value Converts a value to an OpenTelemetry attribute value, rendered with
+// its log representation first, see formatter.Normalize.
+func Value(v interface{}) AnyValue {
+	v = formatter.Normalize(v)
+	switch val := v.(type) {
+	case string:
+		return AnyValue{StringValue: &val}
+	case bool:
+		return AnyValue{BoolValue: &val}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprintf("%d", val)
+		return AnyValue{IntValue: &s}
+	case float32:
+		f := float64(val)
+		return AnyValue{DoubleValue: &f}
+	case float64:
+		return AnyValue{DoubleValue: &val}
+	case json.Marshaler:
+		// encoded below, as the normalizer keeps the values marshaling themselves
+	case error:
+		s := val.Error()
+		return AnyValue{StringValue: &s}
+	case fmt.Stringer:
+		s := val.String()
+		return AnyValue{StringValue: &s}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b = []byte(err.Error())
+	}
+	s := string(b)
+	return AnyValue{StringValue: &s}
+}
@@ -0,0 +1,23 @@
+package otel
+
+import (
+	"github.com/syyongx/llog/types"
+)
+
+// Processor Injects the trace_id, span_id and traceparent of the active span
+// of the record's context into the record extra.
+var Processor types.Processor = func(record *types.Record, a ...interface{}) {
+	if record.Ctx == nil {
+		return
+	}
+	sc, ok := Extractor(record.Ctx)
+	if !ok {
+		return
+	}
+	if record.Extra == nil {
+		record.Extra = make(types.RecordExtra)
+	}
+	record.Extra["trace_id"] = sc.TraceIDString()
+	record.Extra["span_id"] = sc.SpanIDString()
+	record.Extra["traceparent"] = sc.Traceparent()
+}
@@ -0,0 +1,101 @@
+// Package otel correlates records with OpenTelemetry traces and exports
+// records as OpenTelemetry log records over OTLP.
+//
+// The package has no dependency on the OpenTelemetry SDK. Spans are read
+// from the record's context by the Extractor, which can be replaced to read
+// the spans of the SDK:
+//
+//	otel.Extractor = func(ctx context.Context) (otel.SpanContext, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		return otel.SpanContext{TraceID: sc.TraceID(), SpanID: sc.SpanID(), Flags: byte(sc.TraceFlags())}, sc.IsValid()
+//	}
+package otel
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// SpanContext identifies a span of a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// IsValid Checks whether both the trace and the span id are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString Get the hex encoded trace id.
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString Get the hex encoded span id.
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent Get the W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceIDString() + "-" + sc.SpanIDString() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent Parses a W3C traceparent header value.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errors.New("invalid traceparent")
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errors.New("invalid traceparent")
+	}
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, err
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, err
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, err
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errors.New("invalid traceparent")
+	}
+	return sc, nil
+}
+
+// decodeHex decodes s into dst, s must encode exactly len(dst) bytes.
+func decodeHex(dst []byte, s string) error {
+	if hex.EncodedLen(len(dst)) != len(s) || strings.ToLower(s) != s {
+		return errors.New("invalid traceparent")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+type spanKey struct{}
+
+// ContextWithSpan Returns a copy of ctx carrying the span context.
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// SpanFromContext Gets the span context stored by ContextWithSpan.
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Extractor Gets the active span of a context, defaults to SpanFromContext.
+var Extractor = SpanFromContext
@@ -0,0 +1,38 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"github.com/syyongx/llog/processor"
+	"github.com/syyongx/llog/types"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DevelopmentFormat the line format of NewDevelopment.
+var DevelopmentFormat = "%Datetime% %LevelName% %Message% %Context% %Extra%\n"
+
+// NewDevelopment Creates a logger named after the program for development:
+// records of all levels with their caller, colored, and multi-line messages
+// indented, written to stdout, WARNING and above to stderr.
+func NewDevelopment() *Logger {
+	f := formatter.NewLine(DevelopmentFormat, "15:04:05.000")
+	f.SetColors(true)
+	f.SetMultiline(formatter.MultilineIndent)
+	h := handler.NewConsoleWith(handler.WithLevel(types.DEBUG), handler.WithFormatter(f))
+	logger := NewLogger(filepath.Base(os.Args[0]))
+	logger.PushProcessor(processor.Caller)
+	logger.PushHandler(h)
+	return logger
+}
+
+// NewProduction Creates a logger named after the program for production:
+// INFO and above as JSON lines to stdout, sampled to the first 100 records of
+// each message per second then every 100th.
+func NewProduction() *Logger {
+	h := handler.NewStreamWith(os.Stdout, handler.WithLevel(types.INFO), handler.WithFormatter(formatter.NewJSON(nil, true)))
+	logger := NewLogger(filepath.Base(os.Args[0]))
+	logger.PushHandler(handler.NewSampler(h, time.Second, 100, 100))
+	return logger
+}
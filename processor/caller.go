@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"github.com/syyongx/llog/types"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Caller Adds the file and line of the logging call to Extra, under "caller",
+// the first frame outside of the llog packages.
+var Caller types.Processor = func(record *types.Record, a ...interface{}) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isLlogFrame(frame) {
+			record.Extra["caller"] = filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// isLlogFrame reports whether a frame belongs to the llog packages, their tests excluded.
+func isLlogFrame(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	return strings.Contains(frame.Function, "github.com/syyongx/llog.") ||
+		strings.Contains(frame.Function, "github.com/syyongx/llog/")
+}
@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"github.com/syyongx/llog/types"
+	"path"
+)
+
+// Fields Creates a processor keeping only the context and extra fields whose
+// key matches a pattern of allow, if any, and none of deny. Patterns are
+// globs such as "http.*". Pushed on a handler it only filters the fields
+// that handler emits, pushed on a logger it filters them for all handlers.
+func Fields(allow, deny []string) types.Processor {
+	return func(record *types.Record, a ...interface{}) {
+		for k := range record.Context {
+			if !keep(k, allow, deny) {
+				delete(record.Context, k)
+			}
+		}
+		for k := range record.Extra {
+			if !keep(k, allow, deny) {
+				delete(record.Extra, k)
+			}
+		}
+	}
+}
+
+// keep reports whether a key passes the allow and deny lists.
+func keep(key string, allow, deny []string) bool {
+	if len(allow) > 0 && !match(key, allow) {
+		return false
+	}
+	return !match(key, deny)
+}
+
+func match(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
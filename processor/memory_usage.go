@@ -6,7 +6,7 @@ import (
 )
 
 // MemoryUsage Get memory usage.
-var MemoryUsage = func(record *types.Record) {
+var MemoryUsage types.Processor = func(record *types.Record, a ...interface{}) {
 	stat := new(runtime.MemStats)
 	runtime.ReadMemStats(stat)
 	record.Extra["MemoryUsage"] = stat.Alloc
@@ -6,6 +6,6 @@ import (
 )
 
 // ProcessID Get process ID.
-var ProcessID = func(record *types.Record) {
+var ProcessID types.Processor = func(record *types.Record, a ...interface{}) {
 	record.Extra["Pid"] = os.Getpid()
 }
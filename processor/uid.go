@@ -7,7 +7,7 @@ import (
 )
 
 // UID Uniqid processor.
-var UID = func(record *types.Record) {
+var UID types.Processor = func(record *types.Record, a ...interface{}) {
 	now := time.Now()
 	sec := now.Unix()
 	usec := now.UnixNano() % 0x100000
@@ -0,0 +1,62 @@
+package llog
+
+import (
+	"fmt"
+	"github.com/syyongx/llog/types"
+	"runtime/debug"
+)
+
+// RecoverAndLog Recovers a panic and logs its value and stack trace at CRITICAL,
+// a nil logger logs to the default logger. A crash file is written first if
+// set up by SetCrashDump. It must be deferred directly:
+//
+//	defer llog.RecoverAndLog(logger)
+func RecoverAndLog(l *Logger) {
+	if p := recover(); p != nil {
+		logPanic(l, p)
+	}
+}
+
+// RecoverLogAndRepanic Like RecoverAndLog, then panics again with the same value.
+// It must be deferred directly.
+func RecoverLogAndRepanic(l *Logger) {
+	if p := recover(); p != nil {
+		logPanic(l, p)
+		panic(p)
+	}
+}
+
+// Go Runs fn in a new goroutine, logging its panic to the default logger
+// instead of crashing the program.
+func Go(fn func()) {
+	Default().Go(fn)
+}
+
+// Go Runs fn in a new goroutine, logging its panic instead of crashing the program.
+func (l *Logger) Go(fn func()) {
+	go func() {
+		defer RecoverAndLog(l)
+		fn()
+	}()
+}
+
+func logPanic(l *Logger, p interface{}) {
+	if l == nil {
+		l = Default()
+	}
+	stack := debug.Stack()
+	fields := types.RecordContext{
+		"panic": fmt.Sprint(p),
+		"stack": string(stack),
+	}
+	path, err := WriteCrashDump(p, stack)
+	if path != "" {
+		fields["crash_dump"] = path
+	}
+	if err != nil {
+		fields["crash_dump_error"] = err.Error()
+		l.reportError(err)
+	}
+	l.AddRecordFields(nil, types.CRITICAL, fmt.Sprint("panic: ", p), fields)
+	l.Flush()
+}
@@ -1,15 +1,26 @@
 package llog
 
-import "errors"
+import (
+	"errors"
+	"github.com/syyongx/llog/types"
+	"sort"
+	"strings"
+	"sync"
+)
 
 // Registry struct
 type Registry struct {
-	loggers map[string]*Logger
+	mu        sync.RWMutex
+	loggers   map[string]*Logger
+	factories map[string]func() *Logger
 }
 
 // NewRegistry new registry
 func NewRegistry() *Registry {
-	return &Registry{loggers: make(map[string]*Logger)}
+	return &Registry{
+		loggers:   make(map[string]*Logger),
+		factories: make(map[string]func() *Logger),
+	}
 }
 
 // AddLogger Adds new logging channel to the registry
@@ -17,6 +28,8 @@ func (r *Registry) AddLogger(logger *Logger, name string, overwrite bool) error
 	if name == "" {
 		name = logger.GetName()
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if _, ok := r.loggers[name]; ok && !overwrite {
 		return errors.New("logger with the given name already exists")
 	}
@@ -26,26 +39,172 @@ func (r *Registry) AddLogger(logger *Logger, name string, overwrite bool) error
 
 // HasLogger Checks if such logging channel exists by name or instance
 func (r *Registry) HasLogger(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	_, ok := r.loggers[name]
 	return ok
 }
 
 // GetLogger Gets Logger instance from the registry
 func (r *Registry) GetLogger(name string) (*Logger, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	if v, ok := r.loggers[name]; ok {
 		return v, nil
 	}
 	return nil, errors.New("requested " + name + " logger instance is not in the registry")
 }
 
+// Register Registers a factory creating the named logger on first use by GetOrCreate.
+// The factory must not call back into the registry.
+func (r *Registry) Register(name string, factory func() *Logger) {
+	r.mu.Lock()
+	r.factories[name] = factory
+	r.mu.Unlock()
+}
+
+// GetOrCreate Gets Logger instance from the registry, creating it by its
+// registered factory if it does not exist yet.
+func (r *Registry) GetOrCreate(name string) (*Logger, error) {
+	r.mu.RLock()
+	v, ok := r.loggers[name]
+	r.mu.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.loggers[name]; ok {
+		return v, nil
+	}
+	factory, ok := r.factories[name]
+	if !ok {
+		return nil, errors.New("no factory registered for " + name + " logger")
+	}
+	v = factory()
+	if v == nil {
+		return nil, errors.New("factory of " + name + " logger returned nil")
+	}
+	r.loggers[name] = v
+	return v, nil
+}
+
+// Lookup Gets Logger instance from the registry by a dot separated name.
+// If it is not registered, a logger inheriting the handlers of the nearest
+// registered ancestor is created and registered: "app.db.queries" falls back
+// to "app.db", then to "app".
+func (r *Registry) Lookup(name string) (*Logger, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.loggers[name]; ok {
+		return v, nil
+	}
+	for ancestor := name; ; {
+		i := strings.LastIndex(ancestor, ".")
+		if i < 0 {
+			break
+		}
+		ancestor = ancestor[:i]
+		if parent, ok := r.loggers[ancestor]; ok {
+			l := parent.Child(name)
+			r.loggers[name] = l
+			return l, nil
+		}
+	}
+	return nil, errors.New("requested " + name + " logger and its ancestors are not in the registry")
+}
+
 // RemoveLogger Removes instance from registry by name or instance
 func (r *Registry) RemoveLogger(name string) {
-	if _, ok := r.loggers[name]; ok {
-		delete(r.loggers, name)
-	}
+	r.mu.Lock()
+	delete(r.loggers, name)
+	r.mu.Unlock()
 }
 
-// Clear Clears the registry
+// Clear Clears the registry, registered factories are kept.
 func (r *Registry) Clear() {
-	r.loggers = nil
+	r.mu.Lock()
+	r.loggers = make(map[string]*Logger)
+	r.mu.Unlock()
+}
+
+// SetLevel Set the minimum level of all the registered loggers.
+func (r *Registry) SetLevel(level int) {
+	r.Range(func(name string, l *Logger) bool {
+		l.SetLevel(level)
+		return true
+	})
+}
+
+// PushHandler Pushes a handler on to the stack of all the registered loggers.
+func (r *Registry) PushHandler(h types.IHandler) {
+	r.Range(func(name string, l *Logger) bool {
+		l.PushHandler(h)
+		return true
+	})
+}
+
+// FlushAll Flushes all the registered loggers, the first error is returned.
+func (r *Registry) FlushAll() error {
+	var err error
+	r.Range(func(name string, l *Logger) bool {
+		if e := l.Flush(); e != nil && err == nil {
+			err = e
+		}
+		return true
+	})
+	return err
+}
+
+// CloseAll Closes the handlers of all the registered loggers.
+// Handlers shared by several loggers are closed once.
+func (r *Registry) CloseAll() {
+	closed := make(map[types.IHandler]bool)
+	r.Range(func(name string, l *Logger) bool {
+		for _, h := range l.GetHandlers() {
+			if !closed[h] {
+				closed[h] = true
+				h.Close()
+			}
+		}
+		return true
+	})
+}
+
+// Names Gets the sorted names of the registered loggers.
+func (r *Registry) Names() []string {
+	return r.sortedNames(r.Loggers())
+}
+
+// Loggers Gets a copy of the registered loggers by name.
+func (r *Registry) Loggers() map[string]*Logger {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	loggers := make(map[string]*Logger, len(r.loggers))
+	for name, l := range r.loggers {
+		loggers[name] = l
+	}
+	return loggers
+}
+
+// Range Calls fn for each registered logger in name order until fn returns false.
+// fn may safely modify the registry.
+func (r *Registry) Range(fn func(name string, logger *Logger) bool) {
+	loggers := r.Loggers()
+	for _, name := range r.sortedNames(loggers) {
+		if !fn(name, loggers[name]) {
+			return
+		}
+	}
+}
+
+// sortedNames of a logger map.
+func (r *Registry) sortedNames(loggers map[string]*Logger) []string {
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,149 @@
+// Package replay persists records in dumps and re-dispatches them, such as
+// reprocessing the records of an outage into a new sink.
+//
+// A dump is written by a handler using the dump formatter, as NDJSON lines
+// of types.EncodeJSON or length-prefixed types.EncodeBinary frames:
+//
+//	file := handler.NewFileWith("/var/log/app.dump", handler.WithFormatter(replay.NewFormatter(replay.NDJSON)))
+//
+// and replayed through a logger:
+//
+//	n, err := replay.Replay(logger, f, replay.NDJSON)
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/types"
+	"io"
+)
+
+// Dump formats.
+const (
+	// NDJSON one JSON record per line.
+	NDJSON = iota
+	// Binary length-prefixed binary records.
+	Binary
+)
+
+// maxFrameSize the largest binary frame read, guarding against corrupt lengths.
+const maxFrameSize = 64 << 20
+
+// Formatter Formats records as dump entries.
+type Formatter struct {
+	format int
+}
+
+// NewFormatter New dump formatter, format is NDJSON or Binary.
+func NewFormatter(format int) *Formatter {
+	return &Formatter{format: format}
+}
+
+// Format Formats a record as a dump entry.
+func (f *Formatter) Format(record *types.Record) error {
+	if f.format == Binary {
+		data, err := types.EncodeBinary(record)
+		if err != nil {
+			return err
+		}
+		var size [binary.MaxVarintLen64]byte
+		record.Formatted.Write(size[:binary.PutUvarint(size[:], uint64(len(data)))])
+		record.Formatted.Write(data)
+		return nil
+	}
+	data, err := types.EncodeJSON(record)
+	if err != nil {
+		return err
+	}
+	record.Formatted.Write(data)
+	record.Formatted.WriteByte('\n')
+	return nil
+}
+
+// FormatBatch Formats a set of records.
+func (f *Formatter) FormatBatch(records []*types.Record) error {
+	for _, record := range records {
+		if err := f.Format(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader Reads the records of a dump.
+type Reader struct {
+	r      *bufio.Reader
+	format int
+}
+
+// NewReader New dump reader, format is NDJSON or Binary.
+func NewReader(r io.Reader, format int) *Reader {
+	return &Reader{r: bufio.NewReader(r), format: format}
+}
+
+// Read Reads the next record into record, io.EOF at the end of the dump.
+func (r *Reader) Read(record *types.Record) error {
+	if r.format == Binary {
+		size, err := binary.ReadUvarint(r.r)
+		if err != nil {
+			return err
+		}
+		if size > maxFrameSize {
+			return errors.New("binary record too large")
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return err
+		}
+		return types.DecodeBinary(data, record)
+	}
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) > 1 || (len(line) == 1 && line[0] != '\n') {
+			return types.DecodeJSON(line, record)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Replay Re-dispatches the records of a dump through the handlers of the
+// logger as they were, returning the number of records replayed.
+// It stops at the first unreadable record.
+func Replay(l *llog.Logger, r io.Reader, format int) (int, error) {
+	return replay(r, format, func(record *types.Record) {
+		l.HandleRecord(record)
+	})
+}
+
+// ReplayHandler Re-dispatches the records of a dump to a handler, returning
+// the number of records replayed. It stops at the first unreadable record.
+func ReplayHandler(h types.IHandler, r io.Reader, format int) (int, error) {
+	return replay(r, format, func(record *types.Record) {
+		if h.IsHandling(record) {
+			h.Handle(record)
+		}
+	})
+}
+
+func replay(r io.Reader, format int, handle func(*types.Record)) (int, error) {
+	reader := NewReader(r, format)
+	n := 0
+	for {
+		record := types.GetRecord()
+		err := reader.Read(record)
+		if err != nil {
+			types.ReleaseRecord(record)
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		handle(record)
+		types.ReleaseRecord(record)
+		n++
+	}
+}
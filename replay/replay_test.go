@@ -0,0 +1,29 @@
+package replay
+
+import (
+	"bytes"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	for _, format := range []int{NDJSON, Binary} {
+		var dump, out bytes.Buffer
+		logger := llog.NewLogger("app")
+		logger.PushHandler(handler.NewStreamWith(&dump, handler.WithFormatter(NewFormatter(format))))
+		logger.Info("first")
+		logger.Warning("second")
+
+		sink := llog.NewLogger("sink")
+		sink.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLine("%Channel%.%LevelName%: %Message%\n", ""))))
+		n, err := Replay(sink, &dump, format)
+		if err != nil || n != 2 {
+			t.Fatalf("replayed %d records: %v", n, err)
+		}
+		if out.String() != "app.info: first\napp.warning: second\n" {
+			t.Errorf("unexpected replayed records %q", out.String())
+		}
+	}
+}
@@ -0,0 +1,129 @@
+//go:build llog_grpc
+// +build llog_grpc
+
+package rpclog
+
+import (
+	"context"
+	"github.com/syyongx/llog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// UnaryServerInterceptor Logs unary server calls.
+func (l *Logger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		logger := l.Scoped(info.FullMethod)
+		ctx = llog.NewContext(ctx, logger)
+		resp, err := handler(ctx, req)
+		l.Log(ctx, logger, &Call{
+			Method:   info.FullMethod,
+			Side:     "server",
+			Code:     status.Code(err).String(),
+			Duration: time.Since(start),
+			ReqSize:  size(req),
+			RespSize: size(resp),
+			Err:      err,
+		})
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor Logs stream server calls.
+func (l *Logger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		logger := l.Scoped(info.FullMethod)
+		ctx := llog.NewContext(ss.Context(), logger)
+		wrapped := &serverStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, wrapped)
+		l.Log(ctx, logger, &Call{
+			Method:   info.FullMethod,
+			Side:     "server",
+			Stream:   true,
+			Code:     status.Code(err).String(),
+			Duration: time.Since(start),
+			ReqSize:  wrapped.received,
+			RespSize: wrapped.sent,
+			Err:      err,
+		})
+		return err
+	}
+}
+
+// UnaryClientInterceptor Logs unary client calls.
+func (l *Logger) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		l.Log(ctx, nil, &Call{
+			Method:   method,
+			Side:     "client",
+			Code:     status.Code(err).String(),
+			Duration: time.Since(start),
+			ReqSize:  size(req),
+			RespSize: size(reply),
+			Err:      err,
+		})
+		return err
+	}
+}
+
+// StreamClientInterceptor Logs the opening of client streams.
+func (l *Logger) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		l.Log(ctx, nil, &Call{
+			Method:   method,
+			Side:     "client",
+			Stream:   true,
+			Code:     status.Code(err).String(),
+			Duration: time.Since(start),
+			Err:      err,
+		})
+		return cs, err
+	}
+}
+
+// serverStream counts the message sizes and carries the call's context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	sent     int
+	received int
+}
+
+// Context Get the context carrying the call's logger.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg counts the size of sent messages.
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent += size(m)
+	}
+	return err
+}
+
+// RecvMsg counts the size of received messages.
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received += size(m)
+	}
+	return err
+}
+
+// size of a protobuf message, 0 for other values.
+func size(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
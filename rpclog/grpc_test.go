@@ -0,0 +1,158 @@
+//go:build llog_grpc
+// +build llog_grpc
+
+package rpclog
+
+import (
+	"context"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/llogtest"
+	"github.com/syyongx/llog/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+// fakeStream a server stream receiving and sending the same message.
+type fakeStream struct {
+	grpc.ServerStream
+	msg proto.Message
+}
+
+func (s *fakeStream) Context() context.Context    { return context.Background() }
+func (s *fakeStream) SendMsg(m interface{}) error { return nil }
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+func newTestLogger() (*Logger, *llogtest.Handler) {
+	h := llogtest.NewHandler()
+	logger := llog.NewLogger("rpc")
+	logger.PushHandler(h)
+	return New(logger), h
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	l, h := newTestLogger()
+	intercept := l.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+	req := wrapperspb.String("hello")
+
+	resp, err := intercept(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if llog.FromContext(ctx).GetFields()["rpc.method"] != "/pkg.Svc/Get" {
+			t.Error("expected the scoped logger in the context")
+		}
+		return wrapperspb.String("hello, world"), nil
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("expected the handler's reply, got %v, %v", resp, err)
+	}
+	llogtest.AssertLogged(t, h, types.INFO, "finished server call /pkg.Svc/Get")
+	ctx := h.Entries()[0].Context
+	if ctx["rpc.code"] != "OK" || ctx["rpc.side"] != "server" || ctx["rpc.stream"] != false {
+		t.Errorf("unexpected fields %v", ctx)
+	}
+	if ctx["request_size"] != proto.Size(req) || ctx["reply_size"] != proto.Size(resp.(proto.Message)) {
+		t.Errorf("unexpected sizes %v, %v", ctx["request_size"], ctx["reply_size"])
+	}
+
+	h.Reset()
+	_, err = intercept(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such item")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+	llogtest.AssertLogged(t, h, types.WARNING, "finished server call /pkg.Svc/Get")
+	if ctx := h.Entries()[0].Context; ctx["rpc.code"] != "NotFound" || ctx["error"] == nil {
+		t.Errorf("unexpected fields %v", ctx)
+	}
+
+	h.Reset()
+	intercept(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	})
+	llogtest.AssertLogged(t, h, types.ERROR, "finished server call /pkg.Svc/Get")
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	l, h := newTestLogger()
+	intercept := l.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/List"}
+	msg := wrapperspb.String("item")
+
+	err := intercept(nil, &fakeStream{msg: msg}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		if llog.FromContext(ss.Context()).GetFields()["rpc.method"] != "/pkg.Svc/List" {
+			t.Error("expected the scoped logger in the stream's context")
+		}
+		for i := 0; i < 2; i++ {
+			if err := ss.RecvMsg(&wrapperspb.StringValue{}); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if err := ss.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llogtest.AssertLogged(t, h, types.INFO, "finished server call /pkg.Svc/List")
+	ctx := h.Entries()[0].Context
+	if ctx["rpc.code"] != "OK" || ctx["rpc.stream"] != true {
+		t.Errorf("unexpected fields %v", ctx)
+	}
+	if ctx["request_size"] != 2*proto.Size(msg) || ctx["reply_size"] != 3*proto.Size(msg) {
+		t.Errorf("unexpected sizes %v, %v", ctx["request_size"], ctx["reply_size"])
+	}
+
+	h.Reset()
+	intercept(nil, &fakeStream{msg: msg}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return status.Error(codes.Unavailable, "down")
+	})
+	llogtest.AssertLogged(t, h, types.ERROR, "finished server call /pkg.Svc/List")
+	if ctx := h.Entries()[0].Context; ctx["rpc.code"] != "Unavailable" || ctx["error"] == nil {
+		t.Errorf("unexpected fields %v", ctx)
+	}
+}
+
+func TestClientInterceptors(t *testing.T) {
+	l, h := newTestLogger()
+	req, reply := wrapperspb.String("hello"), wrapperspb.String("")
+	err := l.UnaryClientInterceptor()(context.Background(), "/pkg.Svc/Get", req, reply, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			reply.(*wrapperspb.StringValue).Value = "hello, world"
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	llogtest.AssertLogged(t, h, types.INFO, "finished client call /pkg.Svc/Get")
+	ctx := h.Entries()[0].Context
+	if ctx["rpc.side"] != "client" || ctx["rpc.method"] != "/pkg.Svc/Get" {
+		t.Errorf("unexpected fields %v", ctx)
+	}
+	if ctx["request_size"] != proto.Size(req) || ctx["reply_size"] != proto.Size(reply) {
+		t.Errorf("unexpected sizes %v, %v", ctx["request_size"], ctx["reply_size"])
+	}
+
+	h.Reset()
+	_, err = l.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{}, nil, "/pkg.Svc/List",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return nil, status.Error(codes.PermissionDenied, "denied")
+		})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected the streamer's error, got %v", err)
+	}
+	llogtest.AssertLogged(t, h, types.WARNING, "finished client call /pkg.Svc/List")
+	if ctx := h.Entries()[0].Context; ctx["rpc.stream"] != true || ctx["rpc.code"] != "PermissionDenied" {
+		t.Errorf("unexpected fields %v", ctx)
+	}
+}
@@ -0,0 +1,117 @@
+// Package rpclog logs RPC calls through llog.
+//
+// The gRPC server and client interceptors are built with the llog_grpc tag,
+// as they require the google.golang.org/grpc module:
+//
+//	go build -tags llog_grpc
+//
+//	l := rpclog.New(logger)
+//	l.SetMethodLevel("/grpc.health.v1.Health/Check", types.DEBUG)
+//	s := grpc.NewServer(
+//		grpc.UnaryInterceptor(l.UnaryServerInterceptor()),
+//		grpc.StreamInterceptor(l.StreamServerInterceptor()),
+//	)
+//
+// Calls are logged with the call's context, so processors such as
+// otel.Processor add the trace of the call to the records.
+package rpclog
+
+import (
+	"context"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/types"
+	"sync"
+	"time"
+)
+
+// Call describes a finished RPC.
+type Call struct {
+	Method   string // the full method name, such as "/pkg.Service/Method"
+	Side     string // "server" or "client"
+	Stream   bool
+	Code     string // the status code name, such as "OK" or "NotFound"
+	Duration time.Duration
+	ReqSize  int // bytes received by servers or sent by clients
+	RespSize int // bytes sent by servers or received by clients
+	Err      error
+}
+
+// warnCodes the status codes caused by the caller, logged at WARNING.
+var warnCodes = map[string]bool{
+	"Canceled":           true,
+	"InvalidArgument":    true,
+	"NotFound":           true,
+	"AlreadyExists":      true,
+	"PermissionDenied":   true,
+	"Unauthenticated":    true,
+	"ResourceExhausted":  true,
+	"FailedPrecondition": true,
+	"Aborted":            true,
+	"OutOfRange":         true,
+}
+
+// Logger logs RPC calls.
+type Logger struct {
+	logger *llog.Logger
+	mu     sync.RWMutex
+	levels map[string]int
+}
+
+// New New RPC logger
+func New(logger *llog.Logger) *Logger {
+	return &Logger{
+		logger: logger,
+		levels: make(map[string]int),
+	}
+}
+
+// SetMethodLevel Set the level successful calls of a method are logged at,
+// such as DEBUG for health checks. Failed calls keep the level of their code.
+func (l *Logger) SetMethodLevel(method string, level int) {
+	l.mu.Lock()
+	l.levels[method] = level
+	l.mu.Unlock()
+}
+
+// Level Gets the level a call is logged at: INFO for OK or the method level,
+// WARNING for codes caused by the caller and ERROR for the other codes.
+func (l *Logger) Level(call *Call) int {
+	if call.Code == "OK" {
+		l.mu.RLock()
+		level, ok := l.levels[call.Method]
+		l.mu.RUnlock()
+		if ok {
+			return level
+		}
+		return types.INFO
+	}
+	if warnCodes[call.Code] {
+		return types.WARNING
+	}
+	return types.ERROR
+}
+
+// Scoped Gets the logger of a call, it is passed to the server handlers in the
+// call's context and can be read by llog.FromContext.
+func (l *Logger) Scoped(method string) *llog.Logger {
+	return l.logger.With(types.RecordContext{"rpc.method": method})
+}
+
+// Log Logs a finished call.
+func (l *Logger) Log(ctx context.Context, logger *llog.Logger, call *Call) {
+	if logger == nil {
+		logger = l.Scoped(call.Method)
+	}
+	fields := types.RecordContext{
+		"rpc.side":     call.Side,
+		"rpc.stream":   call.Stream,
+		"rpc.code":     call.Code,
+		"duration_ms":  float64(call.Duration) / float64(time.Millisecond),
+		"request_size": call.ReqSize,
+		"reply_size":   call.RespSize,
+	}
+	if call.Err != nil {
+		fields["error"] = call.Err.Error()
+	}
+	logger.AddRecordFields(ctx, l.Level(call), "finished "+call.Side+" call "+call.Method, fields)
+}
@@ -0,0 +1,88 @@
+package rpclog
+
+import (
+	"context"
+	"errors"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/llogtest"
+	"github.com/syyongx/llog/types"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	h := llogtest.NewHandler()
+	logger := llog.NewLogger("rpc")
+	logger.PushHandler(h)
+	l := New(logger)
+	l.SetMethodLevel("/grpc.health.v1.Health/Check", types.DEBUG)
+
+	tests := []struct {
+		call  Call
+		level int
+	}{
+		{Call{Method: "/pkg.Svc/Get", Side: "server", Code: "OK"}, types.INFO},
+		{Call{Method: "/grpc.health.v1.Health/Check", Side: "server", Code: "OK"}, types.DEBUG},
+		{Call{Method: "/grpc.health.v1.Health/Check", Side: "server", Code: "Unavailable", Err: errors.New("down")}, types.ERROR},
+		{Call{Method: "/pkg.Svc/Get", Side: "client", Code: "NotFound", Err: errors.New("no such item")}, types.WARNING},
+		{Call{Method: "/pkg.Svc/Get", Side: "server", Code: "Internal", Err: errors.New("boom")}, types.ERROR},
+	}
+	for _, tt := range tests {
+		h.Reset()
+		l.Log(context.Background(), nil, &tt.call)
+		entries := h.Entries()
+		if len(entries) != 1 {
+			t.Fatalf("%s %s: expected 1 record, got %d", tt.call.Method, tt.call.Code, len(entries))
+		}
+		if entries[0].Level != tt.level {
+			t.Errorf("%s %s: expected level %d, got %d", tt.call.Method, tt.call.Code, tt.level, entries[0].Level)
+		}
+		ctx := entries[0].Context
+		if ctx["rpc.method"] != tt.call.Method || ctx["rpc.side"] != tt.call.Side || ctx["rpc.code"] != tt.call.Code {
+			t.Errorf("%s %s: unexpected fields %v", tt.call.Method, tt.call.Code, ctx)
+		}
+		if tt.call.Err != nil && ctx["error"] != tt.call.Err.Error() {
+			t.Errorf("%s %s: expected error %q, got %v", tt.call.Method, tt.call.Code, tt.call.Err, ctx["error"])
+		}
+		if tt.call.Err == nil && ctx["error"] != nil {
+			t.Errorf("%s %s: unexpected error %v", tt.call.Method, tt.call.Code, ctx["error"])
+		}
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	h := llogtest.NewHandler()
+	logger := llog.NewLogger("rpc")
+	logger.PushHandler(h)
+	l := New(logger)
+
+	scoped := l.Scoped("/pkg.Svc/List")
+	if scoped.GetFields()["rpc.method"] != "/pkg.Svc/List" {
+		t.Errorf("expected the method in the scoped logger, got %v", scoped.GetFields())
+	}
+	l.Log(context.Background(), scoped, &Call{
+		Method:   "/pkg.Svc/List",
+		Side:     "server",
+		Stream:   true,
+		Code:     "OK",
+		Duration: 1500 * time.Microsecond,
+		ReqSize:  12,
+		RespSize: 34,
+	})
+	llogtest.AssertLogged(t, h, types.INFO, "finished server call /pkg.Svc/List")
+	ctx := h.Entries()[0].Context
+	want := types.RecordContext{
+		"rpc.method":   "/pkg.Svc/List",
+		"rpc.side":     "server",
+		"rpc.stream":   true,
+		"rpc.code":     "OK",
+		"duration_ms":  1.5,
+		"request_size": 12,
+		"reply_size":   34,
+	}
+	for k, v := range want {
+		if ctx[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, ctx[k])
+		}
+	}
+}
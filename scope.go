@@ -0,0 +1,54 @@
+package llog
+
+import (
+	"github.com/syyongx/llog/types"
+	"time"
+)
+
+// TimedScope Starts timing an operation, such as a query, and returns the
+// function ending it, which logs the elapsed time and whether it succeeded
+// under the "elapsed" and "success" fields:
+//
+//	done := logger.TimedScope("db.query", types.RecordContext{"table": "users"})
+//	rows, err := db.Query(q)
+//	done(err)
+//
+// Successful scopes are logged at the INFO level, unless faster than the scope
+// threshold, and failed ones at the ERROR level with the error.
+func (l *Logger) TimedScope(name string, fields types.RecordContext) func(err error) {
+	clock := l.GetClock()
+	start := clock.Now()
+	return func(err error) {
+		elapsed := clock.Now().Sub(start)
+		if err == nil && elapsed < l.GetScopeThreshold() {
+			return
+		}
+		ctx := make(types.RecordContext, len(fields)+3)
+		for k, v := range fields {
+			ctx[k] = v
+		}
+		ctx["elapsed"] = elapsed
+		ctx["success"] = err == nil
+		level := types.INFO
+		if err != nil {
+			ctx["error"] = err
+			level = types.ERROR
+		}
+		l.AddRecordFields(nil, level, name, ctx)
+	}
+}
+
+// SetScopeThreshold Only logs the successful scopes lasting at least threshold.
+// Child loggers inherit the threshold.
+func (l *Logger) SetScopeThreshold(threshold time.Duration) {
+	l.mu.Lock()
+	l.scopeThreshold = threshold
+	l.mu.Unlock()
+}
+
+// GetScopeThreshold Get the scope threshold, 0 logs all the scopes.
+func (l *Logger) GetScopeThreshold() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.scopeThreshold
+}
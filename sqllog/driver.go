@@ -0,0 +1,195 @@
+package sqllog
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// Wrap Wraps a database/sql driver so its connections log queries through l.
+func Wrap(d driver.Driver, l *Logger) driver.Driver {
+	return &wrappedDriver{Driver: d, logger: l}
+}
+
+type wrappedDriver struct {
+	driver.Driver
+	logger *Logger
+}
+
+// Open Opens a logging connection.
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, logger: d.logger}, nil
+}
+
+// conn logs the queries of a connection. The context variants return
+// driver.ErrSkip when the wrapped connection lacks them, so that database/sql
+// falls back to prepared statements.
+type conn struct {
+	driver.Conn
+	logger *Logger
+}
+
+// Prepare Prepares a logging statement.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext Prepares a logging statement.
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var s driver.Stmt
+	var err error
+	if cp, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = cp.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, query: query, logger: c.logger}, nil
+}
+
+// BeginTx Starts a transaction.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if cb, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return cb.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+// ExecContext Executes and logs a query without preparing it.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	c.logger.trace(ctx, query, args, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+// QueryContext Executes and logs a query without preparing it.
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	c.logger.trace(ctx, query, args, start, -1, err)
+	return rows, err
+}
+
+// Ping Pings the wrapped connection if it supports it.
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession Resets the wrapped connection if it supports it.
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue Uses the argument conversion of the wrapped connection.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// stmt logs the executions of a prepared statement.
+type stmt struct {
+	driver.Stmt
+	query  string
+	logger *Logger
+}
+
+// Exec Executes and logs the statement.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+// Query Executes and logs the statement.
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+// ExecContext Executes and logs the statement.
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if se, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = se.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(values(args))
+	}
+	s.logger.trace(ctx, s.query, args, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+// QueryContext Executes and logs the statement.
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if sq, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = sq.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(values(args))
+	}
+	s.logger.trace(ctx, s.query, args, start, -1, err)
+	return rows, err
+}
+
+// CheckNamedValue Uses the argument conversion of the wrapped statement.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// rowsAffected of a result, -1 if unknown.
+func rowsAffected(res driver.Result, err error) int64 {
+	if err != nil || res == nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	v := make([]driver.Value, len(args))
+	for i, a := range args {
+		v[i] = a.Value
+	}
+	return v
+}
@@ -0,0 +1,79 @@
+//go:build llog_gorm
+// +build llog_gorm
+
+package sqllog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/syyongx/llog/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"time"
+)
+
+// Gorm Gets an adapter implementing gorm's logger.Interface.
+func (l *Logger) Gorm() logger.Interface {
+	return &gormLogger{Logger: l, mode: logger.Info}
+}
+
+type gormLogger struct {
+	*Logger
+	mode logger.LogLevel
+}
+
+// LogMode Gets an adapter logging up to the given gorm level.
+func (g *gormLogger) LogMode(mode logger.LogLevel) logger.Interface {
+	c := *g
+	c.mode = mode
+	return &c
+}
+
+// Info Logs a gorm message at INFO.
+func (g *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if g.mode >= logger.Info {
+		g.logger.AddRecordContext(ctx, types.INFO, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Warn Logs a gorm message at WARNING.
+func (g *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if g.mode >= logger.Warn {
+		g.logger.AddRecordContext(ctx, types.WARNING, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Error Logs a gorm message at ERROR.
+func (g *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if g.mode >= logger.Error {
+		g.logger.AddRecordContext(ctx, types.ERROR, fmt.Sprintf(msg, data...))
+	}
+}
+
+// Trace Logs a query, record not found errors are not failures.
+func (g *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if g.mode <= logger.Silent {
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	d := time.Since(begin)
+	switch g.Level(d, err) {
+	case types.ERROR:
+		if g.mode < logger.Error {
+			return
+		}
+	case types.WARNING:
+		if g.mode < logger.Warn {
+			return
+		}
+	default:
+		if g.mode < logger.Info {
+			return
+		}
+	}
+	query, rows := fc()
+	g.Log(ctx, query, nil, d, rows, err)
+}
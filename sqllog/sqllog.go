@@ -0,0 +1,93 @@
+// Package sqllog logs database queries through llog.
+//
+// Wrap a database/sql driver and register it under a new name:
+//
+//	l := sqllog.New(logger)
+//	l.SlowThreshold = 200 * time.Millisecond
+//	sql.Register("mysql-logged", sqllog.Wrap(&mysql.MySQLDriver{}, l))
+//	db, err := sql.Open("mysql-logged", dsn)
+//
+// The gorm logger.Interface adapter is built with the llog_gorm tag, as it
+// requires the gorm.io/gorm module:
+//
+//	db, err := gorm.Open(dialector, &gorm.Config{Logger: l.Gorm()})
+package sqllog
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/types"
+	"time"
+)
+
+// Logger logs queries, DEBUG for queries, WARNING for the ones slower than
+// SlowThreshold and ERROR for failed ones.
+type Logger struct {
+	logger *llog.Logger
+
+	// SlowThreshold the duration from which queries are logged at WARNING, 0 disables it.
+	SlowThreshold time.Duration
+	// LogArgs adds the query arguments to the records, which may hold sensitive data.
+	LogArgs bool
+}
+
+// New New query logger
+func New(logger *llog.Logger) *Logger {
+	return &Logger{logger: logger}
+}
+
+// Level Gets the level a query is logged at.
+func (l *Logger) Level(d time.Duration, err error) int {
+	switch {
+	case err != nil && err != sql.ErrNoRows && err != driver.ErrSkip:
+		return types.ERROR
+	case l.SlowThreshold > 0 && d >= l.SlowThreshold:
+		return types.WARNING
+	}
+	return types.DEBUG
+}
+
+// Log Logs a query that took d, rows is the number of affected rows or -1 if unknown.
+func (l *Logger) Log(ctx context.Context, query string, args []interface{}, d time.Duration, rows int64, err error) {
+	level := l.Level(d, err)
+	if !l.logger.IsHandling(level) {
+		return
+	}
+	fields := types.RecordContext{
+		"sql":         query,
+		"duration_ms": float64(d) / float64(time.Millisecond),
+	}
+	if rows >= 0 {
+		fields["rows"] = rows
+	}
+	if l.LogArgs && len(args) > 0 {
+		fields["args"] = fmt.Sprint(args...)
+	}
+	msg := "query"
+	switch level {
+	case types.ERROR:
+		fields["error"] = err.Error()
+		msg = "query failed"
+	case types.WARNING:
+		msg = "slow query"
+	}
+	l.logger.AddRecordFields(ctx, level, msg, fields)
+}
+
+// trace logs a driver call started at start, unless the driver skipped it.
+func (l *Logger) trace(ctx context.Context, query string, args []driver.NamedValue, start time.Time, rows int64, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	var values []interface{}
+	if l.LogArgs {
+		values = make([]interface{}, len(args))
+		for i, a := range args {
+			values[i] = a.Value
+		}
+	}
+	l.Log(ctx, query, values, time.Since(start), rows, err)
+}
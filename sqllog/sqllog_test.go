@@ -0,0 +1,95 @@
+package sqllog
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/syyongx/llog"
+	"github.com/syyongx/llog/formatter"
+	"github.com/syyongx/llog/handler"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDriver a driver whose statements fail on queries containing "fail".
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt(query), nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no tx") }
+
+type fakeStmt string
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(string(s), "fail") {
+		return nil, errors.New("syntax error")
+	}
+	if strings.Contains(string(s), "slow") {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return driver.RowsAffected(3), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return []string{"id"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func TestDriver(t *testing.T) {
+	var out bytes.Buffer
+	logger := llog.NewLogger("sql")
+	logger.PushHandler(handler.NewStreamWith(&out, handler.WithFormatter(formatter.NewLogfmt(""))))
+	l := New(logger)
+	l.SlowThreshold = time.Millisecond
+	l.LogArgs = true
+	sql.Register("sqllog-fake", Wrap(fakeDriver{}, l))
+	db, err := sql.Open("sqllog-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("update t set a = ?", 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("update slow"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("fail"); err == nil {
+		t.Fatal("expected an error")
+	}
+	rows, err := db.Query("select id from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 records, got %q", out.String())
+	}
+	wants := [][]string{
+		{"level=debug", "rows=3", "args=7"},
+		{"level=warning", `msg="slow query"`},
+		{"level=error", `error="syntax error"`},
+		{"level=debug", `sql="select id from t"`},
+	}
+	for i, want := range wants {
+		for _, w := range want {
+			if !strings.Contains(lines[i], w) {
+				t.Errorf("missing %s in %s", w, lines[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"bytes"
+	"sync"
+)
+
+// MaxPooledBufferSize buffers grown past this size are dropped instead of
+// being pooled, so a few huge records do not pin memory.
+const MaxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// GetBuffer Gets an empty buffer from the pool.
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer Returns a buffer to the pool once written.
+func PutBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > MaxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,121 @@
+package types
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock Interface of the time source of loggers and handlers,
+// so tests can drive rotation and flushing without sleeping.
+type Clock interface {
+	// Gets the current time.
+	Now() time.Time
+
+	// Creates a ticker firing every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker Interface of a ticker created by a Clock.
+type Ticker interface {
+	// Gets the channel the ticks are delivered on.
+	C() <-chan time.Time
+
+	// Stops the ticker.
+	Stop()
+}
+
+// SystemClock the clock of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// ManualClock a clock that only moves when told to, for tests.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+// NewManualClock New manual clock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now Gets the time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker Creates a ticker firing as the clock is moved past its period.
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTicker{
+		clock:  c,
+		period: d,
+		next:   c.now.Add(d),
+		c:      make(chan time.Time, 1),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Add Moves the clock forward by d, firing the tickers due. Like time.Ticker,
+// a ticker whose previous tick was not received drops the new one.
+func (c *ManualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if c.now.Before(t.next) {
+			continue
+		}
+		for !c.now.Before(t.next) {
+			t.next = t.next.Add(t.period)
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+}
+
+type manualTicker struct {
+	clock  *ManualClock
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, v := range t.clock.tickers {
+		if v == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// SchemaVersion the version of the record encodings written by this library.
+// Decoders read the versions up to their own, ignoring the fields they do not know.
+const SchemaVersion = 1
+
+// binaryMagic the first byte of the binary record encoding.
+const binaryMagic = 0x4c
+
+// ErrSchemaVersion Returned when decoding a record of an unknown schema version.
+var ErrSchemaVersion = errors.New("unknown record schema version")
+
+// field tags of the binary encoding, new fields get new tags.
+const (
+	tagSeq = iota + 1
+	tagLevel
+	tagLevelName
+	tagChannel
+	tagTime
+	tagMessage
+	tagContext
+	tagExtra
+	tagTemplate
+	tagArgs
+)
+
+// normalizer renders the encoded values with their log representation, see SetNormalizer.
+var normalizer atomic.Value
+
+// normalizerHolder keeps the stored type of normalizer constant.
+type normalizerHolder struct {
+	fn func(v interface{}) interface{}
+}
+
+// SetNormalizer Set the function rendering the context, extra and args of the
+// encoded records with their log representation, so that the types registered
+// to the formatters are not encoded as they are. Set by the formatter package.
+func SetNormalizer(fn func(v interface{}) interface{}) {
+	normalizer.Store(normalizerHolder{fn})
+}
+
+// normalizeMap renders the values of m with the normalizer if any.
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	h, ok := normalizer.Load().(normalizerHolder)
+	if !ok || h.fn == nil || len(m) == 0 {
+		return m
+	}
+	if out, ok := h.fn(m).(map[string]interface{}); ok {
+		return out
+	}
+	return m
+}
+
+// normalizeArgs renders the values of args with the normalizer if any.
+func normalizeArgs(args []interface{}) []interface{} {
+	h, ok := normalizer.Load().(normalizerHolder)
+	if !ok || h.fn == nil || len(args) == 0 {
+		return args
+	}
+	if out, ok := h.fn(args).([]interface{}); ok {
+		return out
+	}
+	return args
+}
+
+// jsonRecord the JSON encoding of a record.
+type jsonRecord struct {
+	Version   int           `json:"v"`
+	Seq       uint64        `json:"seq,omitempty"`
+	Level     int           `json:"level"`
+	LevelName string        `json:"level_name"`
+	Channel   string        `json:"channel"`
+	Datetime  time.Time     `json:"datetime"`
+	Message   string        `json:"message"`
+	Context   RecordContext `json:"context,omitempty"`
+	Extra     RecordExtra   `json:"extra,omitempty"`
+	Template  string        `json:"template,omitempty"`
+	Args      []interface{} `json:"args,omitempty"`
+}
+
+// EncodeJSON Encodes a record with its schema version as JSON, to be persisted and decoded by DecodeJSON.
+// The values are rendered with their log representation, see SetNormalizer.
+func EncodeJSON(record *Record) ([]byte, error) {
+	return json.Marshal(jsonRecord{
+		Version:   SchemaVersion,
+		Seq:       record.Seq,
+		Level:     record.Level,
+		LevelName: record.LevelName,
+		Channel:   record.Channel,
+		Datetime:  record.Datetime,
+		Message:   record.Message,
+		Context:   normalizeMap(record.Context),
+		Extra:     normalizeMap(record.Extra),
+		Template:  record.Template,
+		Args:      normalizeArgs(record.Args),
+	})
+}
+
+// DecodeJSON Decodes a record encoded by EncodeJSON into record.
+// Field values come back as JSON values, such as float64 for numbers.
+func DecodeJSON(data []byte, record *Record) error {
+	var r jsonRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	if r.Version < 1 || r.Version > SchemaVersion {
+		return ErrSchemaVersion
+	}
+	record.Seq = r.Seq
+	record.Level = r.Level
+	record.LevelName = r.LevelName
+	record.Channel = r.Channel
+	record.Datetime = r.Datetime
+	record.Message = r.Message
+	record.Context = r.Context
+	record.Extra = r.Extra
+	record.Template = r.Template
+	record.Args = r.Args
+	if record.Extra == nil {
+		record.Extra = make(RecordExtra)
+	}
+	return nil
+}
+
+// EncodeBinary Encodes a record with its schema version in a compact binary
+// form, to be persisted and decoded by DecodeBinary. Fields are tagged and
+// length-prefixed so that decoders skip the fields they do not know.
+// The context and extra fields are JSON encoded.
+func EncodeBinary(record *Record) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(binaryMagic)
+	putUvarint(&buf, SchemaVersion)
+
+	var num [binary.MaxVarintLen64]byte
+	putField(&buf, tagSeq, num[:binary.PutUvarint(num[:], record.Seq)])
+	putField(&buf, tagLevel, num[:binary.PutVarint(num[:], int64(record.Level))])
+	putField(&buf, tagLevelName, []byte(record.LevelName))
+	putField(&buf, tagChannel, []byte(record.Channel))
+	t, err := record.Datetime.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	putField(&buf, tagTime, t)
+	putField(&buf, tagMessage, []byte(record.Message))
+	if len(record.Context) > 0 {
+		ctx, err := json.Marshal(normalizeMap(record.Context))
+		if err != nil {
+			return nil, err
+		}
+		putField(&buf, tagContext, ctx)
+	}
+	if len(record.Extra) > 0 {
+		extra, err := json.Marshal(normalizeMap(record.Extra))
+		if err != nil {
+			return nil, err
+		}
+		putField(&buf, tagExtra, extra)
+	}
+	if record.Template != "" {
+		putField(&buf, tagTemplate, []byte(record.Template))
+	}
+	if len(record.Args) > 0 {
+		args, err := json.Marshal(normalizeArgs(record.Args))
+		if err != nil {
+			return nil, err
+		}
+		putField(&buf, tagArgs, args)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeBinary Decodes a record encoded by EncodeBinary into record.
+// Field values come back as JSON values, such as float64 for numbers.
+func DecodeBinary(data []byte, record *Record) error {
+	r := bytes.NewReader(data)
+	if magic, err := r.ReadByte(); err != nil || magic != binaryMagic {
+		return errors.New("not a binary record")
+	}
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > SchemaVersion {
+		return ErrSchemaVersion
+	}
+	record.Context = nil
+	record.Extra = make(RecordExtra)
+	record.Template = ""
+	record.Args = nil
+	for r.Len() > 0 {
+		tag, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if size > uint64(r.Len()) {
+			return errors.New("truncated binary record")
+		}
+		value := make([]byte, size)
+		r.Read(value)
+		switch tag {
+		case tagSeq:
+			record.Seq, _ = binary.Uvarint(value)
+		case tagLevel:
+			level, _ := binary.Varint(value)
+			record.Level = int(level)
+		case tagLevelName:
+			record.LevelName = string(value)
+		case tagChannel:
+			record.Channel = string(value)
+		case tagTime:
+			if err := record.Datetime.UnmarshalBinary(value); err != nil {
+				return err
+			}
+		case tagMessage:
+			record.Message = string(value)
+		case tagContext:
+			if err := json.Unmarshal(value, &record.Context); err != nil {
+				return err
+			}
+		case tagExtra:
+			if err := json.Unmarshal(value, &record.Extra); err != nil {
+				return err
+			}
+		case tagTemplate:
+			record.Template = string(value)
+		case tagArgs:
+			if err := json.Unmarshal(value, &record.Args); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var num [binary.MaxVarintLen64]byte
+	buf.Write(num[:binary.PutUvarint(num[:], v)])
+}
+
+func putField(buf *bytes.Buffer, tag uint64, value []byte) {
+	putUvarint(buf, tag)
+	putUvarint(buf, uint64(len(value)))
+	buf.Write(value)
+}
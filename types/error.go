@@ -0,0 +1,103 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// StackTracer errors carrying the program counters of where they were created.
+// Errors of github.com/pkg/errors, whose StackTrace returns a slice of
+// uintptr based frames, are recognized as well.
+type StackTracer interface {
+	StackTrace() []uintptr
+}
+
+// Frame a stack frame of an error.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Error the structured form of an error and of the chain of errors it wraps.
+type Error struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Stack   []Frame `json:"stack,omitempty"`
+	Cause   *Error  `json:"cause,omitempty"`
+}
+
+// maxErrorChain bounds the unwrapped chain against errors wrapping themselves.
+const maxErrorChain = 32
+
+// NewError Builds the structured form of err, nil for a nil error.
+func NewError(err error) *Error {
+	var head, tail *Error
+	for i := 0; err != nil && i < maxErrorChain; i++ {
+		e := &Error{
+			Message: err.Error(),
+			Type:    fmt.Sprintf("%T", err),
+			Stack:   stackOf(err),
+		}
+		if head == nil {
+			head = e
+		} else {
+			tail.Cause = e
+		}
+		tail = e
+		err = unwrap(err)
+	}
+	return head
+}
+
+// String Get the message of the error.
+func (e *Error) String() string {
+	return e.Message
+}
+
+// unwrap Gets the error wrapped by Unwrap or by the Cause of github.com/pkg/errors.
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		return e.Cause()
+	}
+	return nil
+}
+
+// stackOf Gets the frames of an error implementing a StackTrace method.
+func stackOf(err error) []Frame {
+	var pcs []uintptr
+	if st, ok := err.(StackTracer); ok {
+		pcs = st.StackTrace()
+	} else {
+		m := reflect.ValueOf(err).MethodByName("StackTrace")
+		if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+			return nil
+		}
+		v := m.Call(nil)[0]
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uintptr {
+			return nil
+		}
+		pcs = make([]uintptr, v.Len())
+		for i := range pcs {
+			pcs[i] = uintptr(v.Index(i).Uint())
+		}
+	}
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := make([]Frame, 0, len(pcs))
+	for _, pc := range pcs {
+		// Program counters captured by runtime.Callers are return addresses.
+		fn := runtime.FuncForPC(pc - 1)
+		if fn == nil {
+			continue
+		}
+		file, line := fn.FileLine(pc - 1)
+		frames = append(frames, Frame{Function: fn.Name(), File: file, Line: line})
+	}
+	return frames
+}
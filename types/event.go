@@ -0,0 +1,25 @@
+package types
+
+// EventKey the context key of the event of the records logged by Logger.Event.
+const EventKey = "_event"
+
+// EventRoute the route of handler.Router receiving the events without a routing hint.
+const EventRoute = "event"
+
+// Event a business or audit event, such as a user deleting an order, as
+// opposed to a diagnostic message.
+type Event struct {
+	// Name what happened, such as "order.deleted".
+	Name string `json:"name"`
+	// Actor who did it, such as a user id.
+	Actor string `json:"actor,omitempty"`
+	// Subject what it was done to, such as an order id.
+	Subject string                 `json:"subject,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// EventOf Get the event of a record, nil if it isn't one.
+func EventOf(record *Record) *Event {
+	e, _ := record.Context[EventKey].(*Event)
+	return e
+}
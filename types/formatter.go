@@ -8,3 +8,33 @@ type Formatter interface {
 	// FormatBatch formats a set of log records.
 	FormatBatch(records []*Record) error
 }
+
+// Framing How formatted records are joined into a batch.
+type Framing int
+
+// available Framing values
+const (
+	// FramingLines One record per line, such as NDJSON.
+	FramingLines Framing = iota
+	// FramingArray A JSON array of the records.
+	FramingArray
+	// FramingBulk An action line before each record, such as the Elasticsearch bulk API.
+	FramingBulk
+)
+
+// ContentTyper Interface of the formatters telling the media type of their batches.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// Framer Interface of the formatters telling how their records are framed into a batch.
+type Framer interface {
+	Framing() Framing
+}
+
+// LogValuer Interface of the values providing their own log representation,
+// used by the formatters instead of the value, such as a map of the fields
+// worth logging. The representation may itself be a LogValuer.
+type LogValuer interface {
+	LogValue() interface{}
+}
@@ -0,0 +1,163 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Get Gets the field at key, looked up in the context then in the extra fields.
+func (record *Record) Get(key string) (interface{}, bool) {
+	if v, ok := record.Context[key]; ok {
+		return v, true
+	}
+	v, ok := record.Extra[key]
+	return v, ok
+}
+
+// HasKey Checks whether the record has a field at key.
+func (record *Record) HasKey(key string) bool {
+	_, ok := record.Get(key)
+	return ok
+}
+
+// GetString Gets the field at key as a string, formatting non-string values.
+func (record *Record) GetString(key string) (string, bool) {
+	v, ok := record.Get(key)
+	if !ok {
+		return "", false
+	}
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	case error:
+		return s.Error(), true
+	case fmt.Stringer:
+		return s.String(), true
+	}
+	return fmt.Sprint(v), true
+}
+
+// GetInt Gets the field at key as an int64, converting the numeric types and numeric strings.
+func (record *Record) GetInt(key string) (int64, bool) {
+	v, ok := record.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float32:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case time.Duration:
+		return int64(n), true
+	case Duration:
+		return int64(n), true
+	case Size:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// GetFloat Gets the field at key as a float64, converting the numeric types and numeric strings.
+func (record *Record) GetFloat(key string) (float64, bool) {
+	v, ok := record.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	i, ok := record.GetInt(key)
+	return float64(i), ok
+}
+
+// GetBool Gets the field at key as a bool, parsing strings such as "true".
+func (record *Record) GetBool(key string) (bool, bool) {
+	v, ok := record.Get(key)
+	if !ok {
+		return false, false
+	}
+	switch b := v.(type) {
+	case bool:
+		return b, true
+	case string:
+		p, err := strconv.ParseBool(b)
+		return p, err == nil
+	}
+	return false, false
+}
+
+// GetError Gets the field at key as an error, such as the "error" field of
+// Logger.WithError. Strings are turned into errors.
+func (record *Record) GetError(key string) (error, bool) {
+	v, ok := record.Get(key)
+	if !ok {
+		return nil, false
+	}
+	switch e := v.(type) {
+	case error:
+		return e, true
+	case *Error:
+		return errors.New(e.Message), true
+	case string:
+		return errors.New(e), true
+	}
+	return nil, false
+}
+
+// Walk Calls fn with the context fields then the extra fields, each in key
+// order, until fn returns false. extra tells which map a field is from.
+func (record *Record) Walk(fn func(key string, value interface{}, extra bool) bool) {
+	if !walk(record.Context, false, fn) {
+		return
+	}
+	walk(record.Extra, true, fn)
+}
+
+func walk(fields map[string]interface{}, extra bool, fn func(string, interface{}, bool) bool) bool {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !fn(k, fields[k], extra) {
+			return false
+		}
+	}
+	return true
+}
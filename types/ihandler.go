@@ -15,6 +15,12 @@ type IHandler interface {
 	Close()
 }
 
+// Flusher Interface to describe handlers that buffer writes.
+type Flusher interface {
+	// Flushes the buffered writes.
+	Flush() error
+}
+
 // FormattableHandler Interface to describe loggers that have a formatter
 type FormattableHandler interface {
 	// Sets the formatter.
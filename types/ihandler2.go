@@ -0,0 +1,108 @@
+package types
+
+// IHandler2 Interface of the handlers reporting their failures.
+type IHandler2 interface {
+	// Checks whether the given record will be handled by this handler.
+	IsHandling(record *Record) bool
+
+	// Handles a record, true stops the bubbling.
+	Handle(record *Record) (bool, error)
+
+	// Handles a set of records at once.
+	HandleBatch(records []*Record) error
+
+	// Closes the handler.
+	Close() error
+}
+
+// ErrCloser Interface of the handlers whose closing may fail.
+type ErrCloser interface {
+	// Closes the handler.
+	CloseErr() error
+}
+
+// ToHandler2 Adapts a handler to IHandler2, errors are the ones the handler
+// reports through ResultHandler.
+func ToHandler2(h IHandler) IHandler2 {
+	if a, ok := h.(*handler1); ok {
+		return a.h
+	}
+	return &handler2{h}
+}
+
+// FromHandler2 Adapts an IHandler2 to be pushed on a logger, which passes
+// its errors to the logger's error handler.
+func FromHandler2(h IHandler2) IHandler {
+	if a, ok := h.(*handler2); ok {
+		return a.h
+	}
+	return &handler1{h}
+}
+
+// handler2 an IHandler adapted to IHandler2.
+type handler2 struct {
+	h IHandler
+}
+
+func (a *handler2) IsHandling(record *Record) bool {
+	return a.h.IsHandling(record)
+}
+
+func (a *handler2) Handle(record *Record) (bool, error) {
+	res := HandleResult(a.h, record)
+	return res.Action == Stop, res.Err
+}
+
+func (a *handler2) HandleBatch(records []*Record) error {
+	var err error
+	for _, record := range records {
+		if _, e := a.Handle(record); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (a *handler2) Close() error {
+	if c, ok := a.h.(ErrCloser); ok {
+		return c.CloseErr()
+	}
+	a.h.Close()
+	return nil
+}
+
+// handler1 an IHandler2 adapted to IHandler.
+type handler1 struct {
+	h IHandler2
+}
+
+func (a *handler1) IsHandling(record *Record) bool {
+	return a.h.IsHandling(record)
+}
+
+func (a *handler1) Handle(record *Record) bool {
+	return a.HandleResult(record).Action == Stop
+}
+
+func (a *handler1) HandleResult(record *Record) Result {
+	stop, err := a.h.Handle(record)
+	switch {
+	case stop:
+		return Result{Action: Stop, Err: err}
+	case a.h.IsHandling(record):
+		return Result{Action: Handled, Err: err}
+	}
+	return Result{Action: Continue, Err: err}
+}
+
+func (a *handler1) HandleBatch(records []*Record) {
+	a.h.HandleBatch(records)
+}
+
+func (a *handler1) Close() {
+	a.h.Close()
+}
+
+func (a *handler1) CloseErr() error {
+	return a.h.Close()
+}
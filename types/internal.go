@@ -0,0 +1,60 @@
+package types
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// InternalChannel The channel of the records the library logs about itself.
+const InternalChannel = "llog"
+
+// InternalFunc Receives the failures the library logs about itself, such as
+// reconnects and dropped records.
+type InternalFunc func(level int, message string, context RecordContext)
+
+var (
+	internalFunc atomic.Value
+	// internalBusy drops internal records raised while one is being logged,
+	// e.g. by a failing handler of the internal logger itself.
+	internalBusy int32
+)
+
+// internalHolder keeps the stored type of internalFunc constant.
+type internalHolder struct {
+	fn InternalFunc
+}
+
+// SetInternal Set the function receiving the library's own failures, nil disables it.
+func SetInternal(fn InternalFunc) {
+	internalFunc.Store(internalHolder{fn})
+}
+
+// Internal Logs a failure of the library itself.
+func Internal(level int, message string, context RecordContext) {
+	h, ok := internalFunc.Load().(internalHolder)
+	if !ok || h.fn == nil {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&internalBusy, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&internalBusy, 0)
+	h.fn(level, message, context)
+}
+
+// Health The state of a handler delivering records to a remote end.
+type Health struct {
+	// Whether the handler is connected, or its last delivery succeeded.
+	Connected bool
+	// The number of records waiting to be delivered.
+	Backlog int
+	// The last delivery failure, nil if none.
+	LastError error
+	// The time of the last delivery failure.
+	LastErrorTime time.Time
+}
+
+// HealthChecker Interface of the handlers reporting their health.
+type HealthChecker interface {
+	Health() Health
+}
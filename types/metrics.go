@@ -0,0 +1,53 @@
+package types
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// MetricsHook Interface receiving the logging activity, such as the metrics
+// package collector. Handlers are named by their type, e.g. "*handler.File".
+type MetricsHook interface {
+	// A record was dispatched by a logger.
+	RecordLogged(channel, level string)
+
+	// A handler failed to format or write a record.
+	HandlerError(handler string, err error)
+
+	// A handler dropped a record.
+	RecordDropped(handler string)
+
+	// A handler rotated its file.
+	Rotated(handler string)
+
+	// A handler took d to handle a record.
+	HandlerLatency(handler string, d time.Duration)
+}
+
+var metricsHook atomic.Value
+
+// hookHolder keeps the stored type of metricsHook constant.
+type hookHolder struct {
+	hook MetricsHook
+}
+
+// SetMetricsHook Set the hook receiving the logging activity, nil disables it.
+func SetMetricsHook(hook MetricsHook) {
+	metricsHook.Store(hookHolder{hook})
+}
+
+// Metrics Get the metrics hook, nil if none is set.
+func Metrics() MetricsHook {
+	if h, ok := metricsHook.Load().(hookHolder); ok {
+		return h.hook
+	}
+	return nil
+}
+
+// DerivedMetricsHook Optional interface of the metrics hooks receiving the
+// metrics derived from records by metrics.Bridge.
+type DerivedMetricsHook interface {
+	// A derived metric observed value, 1 for counters, with the exemplar of
+	// the record such as its trace id, nil if none.
+	Derived(name string, labels map[string]string, value float64, exemplar map[string]string)
+}
@@ -2,12 +2,17 @@ package types
 
 import (
 	"bytes"
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var recordPool *sync.Pool
 
+// recordSeq the sequence number of the last record.
+var recordSeq uint64
+
 func init() {
 	recordPool = &sync.Pool{
 		New: func() interface{} {
@@ -33,6 +38,21 @@ type Record struct {
 	Context   RecordContext
 	Extra     RecordExtra
 	Formatted *bytes.Buffer
+	// Ctx is the context the record was logged with, it may be nil.
+	Ctx context.Context
+	// Seq is a process-wide sequence number totally ordering records,
+	// even those logged within the same clock tick.
+	Seq uint64
+	// Template and Args are the format and arguments of the records logged
+	// by the printf-style methods, Message being the rendered string, so
+	// sinks can group records by template. Template is empty otherwise.
+	Template string
+	Args     []interface{}
+}
+
+// NextSeq Gets the next record sequence number, starting at 1.
+func NextSeq() uint64 {
+	return atomic.AddUint64(&recordSeq, 1)
 }
 
 // NewRecord Get record from pool.
@@ -56,6 +76,49 @@ func ReleaseRecord(record *Record) {
 	if record == nil {
 		return
 	}
+	if record.Formatted.Cap() > MaxPooledBufferSize {
+		record.Formatted = new(bytes.Buffer)
+	}
 	record.Formatted.Reset()
+	// keep the extra map to reuse, dropping the values of the released record
+	for k := range record.Extra {
+		delete(record.Extra, k)
+	}
+	record.Context = nil
+	record.Ctx = nil
+	record.Template = ""
+	record.Args = nil
 	recordPool.Put(record)
 }
+
+// Clone Copies the record from the pool, so that a handler may change or keep
+// it without affecting the other handlers the record is dispatched to.
+// The context and extra maps are copied, their values are shared.
+// Release the copy with ReleaseRecord once handled.
+func (record *Record) Clone() *Record {
+	c := GetRecord()
+	formatted, extra := c.Formatted, c.Extra
+	*c = *record
+	c.Formatted = formatted
+	c.Formatted.Write(record.Formatted.Bytes())
+	if record.Context != nil {
+		c.Context = make(RecordContext, len(record.Context))
+		for k, v := range record.Context {
+			c.Context[k] = v
+		}
+	}
+	if extra == nil {
+		extra = make(RecordExtra, len(record.Extra))
+	}
+	for k, v := range record.Extra {
+		extra[k] = v
+	}
+	c.Extra = extra
+	return c
+}
+
+// TargetKey the context key of the routing hint read by handler.Router.
+const TargetKey = "_target"
+
+// TenantKey the context key of the tenant read by handler.Tenant.
+const TenantKey = "tenant"
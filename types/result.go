@@ -0,0 +1,45 @@
+package types
+
+// Action what the handler chain does after a handler got a record.
+type Action int
+
+// available Action values
+const (
+	// Continue the record was not handled and is passed to the next handler.
+	Continue Action = iota
+	// Handled the record was handled and bubbles to the next handler.
+	Handled
+	// Stop the record was handled and does not bubble.
+	Stop
+)
+
+// Result the outcome of a handler getting a record.
+type Result struct {
+	Action Action
+	// Err the error the handler failed with, if any.
+	Err error
+}
+
+// ResultHandler Interface of the handlers reporting explicit results.
+type ResultHandler interface {
+	IHandler
+
+	// Handles a record, reporting what the chain does next.
+	HandleResult(record *Record) Result
+}
+
+// HandleResult Passes the record to h, translating the bool returned by
+// handlers not implementing ResultHandler: true stops the chain, false
+// continues it, as Handled if h handles the level of the record.
+func HandleResult(h IHandler, record *Record) Result {
+	if rh, ok := h.(ResultHandler); ok {
+		return rh.HandleResult(record)
+	}
+	if h.Handle(record) {
+		return Result{Action: Stop}
+	}
+	if h.IsHandling(record) {
+		return Result{Action: Handled}
+	}
+	return Result{Action: Continue}
+}
@@ -0,0 +1,24 @@
+package types
+
+import (
+	"time"
+)
+
+// HandlerStats Counters of a handler, such as to expose the health of sinks.
+type HandlerStats struct {
+	// The records written, or passed on by handlers wrapping others.
+	Handled uint64
+	// The bytes of the formatted records written.
+	Bytes uint64
+	// The records that failed to be formatted or written.
+	Errors uint64
+	// The time of the last failure, zero if none.
+	LastErrorTime time.Time
+	// The records waiting to be written by asynchronous handlers.
+	QueueDepth int
+}
+
+// StatsReporter Interface of the handlers reporting their counters.
+type StatsReporter interface {
+	HandlerStats() HandlerStats
+}
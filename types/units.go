@@ -0,0 +1,59 @@
+package types
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Duration a duration field, rendered as a human-readable string such as "1.5s".
+// Formatters with numeric units add its value in milliseconds under key_ms.
+type Duration time.Duration
+
+// Size a byte size field, rendered as a human-readable string such as "1.5MiB".
+// Formatters with numeric units add its value under key_bytes.
+type Size int64
+
+// String Get the human-readable duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Milliseconds Get the duration in milliseconds.
+func (d Duration) Milliseconds() float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// MarshalJSON Encodes the human-readable duration.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+var sizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// String Get the human-readable size, in binary units.
+func (s Size) String() string {
+	f := float64(s)
+	neg := f < 0
+	if neg {
+		f = -f
+	}
+	i := 0
+	for f >= 1024 && i < len(sizeUnits)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(int64(s), 10) + "B"
+	}
+	if neg {
+		f = -f
+	}
+	// one decimal at most, such as 1.5MiB
+	return strconv.FormatFloat(math.Floor(f*10+0.5)/10, 'f', -1, 64) + sizeUnits[i]
+}
+
+// MarshalJSON Encodes the human-readable size.
+func (s Size) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(s.String())), nil
+}
@@ -0,0 +1,28 @@
+package llog
+
+import (
+	"bytes"
+	"io"
+)
+
+// writer logs every line written to it.
+type writer struct {
+	logger *Logger
+	level  int
+}
+
+// NewWriter Creates a writer logging each written line at the given level,
+// for redirecting the output of the standard log package or frameworks.
+func NewWriter(l *Logger, level int) io.Writer {
+	return &writer{logger: l, level: level}
+}
+
+// Write Logs each line of p, a trailing newline is not required.
+func (w *writer) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\r\n"), []byte("\n")) {
+		if len(line) > 0 {
+			w.logger.AddRecord(w.level, string(bytes.TrimRight(line, "\r")))
+		}
+	}
+	return len(p), nil
+}